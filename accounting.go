@@ -0,0 +1,160 @@
+package hashcash
+
+import (
+	"sync"
+	"time"
+)
+
+// AccountingConfig for bits accounting
+type AccountingConfig struct {
+	// Retention longest window which can be queried, older records are
+	// dropped.
+	Retention time.Duration
+	// Resolution width of the time buckets bits are summed in. Windows are
+	// rounded up to whole buckets, so the oldest bucket may be partly
+	// outside a window.
+	Resolution time.Duration
+}
+
+// DefaultAccountingConfig default bits accounting configuration
+var DefaultAccountingConfig = &AccountingConfig{
+	Retention:  30 * 24 * time.Hour,
+	Resolution: time.Hour,
+}
+
+// bitsBucket bits and work recorded for a key within one bucket
+type bitsBucket struct {
+	start int64
+	bits  uint64
+	work  float64
+}
+
+// Accounting sums the bits of headers verified per remote key (IP address,
+// account, etc...) over rolling windows, so services can reward clients which
+// have invested significant work, e.g. relaxing limits. It is safe for
+// concurrent use.
+type Accounting struct {
+	mu     sync.Mutex
+	config AccountingConfig
+	keys   map[string][]bitsBucket
+	swept  int64
+}
+
+// NewAccounting creates bits accounting. If config is nil
+// DefaultAccountingConfig is used.
+func NewAccounting(config *AccountingConfig) *Accounting {
+	if config == nil {
+		config = DefaultAccountingConfig
+	}
+	a := &Accounting{
+		config: *config,
+		keys:   make(map[string][]bitsBucket),
+	}
+	if a.config.Resolution <= 0 {
+		a.config.Resolution = DefaultAccountingConfig.Resolution
+	}
+	if a.config.Retention < a.config.Resolution {
+		a.config.Retention = a.config.Resolution
+	}
+	return a
+}
+
+// bucket returns the bucket t falls in.
+func (a *Accounting) bucket(t time.Time) int64 {
+	return t.UnixNano() / int64(a.config.Resolution)
+}
+
+// oldest returns the oldest bucket of a window ending in bucket now.
+func (a *Accounting) oldest(now int64, window time.Duration) int64 {
+	n := (int64(window) + int64(a.config.Resolution) - 1) / int64(a.config.Resolution)
+	return now - n + 1
+}
+
+// Record adds a header of bits verified for key.
+func (a *Accounting) Record(key string, bits Bits) {
+	now := a.bucket(time.Now())
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now != a.swept {
+		a.sweep(now)
+	}
+	buckets := a.keys[key]
+	if n := len(buckets); n == 0 || buckets[n-1].start != now {
+		buckets = append(buckets, bitsBucket{start: now})
+	}
+	b := &buckets[len(buckets)-1]
+	b.bits += uint64(bits)
+	b.work += bits.ExpectedAttempts()
+	a.keys[key] = buckets
+}
+
+// sweep drops buckets older than Retention, once per bucket. a.mu must be
+// held.
+func (a *Accounting) sweep(now int64) {
+	oldest := a.oldest(now, a.config.Retention)
+	for key, buckets := range a.keys {
+		i := 0
+		for i < len(buckets) && buckets[i].start < oldest {
+			i++
+		}
+		switch {
+		case i == len(buckets):
+			delete(a.keys, key)
+		case i > 0:
+			a.keys[key] = append([]bitsBucket(nil), buckets[i:]...)
+		}
+	}
+	a.swept = now
+}
+
+// sum returns the bits and work recorded for key within window.
+func (a *Accounting) sum(key string, window time.Duration) (uint64, float64) {
+	if window > a.config.Retention {
+		window = a.config.Retention
+	}
+	oldest := a.oldest(a.bucket(time.Now()), window)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var (
+		bits uint64
+		work float64
+	)
+	for _, b := range a.keys[key] {
+		if b.start >= oldest {
+			bits += b.bits
+			work += b.work
+		}
+	}
+	return bits, work
+}
+
+// BitsSpent returns the sum of the bits of headers verified for key within
+// window, at most Retention.
+func (a *Accounting) BitsSpent(key string, window time.Duration) uint64 {
+	bits, _ := a.sum(key, window)
+	return bits
+}
+
+// WorkSpent returns the expected number of hashes computed for headers
+// verified for key within window, at most Retention. Unlike bits, work grows
+// exponentially with the bits of each header.
+func (a *Accounting) WorkSpent(key string, window time.Duration) float64 {
+	_, work := a.sum(key, window)
+	return work
+}
+
+// Len returns the number of keys with records within Retention.
+func (a *Accounting) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.keys)
+}
+
+// verifiedBits returns the bits a verified header is credited with, the bits
+// it claims capped at the leading zero bits its digest actually has.
+func verifiedBits(ev *VerifyEvent) Bits {
+	if ev.ZeroBits < int(ev.Bits) {
+		return Bits(ev.ZeroBits)
+	}
+	return ev.Bits
+}
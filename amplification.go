@@ -0,0 +1,118 @@
+package hashcash
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxIssueKeys bound on remote keys whose challenges are counted in a window
+const maxIssueKeys = 1 << 16
+
+// CheckHello guards challenge replies sent over UDP-like transports, where
+// the source of a request can be spoofed, against the verifier being used to
+// amplify traffic. hello is the request for a challenge: a compact stamp of
+// the instance's Bits, typically a trivially small number, minted for its
+// resource, optionally followed by padding. It returns nil if a challenge of
+// size bytes may be sent in reply to remote, i.e. size is at most
+// Config.MaxChallengeSize and Config.AmplificationFactor times len(hello),
+// the remote key is within the issuance limits of Config.MaxChallenges and
+// Config.MaxChallengeBytes, and the stamp is valid and unspent, so every
+// request costs fresh work. Keys blocked by Config.Reputation are rejected
+// as in verification. Otherwise ErrAmplification, ErrIssueLimit or the
+// verification error is returned, and nothing should be sent.
+func (h *Hashcash) CheckHello(ctx context.Context, hello []byte, size int, remote Remote) error {
+	if len(hello) < CompactSize {
+		return ErrInvalidHeader
+	}
+	// cheap size checks first, so oversized replies do not spend stamps.
+	if h.maxChallenge > 0 && size > h.maxChallenge {
+		return ErrAmplification
+	}
+	if float64(size) > h.amplification*float64(len(hello)) {
+		return ErrAmplification
+	}
+	if h.issued != nil && remote.Key != "" {
+		if !h.issued.reserve(remote.Key, size, h.now()) {
+			return ErrIssueLimit
+		}
+		if _, err := h.VerifyCompactContext(ctx, hello[:CompactSize], remote); err != nil {
+			h.issued.refund(remote.Key, size)
+			return err
+		}
+		return nil
+	}
+	_, err := h.VerifyCompactContext(ctx, hello[:CompactSize], remote)
+	return err
+}
+
+// issued challenges allowed for a remote key and their total size
+type issued struct {
+	count int
+	bytes int
+}
+
+// issuance counts the challenges allowed per remote key in fixed windows.
+// Counts are dropped when a window ends, and at most maxIssueKeys keys are
+// counted per window, further keys are refused until it ends.
+type issuance struct {
+	mu       sync.Mutex
+	max      int
+	maxBytes int
+	window   time.Duration
+	start    time.Time
+	keys     map[string]issued
+}
+
+// newIssuance creates issuance counts limited by config.
+func newIssuance(config *Config) *issuance {
+	window := config.ChallengeWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &issuance{
+		max:      config.MaxChallenges,
+		maxBytes: config.MaxChallengeBytes,
+		window:   window,
+		keys:     make(map[string]issued),
+	}
+}
+
+// reserve counts a challenge of size bytes for key at now, reporting false
+// without counting it if key is over its limits.
+func (is *issuance) reserve(key string, size int, now time.Time) bool {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if now.Sub(is.start) >= is.window || now.Before(is.start) {
+		is.keys = make(map[string]issued)
+		is.start = now
+	}
+	n, ok := is.keys[key]
+	if !ok && len(is.keys) >= maxIssueKeys {
+		return false
+	}
+	if is.max > 0 && n.count >= is.max {
+		return false
+	}
+	if is.maxBytes > 0 && n.bytes+size > is.maxBytes {
+		return false
+	}
+	is.keys[key] = issued{count: n.count + 1, bytes: n.bytes + size}
+	return true
+}
+
+// refund uncounts a challenge of size bytes reserved for key, which was not
+// sent.
+func (is *issuance) refund(key string, size int) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	n, ok := is.keys[key]
+	if !ok {
+		return
+	}
+	if n.count <= 1 {
+		delete(is.keys, key)
+		return
+	}
+	is.keys[key] = issued{count: n.count - 1, bytes: n.bytes - size}
+}
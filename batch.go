@@ -0,0 +1,86 @@
+package hashcash
+
+import (
+	"context"
+	"time"
+)
+
+// VerifyBatch verifies headers in bulk, returning the outcome of each header.
+// Headers are checked as Verify does, but spent storage implementing
+// BatchSpender is consulted once for all headers rather than once per header,
+// cutting round trips to remote storage, unless it implements
+// ContextCheckAndAdder or CheckAndAdder.
+// A header repeated within headers is rejected as spent after its first
+// occurrence. Config.OnVerify is called for every header.
+func (h *Hashcash) VerifyBatch(ctx context.Context, headers []string) ([]bool, []error) {
+	var (
+		valid  = make([]bool, len(headers))
+		errs   = make([]error, len(headers))
+		events = make([]VerifyEvent, len(headers))
+		keys   []string
+		idx    []int
+	)
+	for i, header := range headers {
+		ev := &events[i]
+		*ev = VerifyEvent{Context: ctx, Instance: h.name, Header: header}
+		start := time.Now()
+		key, err := h.check(header, ev)
+		ev.Duration = time.Since(start)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		keys = append(keys, key)
+		idx = append(idx, i)
+	}
+	if h.atomic() {
+		for j, i := range idx {
+			ev := &events[i]
+			t := time.Now()
+			errs[i] = h.claim(ev, keys[j])
+			ev.StorageTime = time.Since(t)
+			ev.Duration += ev.StorageTime
+		}
+	} else if len(keys) > 0 {
+		start := time.Now()
+		isSpent, spentErrs := h.spentBatch(ctx, keys)
+		lookup := time.Since(start)
+		seen := make(map[string]bool, len(keys))
+		for j, i := range idx {
+			ev := &events[i]
+			if spentErrs[j] != nil {
+				errs[i] = spentErrs[j]
+				continue
+			}
+			t := time.Now()
+			errs[i] = h.spend(ev, keys[j], isSpent[j] || seen[keys[j]])
+			seen[keys[j]] = true
+			ev.StorageTime = lookup + time.Since(t)
+			ev.Duration += ev.StorageTime
+		}
+	}
+	for i := range events {
+		ev := &events[i]
+		ev.Valid = errs[i] == nil
+		ev.Err = errs[i]
+		valid[i] = ev.Valid
+		if h.onVerify != nil {
+			h.onVerify(*ev)
+		}
+	}
+	return valid, errs
+}
+
+// spentBatch checks which of keys are in storage, Config.StorageV2 when set,
+// with the error of each failed check.
+func (h *Hashcash) spentBatch(ctx context.Context, keys []string) ([]bool, []error) {
+	errs := make([]error, len(keys))
+	if h.store == nil {
+		return spentBatch(ctx, h.storage, keys), errs
+	}
+	isSpent := make([]bool, len(keys))
+	for i, key := range keys {
+		isSpent[i], errs[i] = h.isSpent(ctx, key)
+	}
+	return isSpent, errs
+}
@@ -0,0 +1,215 @@
+package hashcash
+
+import (
+	"context"
+	"crypto"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// BenchmarkConfig for a self benchmark
+type BenchmarkConfig struct {
+	// Duration of each measurement, one second when zero.
+	Duration time.Duration
+	// Hash algorithm benchmarked, SHA-1 when zero, see Config.Hash.
+	Hash crypto.Hash
+	// Workers goroutines minting in parallel, GOMAXPROCS when not positive.
+	Workers int
+	// MinBits and MaxBits range of bits solve times are estimated for, 16 to
+	// 32 when zero.
+	MinBits Bits
+	MaxBits Bits
+}
+
+// SolveTime expected time to mint a header of Bits on the benchmarked machine
+type SolveTime struct {
+	Bits Bits `json:"bits"`
+	// Attempts expected number of headers hashed.
+	Attempts float64 `json:"attempts"`
+	// Seconds expected time on one core.
+	Seconds float64 `json:"seconds"`
+	// ParallelSeconds expected time on Workers cores.
+	ParallelSeconds float64 `json:"parallel_seconds"`
+}
+
+// BenchmarkReport measured performance of the machine, in a form which can be
+// collected across a fleet, e.g. to recommend bits.
+type BenchmarkReport struct {
+	Hash      string `json:"hash"`
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	NumCPU    int    `json:"num_cpu"`
+	GoVersion string `json:"go_version"`
+	Workers   int    `json:"workers"`
+	// HashRate headers hashed per second on one core.
+	HashRate float64 `json:"hash_rate"`
+	// ParallelHashRate headers hashed per second on Workers cores.
+	ParallelHashRate float64 `json:"parallel_hash_rate"`
+	// VerifyRate headers verified per second on one core, excluding spent
+	// storage.
+	VerifyRate float64     `json:"verify_rate"`
+	SolveTimes []SolveTime `json:"solve_times"`
+}
+
+// Benchmark measures the hash rate and verify throughput of the machine it
+// runs on, estimating the time to mint headers of a range of bits. It takes
+// about three times BenchmarkConfig.Duration. If ctx is done, its error is
+// returned.
+func Benchmark(ctx context.Context, config *BenchmarkConfig) (*BenchmarkReport, error) {
+	var c BenchmarkConfig
+	if config != nil {
+		c = *config
+	}
+	if c.Duration <= 0 {
+		c.Duration = time.Second
+	}
+	if c.Workers <= 0 {
+		c.Workers = runtime.GOMAXPROCS(0)
+	}
+	if c.MinBits == 0 && c.MaxBits == 0 {
+		c.MinBits, c.MaxBits = 16, 32
+	}
+	if err := c.MaxBits.Validate(); err != nil {
+		return nil, err
+	}
+	h, err := New(
+		&Resource{Data: "benchmark", Accept: []string{"benchmark"}},
+		&Config{
+			Bits:    8,
+			Future:  time.Now().AddDate(0, 0, 2),
+			Storage: NewMemoryStorage(nil),
+			Hash:    c.Hash,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	hash := crypto.SHA1
+	if c.Hash != 0 {
+		hash = c.Hash
+	}
+	r := &BenchmarkReport{
+		Hash:      hash.String(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		Workers:   c.Workers,
+	}
+	if r.HashRate, err = h.benchHash(ctx, c.Duration, 1); err != nil {
+		return nil, err
+	}
+	if r.ParallelHashRate, err = h.benchHash(ctx, c.Duration, c.Workers); err != nil {
+		return nil, err
+	}
+	if r.VerifyRate, err = h.benchVerify(ctx, c.Duration); err != nil {
+		return nil, err
+	}
+	for bits := c.MinBits; bits <= c.MaxBits; bits++ {
+		attempts := bits.ExpectedAttempts()
+		r.SolveTimes = append(r.SolveTimes, SolveTime{
+			Bits:            bits,
+			Attempts:        attempts,
+			Seconds:         attempts / r.HashRate,
+			ParallelSeconds: attempts / r.ParallelHashRate,
+		})
+	}
+	return r, nil
+}
+
+// calibrateSample time Calibrate measures the hash rate for
+const calibrateSample = 250 * time.Millisecond
+
+// Calibrate returns the bits of SHA-1 headers which take about target to mint
+// on one core of the machine it runs on, within a factor of 1.4 on average,
+// so operators can choose Bits from a mint time rather than guess. It
+// measures the hash rate for a quarter of a second. The time to mint a
+// header varies widely around its expectation, see Bits.ExpectedAttempts.
+func Calibrate(target time.Duration) Bits {
+	h, err := New(&Resource{Data: "calibrate"}, &Config{Bits: 8, Storage: NewMemoryStorage(nil)})
+	if err != nil {
+		return 0
+	}
+	return bitsFor(h.HashRate(calibrateSample), target)
+}
+
+// HashRate returns the headers h hashes per second on one core, measured
+// for sample, or a quarter of a second when sample is not positive. Headers
+// are hashed with the configured algorithm, so the rate reflects the
+// throughput of Compute, e.g. to plan capacity or choose bits.
+func (h *Hashcash) HashRate(sample time.Duration) float64 {
+	if sample <= 0 {
+		sample = calibrateSample
+	}
+	rate, _ := h.benchHash(context.Background(), sample, 1)
+	return rate
+}
+
+// bitsFor returns the bits whose expected attempts are closest to those made
+// in target at rate headers per second.
+func bitsFor(rate float64, target time.Duration) Bits {
+	attempts := rate * target.Seconds()
+	if attempts <= 1 {
+		return 0
+	}
+	return Bits(math.Min(math.Round(math.Log2(attempts)), float64(maxBits)))
+}
+
+// benchHash returns the headers hashed per second by workers goroutines over
+// d.
+func (h *Hashcash) benchHash(ctx context.Context, d time.Duration, workers int) (float64, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		total  uint64
+		start  = time.Now()
+		cutoff = start.Add(d)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var n uint64
+			for counter := uint64(i) << 40; ; counter++ {
+				h.digest(h.headerAt(counter))
+				n++
+				if n%mintStepCheck == 0 && (ctx.Err() != nil || !time.Now().Before(cutoff)) {
+					break
+				}
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return float64(total) / time.Since(start).Seconds(), nil
+}
+
+// benchVerify returns the headers verified per second over d, excluding
+// spent storage.
+func (h *Hashcash) benchVerify(ctx context.Context, d time.Duration) (float64, error) {
+	header, err := h.ComputeContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		n      uint64
+		start  = time.Now()
+		cutoff = start.Add(d)
+	)
+	for ; ; n++ {
+		if _, err := h.check(header, &VerifyEvent{Context: ctx}); err != nil {
+			return 0, err
+		}
+		if n%1024 == 0 && !time.Now().Before(cutoff) {
+			break
+		}
+	}
+	return float64(n+1) / time.Since(start).Seconds(), nil
+}
@@ -0,0 +1,40 @@
+package hashcash
+
+import (
+	"math"
+	"strconv"
+)
+
+// Bits number of leading zero bits, the collision size, of a hashcash
+// header. Valid values are 0-64.
+type Bits uint8
+
+// ParseBits parses the bits field of a hashcash header. If s is not a number
+// within the supported range ErrInvalidBits error is returned.
+func ParseBits(s string) (Bits, error) {
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, ErrInvalidBits
+	}
+	b := Bits(n)
+	return b, b.Validate()
+}
+
+// Validate checks b is within the supported range of 0-64.
+func (b Bits) Validate() error {
+	if int(b) > maxBits {
+		return ErrInvalidBits
+	}
+	return nil
+}
+
+// ExpectedAttempts number of headers which are expected to be hashed to find
+// a solution with b bits, i.e. 2^b.
+func (b Bits) ExpectedAttempts() float64 {
+	return math.Ldexp(1, int(b))
+}
+
+// String formats b as it appears in a hashcash header.
+func (b Bits) String() string {
+	return strconv.Itoa(int(b))
+}
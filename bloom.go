@@ -0,0 +1,165 @@
+package hashcash
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultFalsePositiveRate false positive rate of a Bloom filter when not
+// configured
+const defaultFalsePositiveRate = 0.001
+
+// bloomFilter set membership filter without false negatives, sized for a
+// capacity and false positive rate.
+type bloomFilter struct {
+	bits    []uint64
+	m       uint64
+	k       int
+	count   int
+	created time.Time
+}
+
+// newBloomFilter creates a filter holding capacity entries with false
+// positive rate p. The optimal m = -n*ln(p)/ln(2)^2 bits and k = m/n*ln(2)
+// hash functions are used.
+func newBloomFilter(capacity int, p float64, created time.Time) *bloomFilter {
+	n := math.Max(float64(capacity), 1)
+	m := uint64(math.Ceil(-n * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:    make([]uint64, (m+63)/64),
+		m:       m,
+		k:       k,
+		created: created,
+	}
+}
+
+// hashes returns two independent hashes of key, from which the k bit
+// positions are derived by double hashing.
+func (b *bloomFilter) hashes(key string) (h1, h2 uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// insert adds key.
+func (b *bloomFilter) insert(key string) {
+	h1, h2 := b.hashes(key)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+	b.count++
+}
+
+// contains reports whether key may have been inserted.
+func (b *bloomFilter) contains(key string) bool {
+	h1, h2 := b.hashes(key)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BloomFilterConfig for a Bloom filter
+type BloomFilterConfig struct {
+	// Window how long entries are remembered, at least the age at which
+	// verified headers expire, e.g. 28 days.
+	Window time.Duration
+	// Capacity expected number of entries added within Window. The filter
+	// rotates early when it is exceeded, forgetting entries added more than
+	// one rotation ago.
+	Capacity int
+	// FalsePositiveRate probability an entry never added is reported as
+	// spent, 0.001 when zero.
+	FalsePositiveRate float64
+}
+
+// BloomFilter probabilistic spent storage for very high volume verifiers.
+// Entries are kept in two rotating Bloom filters, each covering Window, so an
+// entry is remembered for between one and two windows. There are no false
+// negatives within Window, and an entry never added is reported as spent
+// with at most FalsePositiveRate, rejecting fresh headers with ErrSpent.
+// Each filter uses -ln(p)/ln(2)^2 bits per entry of Capacity, where p is half
+// of FalsePositiveRate, about 1.9 bytes at the default rate, against around
+// 100 bytes per entry for a map of hex digests.
+// It is safe for concurrent use.
+type BloomFilter struct {
+	mu       sync.Mutex
+	config   BloomFilterConfig
+	current  *bloomFilter
+	previous *bloomFilter
+}
+
+// NewBloomFilter creates a Bloom filter.
+func NewBloomFilter(config *BloomFilterConfig) *BloomFilter {
+	b := &BloomFilter{config: *config}
+	if b.config.FalsePositiveRate <= 0 || b.config.FalsePositiveRate >= 1 {
+		b.config.FalsePositiveRate = defaultFalsePositiveRate
+	}
+	now := time.Now()
+	b.current = b.newFilter(now)
+	b.previous = b.newFilter(now)
+	return b
+}
+
+// newFilter creates a filter with half the false positive rate, as entries
+// are checked against two filters.
+func (b *BloomFilter) newFilter(now time.Time) *bloomFilter {
+	return newBloomFilter(b.config.Capacity, b.config.FalsePositiveRate/2, now)
+}
+
+// rotate starts a new filter once the current one covers Window.
+func (b *BloomFilter) rotate(now time.Time) {
+	age := now.Sub(b.current.created)
+	if age < b.config.Window {
+		return
+	}
+	b.previous = b.current
+	if age >= 2*b.config.Window {
+		b.previous = b.newFilter(now)
+	}
+	b.current = b.newFilter(now)
+}
+
+// Add adds a hashcash entry to the filter
+func (b *BloomFilter) Add(hash string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.rotate(now)
+	if b.config.Capacity > 0 && b.current.count >= b.config.Capacity {
+		b.previous = b.current
+		b.current = b.newFilter(now)
+	}
+	b.current.insert(hash)
+	return nil
+}
+
+// Spent checks if a hashcash entry may have been added to the filter.
+func (b *BloomFilter) Spent(hash string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(time.Now())
+	return b.current.contains(hash) || b.previous.contains(hash)
+}
+
+// Len returns the number of entries held by the filter.
+func (b *BloomFilter) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current.count + b.previous.count
+}
@@ -0,0 +1,277 @@
+package hashcash
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Lister is optionally implemented by Storage to enumerate entries added
+// since a time, e.g. to preload a Cache.
+type Lister interface {
+	Recent(since time.Time, fn func(SpentInfo) error) error
+}
+
+// CacheConfig for a spent cache
+type CacheConfig struct {
+	// MaxEntries bound on entries held in memory, the oldest entries are
+	// evicted first. Zero means no bound.
+	MaxEntries int
+	// OnProgress optional callback invoked during Preload with the number
+	// of entries loaded so far.
+	OnProgress func(loaded int)
+	// ProgressEvery entries loaded between calls to OnProgress.
+	ProgressEvery int
+}
+
+// Cache spent storage caching entries of a slow backend in memory. Entries
+// are written through to the backend, Spent only consults the backend for
+// entries missing from memory. It is safe for concurrent use if the backend
+// is. The optional storage interfaces are forwarded to the backend, falling
+// back as verification does when the backend does not implement them, so
+// wrapping a backend in a Cache keeps its atomic check and add.
+type Cache struct {
+	backend Storage
+	config  CacheConfig
+	mu      sync.Mutex
+	entries map[string]struct{}
+	// order keys in insertion order, used for eviction.
+	order []string
+}
+
+// NewCache creates a cache in front of backend. If config is nil entries are
+// not bounded.
+func NewCache(backend Storage, config *CacheConfig) *Cache {
+	c := &Cache{
+		backend: backend,
+		entries: make(map[string]struct{}),
+	}
+	if config != nil {
+		c.config = *config
+	}
+	return c
+}
+
+// Preload loads entries added to the backend since since, e.g. the expiry
+// time of headers, so a freshly started verifier does not depend on a cold
+// cache. It returns the number of entries loaded. The backend must implement
+// Lister.
+func (c *Cache) Preload(ctx context.Context, since time.Time) (int, error) {
+	lister, ok := c.backend.(Lister)
+	if !ok {
+		return 0, ErrNotLister
+	}
+	loaded := 0
+	err := lister.Recent(since, func(info SpentInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.insert(info.Key)
+		c.mu.Unlock()
+		loaded++
+		if c.config.OnProgress != nil && c.config.ProgressEvery > 0 && loaded%c.config.ProgressEvery == 0 {
+			c.config.OnProgress(loaded)
+		}
+		return nil
+	})
+	if c.config.OnProgress != nil {
+		c.config.OnProgress(loaded)
+	}
+	return loaded, err
+}
+
+// Len returns the number of entries held in memory.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Add adds hash to the backend and the cache
+func (c *Cache) Add(hash string) error {
+	return c.AddContext(context.Background(), hash)
+}
+
+// AddContext adds hash to the backend and the cache, using ContextSpender
+// when the backend implements it.
+func (c *Cache) AddContext(ctx context.Context, hash string) error {
+	var err error
+	if cs, ok := c.backend.(ContextSpender); ok {
+		err = cs.AddContext(ctx, hash)
+	} else {
+		err = c.backend.Add(hash)
+	}
+	if err != nil {
+		return err
+	}
+	c.remember(hash)
+	return nil
+}
+
+// AddDate adds hash, for a header created at created, to the backend and
+// the cache, using DateSpender or ContextSpender when the backend implements
+// them.
+func (c *Cache) AddDate(ctx context.Context, hash string, created time.Time) error {
+	if err := add(ctx, c.backend, hash, created); err != nil {
+		return err
+	}
+	c.remember(hash)
+	return nil
+}
+
+// Spent checks if hash is in the cache, or else the backend
+func (c *Cache) Spent(hash string) bool {
+	return c.SpentContext(context.Background(), hash)
+}
+
+// SpentContext checks if hash is in the cache, or else the backend, using
+// ContextSpender when the backend implements it.
+func (c *Cache) SpentContext(ctx context.Context, hash string) bool {
+	if c.cached(hash) {
+		return true
+	}
+	if !spent(ctx, c.backend, hash) {
+		return false
+	}
+	c.remember(hash)
+	return true
+}
+
+// SpentBatch checks which of hashes are in the cache, or else the backend,
+// using BatchSpender when the backend implements it for those missing from
+// memory.
+func (c *Cache) SpentBatch(hashes []string) ([]bool, error) {
+	isSpent := make([]bool, len(hashes))
+	var missing []string
+	var idx []int
+	for i, hash := range hashes {
+		if c.cached(hash) {
+			isSpent[i] = true
+			continue
+		}
+		missing = append(missing, hash)
+		idx = append(idx, i)
+	}
+	if len(missing) == 0 {
+		return isSpent, nil
+	}
+	for j, ok := range spentBatch(context.Background(), c.backend, missing) {
+		if ok {
+			isSpent[idx[j]] = true
+			c.remember(missing[j])
+		}
+	}
+	return isSpent, nil
+}
+
+// CheckAndAdd checks and adds hash in one operation, see CheckAndAddContext.
+func (c *Cache) CheckAndAdd(hash string) (alreadySpent bool, err error) {
+	return c.CheckAndAddContext(context.Background(), hash, time.Time{})
+}
+
+// CheckAndAddContext checks and adds hash, for a header created at created,
+// reporting whether it was already spent. Entries in memory are reported
+// spent without consulting the backend, otherwise the backend's
+// ContextCheckAndAdder or CheckAndAdder is used, so the operation is atomic
+// when the backend's is. Backends implementing neither are checked and added
+// separately, as verification does.
+func (c *Cache) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (alreadySpent bool, err error) {
+	if c.cached(hash) {
+		return true, nil
+	}
+	switch ca := c.backend.(type) {
+	case ContextCheckAndAdder:
+		alreadySpent, err = ca.CheckAndAddContext(ctx, hash, created)
+	case CheckAndAdder:
+		alreadySpent, err = ca.CheckAndAdd(hash)
+	default:
+		if spent(ctx, c.backend, hash) {
+			alreadySpent = true
+		} else {
+			err = add(ctx, c.backend, hash, created)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	c.remember(hash)
+	return alreadySpent, nil
+}
+
+// Lookup looks up hash in the backend, which must implement Admin.
+func (c *Cache) Lookup(hash string) (SpentInfo, bool, error) {
+	admin, ok := c.backend.(Admin)
+	if !ok {
+		return SpentInfo{}, false, ErrNotAdmin
+	}
+	return admin.Lookup(hash)
+}
+
+// Remove removes hash from the backend, which must implement Admin, and
+// evicts it from the cache so it is no longer reported spent.
+func (c *Cache) Remove(hash string) error {
+	admin, ok := c.backend.(Admin)
+	if !ok {
+		return ErrNotAdmin
+	}
+	if err := admin.Remove(hash); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.evict(hash)
+	c.mu.Unlock()
+	return nil
+}
+
+// Recent enumerates entries of the backend, which must implement Lister.
+func (c *Cache) Recent(since time.Time, fn func(SpentInfo) error) error {
+	lister, ok := c.backend.(Lister)
+	if !ok {
+		return ErrNotLister
+	}
+	return lister.Recent(since, fn)
+}
+
+// cached reports whether hash is held in memory.
+func (c *Cache) cached(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[hash]
+	return ok
+}
+
+// remember inserts hash in memory.
+func (c *Cache) remember(hash string) {
+	c.mu.Lock()
+	c.insert(hash)
+	c.mu.Unlock()
+}
+
+// insert adds hash to memory, evicting the oldest entry when full. c.mu must
+// be held.
+func (c *Cache) insert(hash string) {
+	if _, ok := c.entries[hash]; ok {
+		return
+	}
+	if c.config.MaxEntries > 0 && len(c.entries) >= c.config.MaxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[hash] = struct{}{}
+	c.order = append(c.order, hash)
+}
+
+// evict removes hash from memory. c.mu must be held.
+func (c *Cache) evict(hash string) {
+	if _, ok := c.entries[hash]; !ok {
+		return
+	}
+	delete(c.entries, hash)
+	for i, key := range c.order {
+		if key == hash {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package hashcash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Challenge a server challenge: the resource and bits of the stamp a client
+// must mint to be served, when the server stops accepting it, and the
+// counter prefix assigned to the client. It is sent
+// to clients in the format of String, e.g. in the CHALLENGE reply of a
+// sidecar or a packet of a game server.
+type Challenge struct {
+	// Resource the stamp must be minted for.
+	Resource string
+	// Bits the stamp must be minted with.
+	Bits Bits
+	// Expires time from which answers are rejected with ErrChallengeExpired.
+	Expires time.Time
+	// Prefix counter prefix assigned to the client, the random field which
+	// precedes the counter of the stamp, none when empty. Each client is
+	// assigned its own, so answers minted under another are rejected with
+	// ErrCounterPrefix, detecting work shared by colluding clients.
+	Prefix string
+}
+
+// String encodes c as bits:expires:resource[:prefix], expires in Unix
+// seconds.
+func (c Challenge) String() string {
+	s := c.Bits.String() + ":" + strconv.FormatInt(c.Expires.Unix(), 10) + ":" + c.Resource
+	if c.Prefix != "" {
+		s += ":" + c.Prefix
+	}
+	return s
+}
+
+// ParseChallenge parses a challenge in the format of Challenge.String. If s
+// is malformed ErrInvalidChallenge error is returned.
+func ParseChallenge(s string) (Challenge, error) {
+	vals := strings.Split(s, ":")
+	if len(vals) < 3 || len(vals) > 4 || vals[2] == "" {
+		return Challenge{}, ErrInvalidChallenge
+	}
+	var prefix string
+	if len(vals) == 4 {
+		if _, ok := base64DecodeAny(vals[3]); !ok || vals[3] == "" {
+			return Challenge{}, ErrInvalidChallenge
+		}
+		prefix = vals[3]
+	}
+	bits, err := ParseBits(vals[0])
+	if err != nil {
+		return Challenge{}, ErrInvalidChallenge
+	}
+	expires, err := strconv.ParseInt(vals[1], 10, 64)
+	if err != nil {
+		return Challenge{}, ErrInvalidChallenge
+	}
+	return Challenge{Resource: vals[2], Bits: bits, Expires: time.Unix(expires, 0), Prefix: prefix}, nil
+}
+
+// Deadline returns the time by which an answer to c must be minted, margin
+// before it expires, e.g. a round trip to the server.
+func (c Challenge) Deadline(margin time.Duration) time.Time {
+	return c.Expires.Add(-margin)
+}
+
+// NewChallenge issues a challenge for resource, requiring the bits stamps are
+// verified with, expiring ttl from now, with a random counter prefix.
+// Answers are checked with VerifyChallenge.
+func (h *Hashcash) NewChallenge(resource string, ttl time.Duration) (Challenge, error) {
+	prefix, err := randomBytes(bytesToRead)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return Challenge{
+		Resource: resource,
+		Bits:     h.requiredBits(),
+		Expires:  h.now().Add(ttl),
+		Prefix:   base64EncodeBytes(prefix),
+	}, nil
+}
+
+// MintChallenge mints an answer to c under its counter prefix, using config
+// apart from the resource and bits, NewDefaultConfig when nil, without opening storage unless config
+// sets it. The search is given up at c.Deadline(margin), so no work is spent
+// finishing an answer the server would reject as expired; ErrChallengeExpired
+// error is returned then, or at once if the deadline has passed. Otherwise it
+// searches until a solution is found or ctx is done.
+func MintChallenge(ctx context.Context, c Challenge, margin time.Duration, config *Config) (string, error) {
+	if config == nil {
+		config = NewDefaultConfig()
+	}
+	cfg := *config
+	cfg.Bits = c.Bits
+	h, err := newMinter(&Resource{Data: c.Resource}, &cfg)
+	if err != nil {
+		return "", err
+	}
+	if c.Prefix != "" {
+		h.rand = c.Prefix
+	}
+	left := c.Deadline(margin).Sub(h.now())
+	if left <= 0 {
+		return "", ErrChallengeExpired
+	}
+	mintCtx, cancel := context.WithTimeout(ctx, left)
+	defer cancel()
+	header, err := h.ComputeContext(mintCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return "", ErrChallengeExpired
+	}
+	return header, err
+}
+
+// VerifyChallenge verifies header presented by remote in answer to c, as
+// VerifyContext does, after checking c has not expired and header was minted
+// for its resource with at least its bits, under its counter prefix. The instance must accept the
+// resource of c, e.g. with a ValidatorContextFunc.
+func (h *Hashcash) VerifyChallenge(ctx context.Context, c Challenge, header string, remote Remote) (bool, error) {
+	ev := &VerifyEvent{Context: ctx, Instance: h.name, Header: header, Remote: remote}
+	return h.run(ev, func() error {
+		if !h.now().Before(c.Expires) {
+			return ErrChallengeExpired
+		}
+		if err := c.check(h, header); err != nil {
+			return err
+		}
+		return h.verify(header, ev)
+	})
+}
+
+// check checks header was minted for the resource of c with its bits, under
+// its counter prefix. Prefixes are compared decoded, so re-encodings match.
+func (c Challenge) check(h *Hashcash, header string) error {
+	s, err := Parse(header)
+	if err != nil {
+		return err
+	}
+	if s.Resource != c.Resource {
+		return ErrResourceFail
+	}
+	if c.Prefix != "" && !samePrefix(s.Rand, c.Prefix) {
+		return ErrCounterPrefix
+	}
+	if zero := leadingZeroBits(h.digest(header)); zero < int(c.Bits) {
+		return &CollisionError{Bits: zero, Required: c.Bits}
+	}
+	return nil
+}
+
+// samePrefix reports whether the base64 encoded prefixes a and b are equal.
+func samePrefix(a, b string) bool {
+	da, ok := base64DecodeAny(a)
+	if !ok {
+		return false
+	}
+	db, ok := base64DecodeAny(b)
+	return ok && bytes.Equal(da, db)
+}
@@ -0,0 +1,163 @@
+/*
+Package chaos injects faults into hashcash storage and clocks, to test how
+verification behaves when storage is slow or failing, or the clock is skewed
+or jumps.
+
+	storage := chaos.NewStorage(spent, &chaos.Config{
+		Latency:       50 * time.Millisecond,
+		AddErrorRate:  0.1,
+		SpentMissRate: 0.01,
+	})
+	clock := chaos.NewClock(&chaos.ClockConfig{
+		Skew:     time.Minute,
+		JumpRate: 0.01,
+		MaxJump:  time.Hour,
+	})
+	config.Now = clock.Now
+*/
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// ErrInjected error returned by injected failures
+var ErrInjected = errors.New("chaos: injected storage failure")
+
+// Config for fault injection
+type Config struct {
+	// Latency maximum delay added to each operation, the delay is uniformly
+	// distributed between zero and Latency.
+	Latency time.Duration
+	// AddErrorRate fraction of Add calls which fail with ErrInjected without
+	// recording the entry.
+	AddErrorRate float64
+	// SpentMissRate fraction of Spent calls which report an entry as not
+	// spent, as a lagging replica or evicting cache would.
+	SpentMissRate float64
+	// Seed seeds the random source, making runs repeatable.
+	Seed int64
+}
+
+// Stats counts injected faults
+type Stats struct {
+	AddErrors   int
+	SpentMisses int
+	Delayed     time.Duration
+}
+
+// Storage wraps a storage, injecting faults according to its config. It
+// honours context deadlines during injected latency. It is safe for
+// concurrent use if the wrapped storage is.
+type Storage struct {
+	next   hashcash.Storage
+	config Config
+	mu     sync.Mutex
+	rng    *rand.Rand
+	stats  Stats
+}
+
+// NewStorage wraps next, injecting faults according to config. If config is
+// nil no faults are injected.
+func NewStorage(next hashcash.Storage, config *Config) *Storage {
+	if config == nil {
+		config = &Config{}
+	}
+	return &Storage{
+		next:   next,
+		config: *config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// Stats returns counts of faults injected so far.
+func (s *Storage) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Add adds hash to the wrapped storage, unless a failure is injected.
+func (s *Storage) Add(hash string) error {
+	return s.AddContext(context.Background(), hash)
+}
+
+// Spent checks if hash is in the wrapped storage, unless a miss is injected.
+func (s *Storage) Spent(hash string) bool {
+	return s.SpentContext(context.Background(), hash)
+}
+
+// AddContext adds hash to the wrapped storage, unless ctx is done during the
+// injected latency or a failure is injected.
+func (s *Storage) AddContext(ctx context.Context, hash string) error {
+	delay, fail := s.roll(s.config.AddErrorRate)
+	if err := sleep(ctx, delay); err != nil {
+		return err
+	}
+	if fail {
+		s.mu.Lock()
+		s.stats.AddErrors++
+		s.mu.Unlock()
+		return ErrInjected
+	}
+	if cs, ok := s.next.(hashcash.ContextSpender); ok {
+		return cs.AddContext(ctx, hash)
+	}
+	return s.next.Add(hash)
+}
+
+// SpentContext checks if hash is in the wrapped storage, unless ctx is done
+// during the injected latency or a miss is injected.
+func (s *Storage) SpentContext(ctx context.Context, hash string) bool {
+	delay, miss := s.roll(s.config.SpentMissRate)
+	if err := sleep(ctx, delay); err != nil {
+		return false
+	}
+	var spent bool
+	if cs, ok := s.next.(hashcash.ContextSpender); ok {
+		spent = cs.SpentContext(ctx, hash)
+	} else {
+		spent = s.next.Spent(hash)
+	}
+	if spent && miss {
+		s.mu.Lock()
+		s.stats.SpentMisses++
+		s.mu.Unlock()
+		return false
+	}
+	return spent
+}
+
+// roll picks the latency of an operation and whether a fault with
+// probability rate is injected.
+func (s *Storage) roll(rate float64) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var delay time.Duration
+	if s.config.Latency > 0 {
+		delay = time.Duration(s.rng.Int63n(int64(s.config.Latency)))
+		s.stats.Delayed += delay
+	}
+	return delay, s.rng.Float64() < rate
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/chaos"
+)
+
+// mapStorage storage safe for concurrent use
+type mapStorage struct {
+	mu    sync.Mutex
+	spent map[string]bool
+}
+
+func (m *mapStorage) Add(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spent[hash] = true
+	return nil
+}
+
+func (m *mapStorage) Spent(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.spent[hash]
+}
+
+// verifier creates a hashcash instance using storage, and mints n headers.
+func verifier(t *testing.T, storage hashcash.Storage, n int) (*hashcash.Hashcash, []string) {
+	config := &hashcash.Config{
+		Bits:    8,
+		Future:  time.Now().AddDate(0, 0, 2),
+		Expired: time.Now().AddDate(0, 0, -30),
+		Storage: storage,
+	}
+	res := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(string) bool { return true },
+	}
+	var headers []string
+	for i := 0; i < n; i++ {
+		minter, err := hashcash.New(res, config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		h, err := minter.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		headers = append(headers, h)
+	}
+	hc, err := hashcash.New(res, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return hc, headers
+}
+
+// TestAddErrorsFailClosed verification fails when storage fails to record a
+// header, so the header cannot be replayed.
+func TestAddErrorsFailClosed(t *testing.T) {
+	storage := chaos.NewStorage(&mapStorage{spent: make(map[string]bool)}, &chaos.Config{
+		AddErrorRate: 1,
+	})
+	hc, headers := verifier(t, storage, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := hc.Verify(headers[0]); !errors.Is(err, hashcash.ErrStorage) {
+			t.Errorf("attempt %d: %v\n", i, err)
+		}
+	}
+	if storage.Stats().AddErrors != 2 {
+		t.Errorf("%+v\n", storage.Stats())
+	}
+}
+
+// TestSpentMisses replays are only accepted when storage misses an entry.
+func TestSpentMisses(t *testing.T) {
+	storage := chaos.NewStorage(&mapStorage{spent: make(map[string]bool)}, &chaos.Config{
+		SpentMissRate: 0.5,
+		Seed:          1,
+	})
+	hc, headers := verifier(t, storage, 50)
+	for _, h := range headers {
+		if valid, err := hc.Verify(h); !valid {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	replayed := 0
+	for _, h := range headers {
+		if valid, _ := hc.Verify(h); valid {
+			replayed++
+		}
+	}
+	if misses := storage.Stats().SpentMisses; replayed != misses || misses == 0 || misses == len(headers) {
+		t.Errorf("replayed %d misses %d\n", replayed, misses)
+	}
+}
+
+// TestLatencyDeadline slow storage does not hold verification past the
+// caller's deadline.
+func TestLatencyDeadline(t *testing.T) {
+	storage := chaos.NewStorage(&mapStorage{spent: make(map[string]bool)}, &chaos.Config{
+		Latency: time.Second,
+		Seed:    1,
+	})
+	hc, headers := verifier(t, storage, 5)
+	for _, h := range headers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		start := time.Now()
+		hc.VerifyContext(ctx, h, hashcash.Remote{})
+		cancel()
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("verification took %v\n", elapsed)
+		}
+	}
+}
+
+// TestNilConfig nil configs inject no faults.
+func TestNilConfig(t *testing.T) {
+	storage := chaos.NewStorage(&mapStorage{spent: make(map[string]bool)}, nil)
+	hc, headers := verifier(t, storage, 1)
+	if valid, err := hc.Verify(headers[0]); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.Verify(headers[0]); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+	if stats := storage.Stats(); stats != (chaos.Stats{}) {
+		t.Errorf("%+v\n", stats)
+	}
+	clock := chaos.NewClock(nil)
+	if d := time.Since(clock.Now()); d < 0 || d > time.Second {
+		t.Errorf("clock off by %v\n", d)
+	}
+	if stats := clock.Stats(); stats != (chaos.ClockStats{}) {
+		t.Errorf("%+v\n", stats)
+	}
+}
+
+// TestClockJumps headers are checked against the injected clock, so a jump
+// past the expiry window expires them and a jump back makes them future.
+func TestClockJumps(t *testing.T) {
+	clock := chaos.NewClock(&chaos.ClockConfig{})
+	config := &hashcash.Config{
+		Bits:         8,
+		ExpiryWindow: time.Hour,
+		FutureWindow: time.Minute,
+		Now:          clock.Now,
+		Storage:      &mapStorage{spent: make(map[string]bool)},
+	}
+	res := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(string) bool { return true },
+	}
+	minter, err := hashcash.New(res, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	header, err := minter.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hc, err := hashcash.New(res, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	clock.Jump(2 * time.Hour)
+	if _, err := hc.Verify(header); !errors.Is(err, hashcash.ErrExpired) {
+		t.Errorf("after jump forward: %v\n", err)
+	}
+	clock.Jump(-4 * time.Hour)
+	if _, err := hc.Verify(header); !errors.Is(err, hashcash.ErrFutureStamp) {
+		t.Errorf("after jump back: %v\n", err)
+	}
+	clock.Jump(2 * time.Hour)
+	if ok, err := hc.Verify(header); !ok || err != nil {
+		t.Errorf("after jump home: %v %v\n", ok, err)
+	}
+	if stats := clock.Stats(); stats.Jumps != 3 || stats.Offset != 0 {
+		t.Errorf("%+v\n", stats)
+	}
+}
+
+// TestClockRandomJumps random jumps stay within MaxJump of the skew.
+func TestClockRandomJumps(t *testing.T) {
+	clock := chaos.NewClock(&chaos.ClockConfig{
+		Skew:     time.Minute,
+		JumpRate: 0.5,
+		MaxJump:  time.Second,
+		Seed:     1,
+	})
+	for i := 0; i < 100; i++ {
+		clock.Now()
+	}
+	stats := clock.Stats()
+	if stats.Jumps == 0 || stats.Jumps == 100 {
+		t.Errorf("%+v\n", stats)
+	}
+	if d := stats.Offset - time.Minute; d > 100*time.Second || d < -100*time.Second {
+		t.Errorf("%+v\n", stats)
+	}
+}
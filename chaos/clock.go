@@ -0,0 +1,78 @@
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ClockConfig for clock fault injection
+type ClockConfig struct {
+	// Skew constant offset of the clock from the system clock.
+	Skew time.Duration
+	// JumpRate fraction of readings after which the clock jumps, as a clock
+	// stepped by NTP or a suspended virtual machine would.
+	JumpRate float64
+	// MaxJump bound on each jump, jumps are uniformly distributed between
+	// -MaxJump and MaxJump.
+	MaxJump time.Duration
+	// Seed seeds the random source, making runs repeatable.
+	Seed int64
+}
+
+// ClockStats counts injected clock faults
+type ClockStats struct {
+	Jumps  int
+	Offset time.Duration
+}
+
+// Clock a clock offset from the system clock, jumping according to its
+// config. Its Now method is used as hashcash.Config.Now. It is safe for
+// concurrent use.
+type Clock struct {
+	config ClockConfig
+	mu     sync.Mutex
+	rng    *rand.Rand
+	stats  ClockStats
+}
+
+// NewClock creates a clock faulted according to config. If config is nil it
+// tells the system time until jumped with Jump.
+func NewClock(config *ClockConfig) *Clock {
+	if config == nil {
+		config = &ClockConfig{}
+	}
+	return &Clock{
+		config: *config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		stats:  ClockStats{Offset: config.Skew},
+	}
+}
+
+// Now returns the system time plus the clock's offset, then jumps the clock
+// if a jump is injected.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now().Add(c.stats.Offset)
+	if c.config.MaxJump > 0 && c.rng.Float64() < c.config.JumpRate {
+		c.stats.Offset += time.Duration(c.rng.Int63n(2*int64(c.config.MaxJump)+1)) - c.config.MaxJump
+		c.stats.Jumps++
+	}
+	return now
+}
+
+// Jump moves the clock by d, backwards when d is negative.
+func (c *Clock) Jump(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Offset += d
+	c.stats.Jumps++
+}
+
+// Stats returns counts of faults injected so far and the current offset.
+func (c *Clock) Stats() ClockStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
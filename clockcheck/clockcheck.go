@@ -0,0 +1,193 @@
+/*
+Package clockcheck probes NTP servers to measure local clock drift.
+
+Hashcash timestamp validation is only as accurate as the verifier's clock, a
+drifting clock rejects valid headers or accepts expired ones. A verifier can
+run a Checker at startup and periodically, to be warned when drift exceeds a
+threshold:
+
+	checker := clockcheck.New(&clockcheck.Config{
+		Server:    "pool.ntp.org:123",
+		Threshold: time.Minute,
+		OnDrift: func(d clockcheck.Drift) {
+			log.Printf("clock drift %v exceeds %v", d.Offset, d.Threshold)
+		},
+	})
+	go checker.Run(ctx)
+*/
+package clockcheck
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	packetSize = 48         // Size of an NTP packet without extensions
+	clientMode = 0x1B       // LI 0, version 3, mode 3 (client)
+	ntpEpoch   = 2208988800 // Seconds from 1900-01-01 to 1970-01-01
+)
+
+// ErrInvalidResponse error NTP server sent a malformed or unsynchronised
+// response
+var ErrInvalidResponse = errors.New("invalid NTP response")
+
+// Config for a clock checker
+type Config struct {
+	// Server NTP server address, host:port.
+	Server string
+	// Threshold absolute clock offset above which OnDrift is called.
+	Threshold time.Duration
+	// Interval time between checks made by Run.
+	Interval time.Duration
+	// Timeout for a single probe.
+	Timeout time.Duration
+	// OnDrift optional callback invoked when a check finds the clock offset
+	// exceeds Threshold.
+	OnDrift func(Drift)
+	// OnError optional callback invoked when a check fails.
+	OnError func(error)
+}
+
+// DefaultConfig default clock checker configuration
+var DefaultConfig = &Config{
+	Server:    "pool.ntp.org:123",
+	Threshold: time.Minute,
+	Interval:  time.Hour,
+	Timeout:   5 * time.Second,
+}
+
+// Drift describes a clock offset exceeding the threshold.
+type Drift struct {
+	// Server NTP server probed.
+	Server string
+	// Offset amount the local clock is behind the server, negative if the
+	// local clock is ahead.
+	Offset time.Duration
+	// RoundTrip network delay of the probe.
+	RoundTrip time.Duration
+	// Threshold configured threshold.
+	Threshold time.Duration
+}
+
+// Checker periodically checks the local clock against an NTP server.
+type Checker struct {
+	config Config
+}
+
+// New creates a new clock checker. If config is nil DefaultConfig is used,
+// zero Interval and Timeout are taken from DefaultConfig.
+func New(config *Config) *Checker {
+	if config == nil {
+		config = DefaultConfig
+	}
+	c := &Checker{config: *config}
+	if c.config.Interval <= 0 {
+		c.config.Interval = DefaultConfig.Interval
+	}
+	if c.config.Timeout <= 0 {
+		c.config.Timeout = DefaultConfig.Timeout
+	}
+	return c
+}
+
+// Check probes the server once, calling OnDrift if the offset exceeds the
+// threshold.
+func (c *Checker) Check(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	offset, rtt, err := Probe(ctx, c.config.Server)
+	if err != nil {
+		if c.config.OnError != nil {
+			c.config.OnError(err)
+		}
+		return 0, err
+	}
+	if abs(offset) > c.config.Threshold && c.config.OnDrift != nil {
+		c.config.OnDrift(Drift{
+			Server:    c.config.Server,
+			Offset:    offset,
+			RoundTrip: rtt,
+			Threshold: c.config.Threshold,
+		})
+	}
+	return offset, nil
+}
+
+// Run checks the clock immediately and then every Interval, until ctx is
+// done.
+func (c *Checker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe sends a single SNTP request to server and returns the offset of the
+// local clock from the server's and the round trip delay.
+func Probe(ctx context.Context, server string) (offset, rtt time.Duration, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	req := make([]byte, packetSize)
+	req[0] = clientMode
+	t1 := time.Now()
+	putTime(req[40:], t1)
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+	resp := make([]byte, packetSize)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return 0, 0, err
+	}
+	// the originate timestamp must echo our transmit timestamp, stratum 0
+	// is a kiss-o'-death or unsynchronised server.
+	if n < packetSize || resp[1] == 0 || binary.BigEndian.Uint64(resp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return 0, 0, ErrInvalidResponse
+	}
+	t2 := getTime(resp[32:])
+	t3 := getTime(resp[40:])
+	offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+	rtt = t4.Sub(t1) - t3.Sub(t2)
+	return offset, rtt, nil
+}
+
+// putTime writes t in NTP timestamp format to b.
+func putTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpoch)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
+
+// getTime reads an NTP timestamp from b.
+func getTime(b []byte) time.Time {
+	ts := binary.BigEndian.Uint64(b)
+	secs := int64(ts>>32) - ntpEpoch
+	nsec := int64((ts & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nsec)
+}
+
+// abs returns the absolute value of d.
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
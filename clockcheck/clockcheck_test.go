@@ -0,0 +1,76 @@
+package clockcheck_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash/clockcheck"
+)
+
+// ntpServer serves SNTP responses from a clock skew ahead of the local clock.
+func ntpServer(t *testing.T, skew time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		b := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			now := time.Now().Add(skew)
+			ts := uint64(now.Unix()+2208988800)<<32 |
+				uint64(now.Nanosecond())<<32/uint64(time.Second)
+			resp := make([]byte, 48)
+			resp[0] = 0x1C
+			resp[1] = 2
+			copy(resp[24:32], b[40:48])
+			binary.BigEndian.PutUint64(resp[32:], ts)
+			binary.BigEndian.PutUint64(resp[40:], ts)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestCheckDrift(t *testing.T) {
+	var drift *clockcheck.Drift
+	checker := clockcheck.New(&clockcheck.Config{
+		Server:    ntpServer(t, 10*time.Minute),
+		Threshold: time.Minute,
+		Timeout:   time.Second,
+		OnDrift:   func(d clockcheck.Drift) { drift = &d },
+	})
+	offset, err := checker.Check(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if offset < 9*time.Minute || offset > 11*time.Minute {
+		t.Errorf("offset %v\n", offset)
+	}
+	if drift == nil || drift.Offset != offset {
+		t.Errorf("OnDrift not called\n")
+	}
+}
+
+func TestCheckNoDrift(t *testing.T) {
+	called := false
+	checker := clockcheck.New(&clockcheck.Config{
+		Server:    ntpServer(t, 0),
+		Threshold: time.Minute,
+		Timeout:   time.Second,
+		OnDrift:   func(clockcheck.Drift) { called = true },
+	})
+	if _, err := checker.Check(context.Background()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if called {
+		t.Errorf("OnDrift called\n")
+	}
+}
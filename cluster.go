@@ -0,0 +1,88 @@
+package hashcash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Leaser is optionally implemented by Storage shared by several verifiers,
+// holding named leases so one of them is elected to run maintenance jobs,
+// see Elected.
+type Leaser interface {
+	// AcquireLease acquires lease name for holder for ttl, or renews it if
+	// holder already holds it, reporting whether holder holds the lease.
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease releases lease name if holder holds it.
+	ReleaseLease(name, holder string) error
+}
+
+// LeaseConfig for an elected job
+type LeaseConfig struct {
+	// Name of the lease, shared by the instances competing for the job,
+	// e.g. "purge".
+	Name string
+	// Holder identifies the instance, the host name and process id when
+	// empty.
+	Holder string
+	// TTL how long the lease is held without being renewed, 30 seconds when
+	// zero. The lease is renewed every third of TTL.
+	TTL time.Duration
+	// OnChange optional callback invoked when the instance gains or loses
+	// the lease.
+	OnChange func(leader bool)
+}
+
+// Elected returns a Component running job only while it holds a lease in
+// leaser, so when several verifiers share storage only one of them runs
+// purges, compaction or policy refreshes. The job is started when the lease
+// is acquired and closed when a renewal fails, so the job of a former
+// leader may overlap its successor's by up to a third of TTL. The lease is
+// released when the component is closed.
+func Elected(leaser Leaser, config *LeaseConfig, job Component) Component {
+	c := *config
+	if c.TTL <= 0 {
+		c.TTL = 30 * time.Second
+	}
+	if c.Holder == "" {
+		host, _ := os.Hostname()
+		c.Holder = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return RunFunc(func(ctx context.Context) error {
+		var (
+			leader bool
+			ticker = time.NewTicker(c.TTL / 3)
+		)
+		defer ticker.Stop()
+		change := func(l bool) error {
+			leader = l
+			if c.OnChange != nil {
+				c.OnChange(l)
+			}
+			if l {
+				return job.Start(ctx)
+			}
+			return job.Close()
+		}
+		for {
+			held, err := leaser.AcquireLease(c.Name, c.Holder, c.TTL)
+			if held != leader {
+				// a failed renewal is treated as losing the lease
+				if err := change(held && err == nil); err != nil {
+					leaser.ReleaseLease(c.Name, c.Holder)
+					return err
+				}
+			}
+			select {
+			case <-ctx.Done():
+				if leader {
+					job.Close()
+					leaser.ReleaseLease(c.Name, c.Holder)
+				}
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	})
+}
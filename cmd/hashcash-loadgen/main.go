@@ -0,0 +1,242 @@
+// Command hashcash-loadgen sends a mix of valid, expired, spent and malformed
+// hashcash headers to a verifier endpoint at a fixed rate and reports the
+// acceptance rate and latency of each kind of header.
+//
+// Usage:
+//
+//	hashcash-loadgen -url http://localhost:8080/ -rate 50 -duration 30s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// expiredHeader a well formed header with a valid collision, minted in 2004.
+const expiredHeader = "1:20:040806:foo::65f460d0726f420d:13a6b8"
+
+// kinds of headers sent to the verifier
+const (
+	kindValid     = "valid"
+	kindExpired   = "expired"
+	kindSpent     = "spent"
+	kindMalformed = "malformed"
+)
+
+// nopStorage storage which never records spent headers, loadgen only mints.
+type nopStorage struct{}
+
+func (nopStorage) Add(string) error  { return nil }
+func (nopStorage) Spent(string) bool { return false }
+
+// result of a single request
+type result struct {
+	kind     string
+	accepted bool
+	failed   bool
+	latency  time.Duration
+}
+
+// generator mints headers of each kind
+type generator struct {
+	resource string
+	config   *hashcash.Config
+	mu       sync.Mutex
+	sent     []string
+}
+
+// header creates a header of the given kind.
+func (g *generator) header(kind string) (string, error) {
+	switch kind {
+	case kindExpired:
+		return expiredHeader, nil
+	case kindMalformed:
+		b := make([]byte, 1+rand.Intn(64))
+		for i := range b {
+			b[i] = byte(' ' + rand.Intn(95))
+		}
+		return string(b), nil
+	case kindSpent:
+		g.mu.Lock()
+		n := len(g.sent)
+		var h string
+		if n > 0 {
+			h = g.sent[rand.Intn(n)]
+		}
+		g.mu.Unlock()
+		if h != "" {
+			return h, nil
+		}
+	}
+	hc, err := hashcash.New(&hashcash.Resource{Data: g.resource}, g.config)
+	if err != nil {
+		return "", err
+	}
+	h, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	g.sent = append(g.sent, h)
+	g.mu.Unlock()
+	return h, nil
+}
+
+// pick chooses a kind of header according to the weights.
+func pick(weights map[string]float64) string {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	r := rand.Float64() * total
+	for _, kind := range []string{kindValid, kindExpired, kindSpent, kindMalformed} {
+		r -= weights[kind]
+		if r < 0 {
+			return kind
+		}
+	}
+	return kindValid
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// report prints acceptance and latency statistics per kind of header.
+func report(results []result) {
+	byKind := make(map[string][]result)
+	for _, r := range results {
+		byKind[r.kind] = append(byKind[r.kind], r)
+	}
+	fmt.Printf("%-10s %8s %9s %7s %10s %10s %10s %10s\n",
+		"kind", "requests", "accepted", "errors", "p50", "p90", "p99", "max")
+	for _, kind := range []string{kindValid, kindExpired, kindSpent, kindMalformed} {
+		rs := byKind[kind]
+		if len(rs) == 0 {
+			continue
+		}
+		var (
+			accepted, failed int
+			latencies        []time.Duration
+		)
+		for _, r := range rs {
+			if r.failed {
+				failed++
+				continue
+			}
+			if r.accepted {
+				accepted++
+			}
+			latencies = append(latencies, r.latency)
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Printf("%-10s %8d %9d %7d %10v %10v %10v %10v\n",
+			kind, len(rs), accepted, failed,
+			percentile(latencies, 0.50),
+			percentile(latencies, 0.90),
+			percentile(latencies, 0.99),
+			percentile(latencies, 1))
+	}
+}
+
+func main() {
+	var (
+		url       = flag.String("url", "", "verifier endpoint to send headers to")
+		method    = flag.String("method", http.MethodGet, "HTTP method")
+		name      = flag.String("header", "X-Hashcash", "HTTP header carrying the hashcash header")
+		resource  = flag.String("resource", "someone@example.com", "resource headers are minted for")
+		bits      = flag.Int("bits", 16, "bits used to mint valid headers")
+		rate      = flag.Int("rate", 10, "requests per second, at most 1e9")
+		duration  = flag.Duration("duration", 10*time.Second, "how long to send requests for")
+		workers   = flag.Int("workers", 16, "maximum concurrent requests")
+		valid     = flag.Float64("valid", 0.7, "weight of valid headers")
+		expired   = flag.Float64("expired", 0.1, "weight of expired headers")
+		spent     = flag.Float64("spent", 0.1, "weight of previously sent headers")
+		malformed = flag.Float64("malformed", 0.1, "weight of malformed headers")
+	)
+	flag.Parse()
+	// rates above one request a nanosecond leave the ticker no interval
+	if *url == "" || *rate <= 0 || *rate > int(time.Second) || *workers <= 0 || *bits < 0 || *bits > 64 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var (
+		weights = map[string]float64{
+			kindValid:     *valid,
+			kindExpired:   *expired,
+			kindSpent:     *spent,
+			kindMalformed: *malformed,
+		}
+		gen = &generator{
+			resource: *resource,
+			config: &hashcash.Config{
+				Bits:    hashcash.Bits(*bits),
+				Storage: nopStorage{},
+			},
+		}
+		client  = &http.Client{Timeout: 10 * time.Second}
+		sem     = make(chan struct{}, *workers)
+		mu      sync.Mutex
+		results []result
+		wg      sync.WaitGroup
+	)
+	ticker := time.NewTicker(time.Second / time.Duration(*rate))
+	defer ticker.Stop()
+	deadline := time.After(*duration)
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r := result{kind: pick(weights)}
+			h, err := gen.header(r.kind)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			req, err := http.NewRequest(*method, *url, nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			req.Header.Set(*name, h)
+			start := time.Now()
+			resp, err := client.Do(req)
+			r.latency = time.Since(start)
+			if err != nil {
+				r.failed = true
+			} else {
+				resp.Body.Close()
+				r.accepted = resp.StatusCode >= 200 && resp.StatusCode < 300
+			}
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	report(results)
+}
@@ -0,0 +1,338 @@
+// Command hashcash runs hashcash utilities.
+//
+// Usage:
+//
+//	hashcash mint [-b bits] [-hash sha1|sha256] resource...
+//	hashcash check [-b bits] [-r resource] [-e days] [-d spent.log] [-q] [-hash sha1|sha256] [stamp...]
+//	hashcash bench [-json] [-duration 1s] [-workers n] [-hash sha1|sha256]
+//	hashcash lookup [-d spent.log] [-hash sha1|sha256] <stamp|key>
+//	hashcash remove [-d spent.log] [-hash sha1|sha256] <stamp|key>
+//	hashcash version
+//
+// mint prints a stamp for each resource, one per line.
+//
+// check verifies each stamp, read one per line from standard input if none
+// are given, printing its verdict unless -q is set. It exits with status 1 if
+// any stamp is invalid, so it can be used from shell scripts and procmail
+// recipes. With -r only stamps for resource are accepted, and with -d spent
+// stamps are recorded in a log so double spending is detected across runs.
+//
+// bench measures the hash rate and verify throughput of the machine and the
+// expected time to mint headers of 16 to 32 bits. With -json the report is
+// printed as JSON, e.g. to be collected across a fleet.
+//
+// lookup and remove inspect and correct an entry in spent storage, e.g. to
+// investigate a stamp a client reports was wrongly rejected as spent. Stamps
+// are converted to the key they are recorded under, with the algorithm set
+// by -hash, which must match that of the verifiers. With -d the log is
+// opened in shared mode, so it can be corrected while verifiers write to it,
+// otherwise the sqlite3 database ~/.hashcash/spent.db is used.
+//
+// version prints the library version and the stamp format versions it mints
+// and verifies, e.g. to check the members of a fleet can interoperate.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	_ "crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/sqlite3"
+)
+
+// hashes algorithms selectable with -hash
+var hashes = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+}
+
+// usage prints command usage
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: hashcash mint [-b bits] [-hash sha1|sha256] resource...
+       hashcash check [-b bits] [-r resource] [-e days] [-d spent.log] [-q] [-hash sha1|sha256] [stamp...]
+       hashcash bench [-json] [-duration d] [-workers n] [-hash sha1|sha256]
+       hashcash lookup|remove [-d spent.log] [-hash sha1|sha256] <stamp|key>
+       hashcash version`)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// hashFlag returns the algorithm named name.
+func hashFlag(name string) (crypto.Hash, error) {
+	hash, ok := hashes[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown hash algorithm %q", name)
+	}
+	return hash, nil
+}
+
+// mint runs the mint command with args.
+func mint(args []string) error {
+	fs := flag.NewFlagSet("mint", flag.ExitOnError)
+	var (
+		bits     = fs.Uint("b", 20, "bits of the stamps")
+		hashName = fs.String("hash", "sha1", "hash algorithm, sha1 or sha256")
+	)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	hash, err := hashFlag(*hashName)
+	if err != nil {
+		return err
+	}
+	if *bits > 64 {
+		return hashcash.ErrInvalidBits
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	config := hashcash.NewDefaultConfig()
+	config.Bits = hashcash.Bits(*bits)
+	config.Hash = hash
+	for _, resource := range fs.Args() {
+		hc, err := hashcash.New(&hashcash.Resource{Data: resource}, config)
+		if err != nil {
+			return err
+		}
+		stamp, err := hc.ComputeContext(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(stamp)
+	}
+	return nil
+}
+
+// check runs the check command with args, reporting whether every stamp is
+// valid.
+func check(args []string) (bool, error) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var (
+		bits     = fs.Uint("b", 20, "bits required")
+		resource = fs.String("r", "", "resource stamps must be minted for, any when empty")
+		days     = fs.Int("e", 28, "days after which stamps expire")
+		spent    = fs.String("d", "", "log of spent stamps, none when empty")
+		quiet    = fs.Bool("q", false, "print nothing, only set the exit status")
+		hashName = fs.String("hash", "sha1", "hash algorithm, sha1 or sha256")
+	)
+	fs.Parse(args)
+	hash, err := hashFlag(*hashName)
+	if err != nil {
+		return false, err
+	}
+	if *bits > 64 {
+		return false, hashcash.ErrInvalidBits
+	}
+	config := hashcash.NewDefaultConfig()
+	config.Bits = hashcash.Bits(*bits)
+	config.Hash = hash
+	config.ExpiryWindow = time.Duration(*days) * 24 * time.Hour
+	if *spent != "" {
+		storage, err := hashcash.NewFileStorage(*spent, nil)
+		if err != nil {
+			return false, err
+		}
+		defer storage.Close()
+		config.Storage = storage
+	}
+	res := &hashcash.Resource{ValidatorFunc: func(string) bool { return true }}
+	if *resource != "" {
+		res = &hashcash.Resource{Accept: []string{*resource}}
+	}
+	hc, err := hashcash.New(res, config)
+	if err != nil {
+		return false, err
+	}
+	stamps := fs.Args()
+	if len(stamps) == 0 {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				stamps = append(stamps, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return false, err
+		}
+	}
+	valid := len(stamps) > 0
+	for _, stamp := range stamps {
+		_, err := hc.Verify(stamp)
+		if err != nil {
+			valid = false
+		}
+		if *quiet {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%s: %s: %v\n", stamp, hashcash.ReasonOf(err), err)
+		} else {
+			fmt.Printf("%s: ok\n", stamp)
+		}
+	}
+	return valid, nil
+}
+
+// bench runs the bench command with args.
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var (
+		asJSON   = fs.Bool("json", false, "print the report as JSON")
+		duration = fs.Duration("duration", time.Second, "duration of each measurement")
+		workers  = fs.Int("workers", 0, "goroutines minting in parallel, GOMAXPROCS when 0")
+		hashName = fs.String("hash", "sha1", "hash algorithm, sha1 or sha256")
+	)
+	fs.Parse(args)
+	hash, err := hashFlag(*hashName)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := hashcash.Benchmark(ctx, &hashcash.BenchmarkConfig{
+		Duration: *duration,
+		Hash:     hash,
+		Workers:  *workers,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Printf("%s %s/%s, %d cpus, %s\n", report.Hash, report.GOOS, report.GOARCH, report.NumCPU, report.GoVersion)
+	fmt.Printf("hash rate:   %.0f/s (1 core), %.0f/s (%d workers)\n", report.HashRate, report.ParallelHashRate, report.Workers)
+	fmt.Printf("verify rate: %.0f/s\n\n", report.VerifyRate)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "bits\t1 core\tworkers")
+	for _, s := range report.SolveTimes {
+		fmt.Fprintf(w, "%d\t%v\t%v\n", s.Bits, seconds(s.Seconds), seconds(s.ParallelSeconds))
+	}
+	return w.Flush()
+}
+
+// seconds returns s seconds as a rounded duration.
+func seconds(s float64) time.Duration {
+	d := time.Duration(s * float64(time.Second))
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond)
+	case d < time.Second:
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second / 10)
+}
+
+// admin runs the lookup or remove command with args.
+func admin(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	spent := fs.String("d", "", "log of spent stamps, the sqlite3 database ~/.hashcash/spent.db when empty")
+	hashName := fs.String("hash", "sha1", "hash algorithm stamps are keyed with, sha1 or sha256")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	key := fs.Arg(0)
+	if strings.Contains(key, ":") {
+		hash, err := hashFlag(*hashName)
+		if err != nil {
+			return err
+		}
+		config := hashcash.NewDefaultConfig()
+		config.Hash = hash
+		hc, err := hashcash.New(&hashcash.Resource{ValidatorFunc: func(string) bool { return true }}, config)
+		if err != nil {
+			return err
+		}
+		if key, err = hc.SpentKey(key); err != nil {
+			return err
+		}
+	}
+	var storage hashcash.Admin
+	if *spent != "" {
+		// shared, so records of running verifiers are read first and not
+		// overwritten.
+		f, err := hashcash.NewFileStorage(*spent, &hashcash.FileConfig{Shared: true})
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		storage = f
+	} else {
+		db, err := sqlite3.OpenDefault()
+		if err != nil {
+			return err
+		}
+		storage = db
+	}
+	if cmd == "remove" {
+		if err := storage.Remove(key); err != nil {
+			return err
+		}
+		fmt.Printf("%s removed\n", key)
+		return nil
+	}
+	info, ok, err := storage.Lookup(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Printf("%s not spent\n", key)
+		os.Exit(1)
+	}
+	fmt.Printf("%s spent at %s\n", info.Key, info.Added.Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "mint":
+		if err := mint(flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+	case "check":
+		valid, err := check(flag.Args()[1:])
+		if err != nil {
+			fatal(err)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+	case "bench":
+		if err := bench(flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+	case "lookup", "remove":
+		if err := admin(flag.Arg(0), flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+	case "version":
+		fmt.Printf("hashcash %s, stamp versions %s\n", hashcash.Version(), hashcash.FormatStampVersions(hashcash.StampVersions()))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
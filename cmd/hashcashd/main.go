@@ -0,0 +1,108 @@
+// Command hashcashd is a verifier sidecar serving the sidecar protocol on a
+// Unix domain socket, so local processes in any language can verify stamps
+// without network exposure.
+//
+// Usage:
+//
+//	hashcashd -socket /run/hashcash.sock -resource someone@gmail.com,postmaster@gmail.com
+//
+// Stamps must be minted for one of the comma separated resources. Spent
+// stamps are recorded in the file log set with -file, or the default sqlite3
+// database.
+//
+//	$ printf 'CHALLENGE\nVERIFY 1:20:040806:foo::65f460d0726f420d:13a6b8\n' | nc -U /run/hashcash.sock
+//	OK 20
+//	ERR expired time stamp is too far into the future or expired: expired
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/sidecar"
+	"github.com/umahmood/hashcash/storage/sqlite3"
+)
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// listen listens on the Unix socket at path, removing a stale socket left by
+// an unclean shutdown.
+func listen(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: already in use", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func main() {
+	var (
+		socket   = flag.String("socket", "/run/hashcash.sock", "Unix socket path")
+		mode     = flag.Uint("mode", 0660, "Unix socket permissions")
+		resource = flag.String("resource", "", "comma separated resources stamps are accepted for")
+		bits     = flag.Uint("bits", 20, "collision size stamps must be minted with")
+		expiry   = flag.Duration("expiry", 28*24*time.Hour, "age after which stamps are expired")
+		future   = flag.Duration("future", 48*time.Hour, "tolerance for stamps created in the future")
+		file     = flag.String("file", "", "file storage log, default sqlite3 database when empty")
+	)
+	flag.Parse()
+	if *resource == "" {
+		fatal(errors.New("hashcashd: -resource is required"))
+	}
+	accept := strings.Split(*resource, ",")
+	config := &hashcash.Config{
+		Bits:         hashcash.Bits(*bits),
+		ExpiryWindow: *expiry,
+		FutureWindow: *future,
+		Name:         "hashcashd",
+	}
+	var err error
+	if *file != "" {
+		config.Storage, err = hashcash.NewFileStorage(*file, nil)
+	} else {
+		config.Storage, err = sqlite3.OpenDefault()
+	}
+	if err != nil {
+		fatal(err)
+	}
+	hc, err := hashcash.New(&hashcash.Resource{Data: accept[0], Accept: accept}, config)
+	if err != nil {
+		fatal(err)
+	}
+	ln, err := listen(*socket, os.FileMode(*mode))
+	if err != nil {
+		fatal(err)
+	}
+	srv := sidecar.NewServer(&sidecar.Config{Verifier: hc, Bits: config.Bits})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); err != sidecar.ErrClosed {
+		fatal(err)
+	}
+}
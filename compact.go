@@ -0,0 +1,135 @@
+package hashcash
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// CompactSize size in bytes of a compact stamp
+const CompactSize = 38
+
+const (
+	compactVersion      = 1  // Format version of compact stamps
+	compactResourceSize = 16 // Bytes of the resource digest in a compact stamp
+)
+
+// compact stamp field offsets, the layout is:
+//
+//	[version u8][bits u8][created u32][resource 16][rand 8][counter u64]
+//
+// integers are big endian, created is in seconds since the unix epoch and
+// resource holds the leading bytes of the sha256 digest of the resource.
+const (
+	compactBits     = 1
+	compactCreated  = 2
+	compactResource = 6
+	compactRand     = compactResource + compactResourceSize
+	compactCounter  = compactRand + 8
+)
+
+// compactDigest returns the digest of resource carried by compact stamps.
+func compactDigest(resource string) []byte {
+	sum := sha256.Sum256([]byte(resource))
+	return sum[:compactResourceSize]
+}
+
+// createCompact creates a compact stamp with the fields of the instance.
+func (h *Hashcash) createCompact() []byte {
+	stamp := make([]byte, CompactSize)
+	stamp[0] = compactVersion
+	stamp[compactBits] = byte(h.bits)
+	binary.BigEndian.PutUint32(stamp[compactCreated:], uint32(h.created.Unix()))
+	copy(stamp[compactResource:], compactDigest(h.resource))
+	rand, _ := base64DecodeAny(h.rand)
+	copy(stamp[compactRand:compactCounter], rand)
+	binary.BigEndian.PutUint64(stamp[compactCounter:], h.counter)
+	return stamp
+}
+
+// ComputeCompact computes a new stamp in the fixed-layout binary encoding, of
+// CompactSize bytes, for protocols such as UDP which cannot afford text
+// parsing or large packets. The resource is carried as a digest. If no
+// solution can be found within 2^20 iterations 'ErrSolutionFail' error is
+// returned, ComputeCompact can be called again to continue the search where
+// it left off.
+func (h *Hashcash) ComputeCompact() ([]byte, error) {
+	var (
+		limit = h.counter + maxIterations
+		stamp = h.createCompact()
+	)
+	for {
+		if acceptableHeader(h.digest(string(stamp)), h.bits) {
+			return stamp, nil
+		}
+		h.counter++
+		if h.counter >= limit {
+			return nil, ErrSolutionFail
+		}
+		binary.BigEndian.PutUint64(stamp[compactCounter:], h.counter)
+	}
+}
+
+// VerifyCompact verifies a compact stamp computed by ComputeCompact. If the
+// stamp is not in a valid format, ErrInvalidHeader error is returned.
+func (h *Hashcash) VerifyCompact(stamp []byte) (bool, error) {
+	return h.VerifyCompactContext(context.Background(), stamp, Remote{})
+}
+
+// VerifyCompactContext verifies a compact stamp presented by remote as
+// VerifyContext does for text headers, VerifyEvent.Header holds the hex
+// encoded stamp. As the stamp carries a digest of its resource, the digest is
+// compared with that of Resource.Data and resource validator functions are
+// not called. Verification stops at the first failed check.
+func (h *Hashcash) VerifyCompactContext(ctx context.Context, stamp []byte, remote Remote) (bool, error) {
+	ev := &VerifyEvent{Context: ctx, Instance: h.name, Header: hex.EncodeToString(stamp), Remote: remote}
+	return h.run(ev, func() error { return h.verifyCompact(stamp, ev) })
+}
+
+// verifyCompact runs the hashcash checks against a compact stamp, recording
+// its fields in ev.
+func (h *Hashcash) verifyCompact(stamp []byte, ev *VerifyEvent) error {
+	t := time.Now()
+	if len(stamp) != CompactSize || stamp[0] != compactVersion {
+		ev.ParseTime = time.Since(t)
+		return ErrInvalidHeader
+	}
+	ev.Bits = Bits(stamp[compactBits])
+	ev.Created = time.Unix(int64(binary.BigEndian.Uint32(stamp[compactCreated:])), 0)
+	ev.Resource = hex.EncodeToString(stamp[compactResource:compactRand])
+	ev.ParseTime = time.Since(t)
+	if err := ev.Bits.Validate(); err != nil {
+		return err
+	}
+	// test 1 - zero count
+	t = time.Now()
+	sum := h.digest(string(stamp))
+	required := h.requiredBits()
+	ok := acceptableHeader(sum, required)
+	ev.HashTime = time.Since(t)
+	if !ok {
+		return &CollisionError{Bits: leadingZeroBits(sum), Required: required}
+	}
+	if err := h.checkExcess(sum, ev); err != nil {
+		return err
+	}
+	// test 2 - check stamp is not too far in the future or expired
+	if err := h.checkTime(ev.Created, ev); err != nil {
+		return err
+	}
+	// test 3 - check resource is valid
+	if subtle.ConstantTimeCompare(stamp[compactResource:compactRand], compactDigest(h.resource)) != 1 {
+		return ErrResourceFail
+	}
+	if err := ev.Context.Err(); err != nil {
+		return err
+	}
+	// test 4 - check if hash is in spent storage
+	t = time.Now()
+	defer func() { ev.StorageTime = time.Since(t) }()
+	key := ev.Hash
+	return h.claim(ev, key)
+}
@@ -0,0 +1,101 @@
+/*
+Package conformance ships a corpus of stamps with their expected verdicts, so
+integrators wrapping the library, or implementing hashcash in another
+language, can run the same acceptance matrix against their code.
+
+The corpus holds stamps of every date format, bits from 0 to 20, SHA-1 and
+SHA-256 stamps, and adversarial stamps: tampered, expired, future,
+malformed, of unsupported versions, for other resources and replayed. Each
+is verified at Epoch with the configuration returned by Case.Config, in
+corpus order against one spent storage:
+
+	storage := hashcash.NewMemoryStorage(nil)
+	for _, c := range conformance.Corpus() {
+		hc, _ := hashcash.New(&hashcash.Resource{Accept: []string{c.Resource}}, c.Config(storage))
+		_, err := hc.Verify(c.Stamp)
+		if hashcash.ReasonOf(err).String() != c.Reason {
+			...
+		}
+	}
+
+Malformed stamps are minted with the required bits where their format
+allows, so most stamps are rejected for one reason only. Otherwise the
+reason is that of the first check failing, in the order the library runs
+them: format, version, zero bits, fields, date, resource and spent.
+*/
+package conformance
+
+//go:generate go run gen.go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // registers SHA-256 for Case.Hash
+	_ "embed"
+	"encoding/json"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// Epoch time the corpus is verified at. Stamps are accepted if created
+// within 28 days before and 48 hours after it.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//go:embed corpus.jsonl
+var corpus []byte
+
+// Case stamp of the corpus with its expected verdict
+type Case struct {
+	// Name category of the case and its position in the corpus, e.g.
+	// "expired-161".
+	Name string `json:"name"`
+	// Stamp stamp verified.
+	Stamp string `json:"stamp"`
+	// Resource only resource accepted.
+	Resource string `json:"resource"`
+	// Bits bits required.
+	Bits hashcash.Bits `json:"bits"`
+	// Hash algorithm stamps are verified with, "sha1" or "sha256".
+	Hash string `json:"hash"`
+	// Reason name of the hashcash.Reason the stamp is rejected for, "none"
+	// if it is valid.
+	Reason string `json:"reason"`
+}
+
+// Valid reports whether the stamp of c must be accepted.
+func (c Case) Valid() bool {
+	return c.Reason == hashcash.ReasonNone.String()
+}
+
+// Config returns the configuration c is verified with, recording spent
+// stamps in storage.
+func (c Case) Config(storage hashcash.Storage) *hashcash.Config {
+	config := &hashcash.Config{
+		Bits:    c.Bits,
+		Future:  Epoch.Add(48 * time.Hour),
+		Expired: Epoch.AddDate(0, 0, -28),
+		Storage: storage,
+	}
+	if c.Hash == "sha256" {
+		config.Hash = crypto.SHA256
+	}
+	return config
+}
+
+// Corpus returns the cases of the corpus, in the order they must be
+// verified.
+func Corpus() []Case {
+	var cases []Case
+	s := bufio.NewScanner(bytes.NewReader(corpus))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var c Case
+		if err := json.Unmarshal(s.Bytes(), &c); err != nil {
+			panic("conformance: corrupt corpus: " + err.Error())
+		}
+		cases = append(cases, c)
+	}
+	return cases
+}
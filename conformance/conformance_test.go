@@ -0,0 +1,39 @@
+package conformance_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/conformance"
+)
+
+func TestCorpus(t *testing.T) {
+	cases := conformance.Corpus()
+	if len(cases) < 250 {
+		t.Fatalf("%d cases\n", len(cases))
+	}
+	var (
+		storage = hashcash.NewMemoryStorage(nil)
+		seen    = make(map[string]bool)
+	)
+	for _, c := range cases {
+		hc, err := hashcash.New(&hashcash.Resource{Accept: []string{c.Resource}}, c.Config(storage))
+		if err != nil {
+			t.Fatalf("%s: %v\n", c.Name, err)
+		}
+		_, err = hc.Verify(c.Stamp)
+		if got := hashcash.ReasonOf(err).String(); got != c.Reason {
+			t.Errorf("%s %q: got %s, want %s: %v\n", c.Name, c.Stamp, got, c.Reason, err)
+		}
+		seen[strings.SplitN(c.Name, "-", 2)[0]] = true
+		if c.Valid() != (err == nil) {
+			t.Errorf("%s: valid %v: %v\n", c.Name, c.Valid(), err)
+		}
+	}
+	for _, category := range []string{"valid", "sha256", "collision", "expired", "future", "resource", "version", "malformed", "replay"} {
+		if !seen[category] {
+			t.Errorf("no %s cases\n", category)
+		}
+	}
+}
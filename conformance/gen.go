@@ -0,0 +1,289 @@
+//go:build ignore
+
+// gen writes corpus.jsonl. Stamps are minted here with a search of its own,
+// independent of the library, from a seeded source so the corpus is
+// reproducible.
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"math/bits"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/conformance"
+)
+
+var (
+	rng   = rand.New(rand.NewSource(1))
+	cases []conformance.Case
+)
+
+// date formats of stamps
+var formats = []string{"060102", "0601021504", "060102150405"}
+
+var resources = []string{
+	"someone@gmail.com",
+	"alice@example.org",
+	"bob+tag@example.co.uk",
+	"user_name@sub.domain.example",
+	"192.0.2.1",
+	"example.com",
+	"api.example.com/v1/comments",
+	"xn--bcher-kva.example",
+	"%3A%3A1/login",
+	"a",
+	"ünïcödé@example.com",
+	strings.Repeat("r", 255),
+}
+
+// date formats t in the 12 digit format.
+func date(t time.Time) string { return t.UTC().Format(formats[2]) }
+
+// randField returns random characters as minted by the library.
+func randField() string {
+	b := make([]byte, 8)
+	rng.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// zeroBits returns the leading zero bits of digest.
+func zeroBits(digest []byte) int {
+	n := 0
+	for _, b := range digest {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// newHash returns the hash named name.
+func newHash(name string) hash.Hash {
+	if name == "sha256" {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+// zeros returns the leading zero bits of the digest of stamp.
+func zeros(stamp, hashName string) int {
+	h := newHash(hashName)
+	h.Write([]byte(stamp))
+	return zeroBits(h.Sum(nil))
+}
+
+// mint searches for a counter appended to prefix giving at least min and,
+// if max is not negative, at most max leading zero bits.
+func mint(prefix, hashName string, min, max int) string {
+	start := rng.Uint64() >> 16
+	for c := start; ; c++ {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], c)
+		i := 0
+		for i < 7 && b[i] == 0 {
+			i++
+		}
+		stamp := prefix + base64.StdEncoding.EncodeToString(b[i:])
+		if n := zeros(stamp, hashName); n >= min && (max < 0 || n <= max) {
+			return stamp
+		}
+	}
+}
+
+// stamp mints a stamp of claimed bits with at least min zero bits.
+func stamp(claim int, date, resource, ext, hashName string, min int) string {
+	return mint(fmt.Sprintf("1:%d:%s:%s:%s:%s:", claim, date, resource, ext, randField()), hashName, min, -1)
+}
+
+func add(name, stamp, resource string, required int, hashName, reason string) {
+	cases = append(cases, conformance.Case{
+		Name:     fmt.Sprintf("%s-%03d", name, len(cases)+1),
+		Stamp:    stamp,
+		Resource: resource,
+		Bits:     hashcash.Bits(required),
+		Hash:     hashName,
+		Reason:   reason,
+	})
+}
+
+func main() {
+	created := conformance.Epoch.Add(-time.Hour)
+	var valid []conformance.Case
+	// stamps in every date format, for a variety of resources
+	for _, r := range resources {
+		for _, f := range formats {
+			for _, b := range []int{8, 12} {
+				add("valid", stamp(b, created.Format(f), r, "", "sha1", b), r, b, "sha1", "none")
+				valid = append(valid, cases[len(cases)-1])
+			}
+		}
+	}
+	// a sweep of bits
+	for b := 0; b <= 20; b++ {
+		add("bits", stamp(b, date(created), "someone@gmail.com", "", "sha1", b), "someone@gmail.com", b, "sha1", "none")
+	}
+	// dates across the window
+	for _, d := range []time.Duration{0, -time.Minute, -24 * time.Hour, -27 * 24 * time.Hour, time.Hour, 47 * time.Hour} {
+		add("window", stamp(8, date(conformance.Epoch.Add(d)), "alice@example.org", "", "sha1", 8), "alice@example.org", 8, "sha1", "none")
+	}
+	// extensions, ignored in version 1
+	for _, ext := range []string{"a", "name=value", "a;b=c,d", "x-ext=1;y=2,3", "noise=" + strings.Repeat("z", 64), "=", ";;", "a=b=c"} {
+		add("extension", stamp(8, date(created), "someone@gmail.com", ext, "sha1", 8), "someone@gmail.com", 8, "sha1", "none")
+	}
+	// more work than required, claimed or not
+	for _, claim := range []int{8, 16} {
+		for i := 0; i < 4; i++ {
+			add("overwork", stamp(claim, date(created), "alice@example.org", "", "sha1", 16), "alice@example.org", 8, "sha1", "none")
+		}
+	}
+	// SHA-256
+	for i, r := range resources[:10] {
+		b := 8 + i%3*2
+		add("sha256", stamp(b, date(created), r, "", "sha256", b), r, b, "sha256", "none")
+	}
+	for b := 0; b <= 16; b++ {
+		add("sha256", stamp(b, date(created), "alice@example.org", "", "sha256", b), "alice@example.org", b, "sha256", "none")
+	}
+	// SHA-256 stamps verified with SHA-1, and the reverse
+	for _, r := range resources[:8] {
+		s := mint(fmt.Sprintf("1:12:%s:%s::%s:", date(created), r, randField()), "sha256", 12, -1)
+		for zeros(s, "sha1") >= 12 {
+			s = mint(fmt.Sprintf("1:12:%s:%s::%s:", date(created), r, randField()), "sha256", 12, -1)
+		}
+		add("wrong-hash", s, r, 12, "sha1", "collision")
+	}
+	for _, r := range resources[:4] {
+		s := mint(fmt.Sprintf("1:12:%s:%s::%s:", date(created), r, randField()), "sha1", 12, -1)
+		for zeros(s, "sha256") >= 12 {
+			s = mint(fmt.Sprintf("1:12:%s:%s::%s:", date(created), r, randField()), "sha1", 12, -1)
+		}
+		add("wrong-hash", s, r, 12, "sha256", "collision")
+	}
+	// stamps lacking the required zero bits
+	for i := 0; i < 20; i++ {
+		r := resources[i%len(resources)]
+		prefix := fmt.Sprintf("1:16:%s:%s::%s:", date(created), r, randField())
+		add("collision", mint(prefix, "sha1", 0, 15), r, 16, "sha1", "collision")
+	}
+	// valid stamps tampered with after minting
+	for i, c := range valid[:20] {
+		s := []byte(c.Stamp)
+		pos := strings.LastIndexByte(c.Stamp, ':') - 2
+		if i%2 == 1 {
+			pos = len(s) - 1
+		}
+		s[pos] ^= 1
+		if zeros(string(s), "sha1") < int(c.Bits) {
+			add("tampered", string(s), c.Resource, int(c.Bits), "sha1", "collision")
+		}
+	}
+	// stamps honestly claiming fewer bits than required
+	for i := 0; i < 10; i++ {
+		prefix := fmt.Sprintf("1:8:%s:%s::%s:", date(created), "alice@example.org", randField())
+		add("underclaim", mint(prefix, "sha1", 8, 11), "alice@example.org", 12, "sha1", "collision")
+	}
+	// expired and future stamps
+	for _, d := range []time.Duration{-29 * 24 * time.Hour, -60 * 24 * time.Hour, -365 * 24 * time.Hour, -10 * 365 * 24 * time.Hour} {
+		for _, f := range formats {
+			add("expired", stamp(8, conformance.Epoch.Add(d).Format(f), "someone@gmail.com", "", "sha1", 8), "someone@gmail.com", 8, "sha1", "expired")
+		}
+	}
+	add("expired", "1:20:040806:foo::65f460d0726f420d:13a6b8", "foo", 20, "sha1", "expired")
+	for _, d := range []time.Duration{49 * time.Hour, 72 * time.Hour, 30 * 24 * time.Hour, 365 * 24 * time.Hour} {
+		for _, f := range formats[1:] {
+			add("future", stamp(8, conformance.Epoch.Add(d).Format(f), "someone@gmail.com", "", "sha1", 8), "someone@gmail.com", 8, "sha1", "future")
+		}
+	}
+	// resources not accepted
+	mismatches := [][2]string{
+		{"alice@example.org", "bob@example.org"},
+		{"Someone@Gmail.com", "someone@gmail.com"},
+		{"someone@gmail.com ", "someone@gmail.com"},
+		{" someone@gmail.com", "someone@gmail.com"},
+		{"someone@gmail.co", "someone@gmail.com"},
+		{"someone@gmail.com.", "someone@gmail.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"api.example.com/v1/comments/", "api.example.com/v1/comments"},
+		{"api.example.com/v1", "api.example.com/v1/comments"},
+		{"example.com", "api.example.com"},
+		{"192.0.2.10", "192.0.2.1"},
+		{"", "someone@gmail.com"},
+		{"someone@gmail.com\t", "someone@gmail.com"},
+		{"someone@gmail.com​", "someone@gmail.com"},
+		{"ѕomeone@gmail.com", "someone@gmail.com"},
+		{"%3A%3A1/Login", "%3A%3A1/login"},
+	}
+	for _, m := range mismatches {
+		add("resource", stamp(8, date(created), m[0], "", "sha1", 8), m[1], 8, "sha1", "resource")
+	}
+	// unsupported versions, minted so only the version is at fault
+	for _, v := range []string{"0", "2", "3", "9", "10", "01"} {
+		prefix := fmt.Sprintf("%s:8:%s:someone@gmail.com::%s:", v, date(created), randField())
+		reason := "version"
+		if v == "01" {
+			// read as version 1
+			reason = "none"
+		}
+		add("version", mint(prefix, "sha1", 8, -1), "someone@gmail.com", 8, "sha1", reason)
+	}
+	// malformed stamps, minted where possible so only their format is at fault
+	var (
+		good      = valid[0].Stamp
+		malformed = []string{
+			"", "blah", ":", "::::::", "1", "1:", "1:8", "1:8:231231", "1:8:231231:someone@gmail.com",
+			"1:8:231231:someone@gmail.com::", "1:8:231231:someone@gmail.com::rand",
+			good + ":extra", " " + good, "\x00" + good,
+			strings.Replace(good, ":", ";", -1), strings.Replace(good, ":", "", -1),
+			strings.Repeat(":", 1000), strings.Repeat("1:", 500),
+			"0:231231:someone@gmail.com:6470e06d773e05a8",
+		}
+		dates = []string{"23123", "2312311", "23123123", "23123123595", "2312312359599", "2313", "231331", "231232",
+			"2312312460", "2312312399", "231231235960", "23123a", "+23123", "-231231", "２３１２３１", ""}
+		bitsFields = []string{"", "abc", "-1", "65", "999", "99999999999999999999", "+8", " 8", "8 ", "0x8", "8.0"}
+	)
+	for _, s := range malformed {
+		add("malformed", s, "someone@gmail.com", 8, "sha1", "invalid")
+	}
+	// characters appended to the counter change the digest, which is checked
+	// before the fields are parsed
+	for _, suffix := range []string{"\n", "\r\n", " ", "\t", "\x00"} {
+		add("malformed", good+suffix, "someone@gmail.com", 8, "sha1", "collision")
+	}
+	for _, d := range dates {
+		prefix := fmt.Sprintf("1:8:%s:someone@gmail.com::%s:", d, randField())
+		add("date", mint(prefix, "sha1", 8, -1), "someone@gmail.com", 8, "sha1", "invalid")
+	}
+	for _, b := range bitsFields {
+		prefix := fmt.Sprintf("1:%s:%s:someone@gmail.com::%s:", b, date(created), randField())
+		add("bits-field", mint(prefix, "sha1", 8, -1), "someone@gmail.com", 8, "sha1", "invalid")
+	}
+	// replays of stamps accepted earlier, cases are verified in order
+	for _, c := range valid[:12] {
+		add("replay", c.Stamp, c.Resource, int(c.Bits), "sha1", "spent")
+	}
+
+	f, err := os.Create("corpus.jsonl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	for _, c := range cases {
+		if err := enc.Encode(c); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
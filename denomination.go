@@ -0,0 +1,162 @@
+package hashcash
+
+import (
+	"context"
+	"strings"
+)
+
+// Denomination a named credit value for headers minted with a given number of
+// bits.
+type Denomination struct {
+	// Name of the denomination, e.g. "five".
+	Name string
+	// Bits required to mint a header of this denomination.
+	Bits Bits
+	// Credits value of a header of this denomination.
+	Credits int
+}
+
+// Denominations set of denominations ordered by increasing bits.
+type Denominations []Denomination
+
+// DefaultDenominations default denominations. Each extra bit doubles the work
+// required, so the credit value of a denomination never exceeds the work
+// required to mint it relative to the smallest denomination.
+var DefaultDenominations = Denominations{
+	{Name: "one", Bits: 20, Credits: 1},
+	{Name: "two", Bits: 21, Credits: 2},
+	{Name: "five", Bits: 23, Credits: 5},
+	{Name: "ten", Bits: 24, Credits: 10},
+}
+
+// Lookup finds the denomination worth exactly credits.
+func (d Denominations) Lookup(credits int) (Denomination, bool) {
+	for _, denom := range d {
+		if denom.Credits == credits {
+			return denom, true
+		}
+	}
+	return Denomination{}, false
+}
+
+// Value returns the credit value of a header minted with bits. Bits which fall
+// between denominations are worth the largest denomination they satisfy.
+func (d Denominations) Value(bits Bits) int {
+	credits := 0
+	for _, denom := range d {
+		if bits >= denom.Bits && denom.Credits > credits {
+			credits = denom.Credits
+		}
+	}
+	return credits
+}
+
+// Mint computes a header for res worth exactly credits, see MintContext.
+func (d Denominations) Mint(res *Resource, credits int, config *Config) (string, error) {
+	return d.MintContext(context.Background(), res, credits, config)
+}
+
+// MintContext computes a header for res worth exactly credits, until one is
+// found or ctx is done. Apart from bits, the header is minted using config,
+// NewDefaultConfig is used when config is nil, without opening storage
+// unless config sets it. If no denomination is worth credits ErrDenomination
+// error is returned.
+func (d Denominations) MintContext(ctx context.Context, res *Resource, credits int, config *Config) (string, error) {
+	denom, ok := d.Lookup(credits)
+	if !ok {
+		return "", ErrDenomination
+	}
+	if config == nil {
+		config = NewDefaultConfig()
+	}
+	c := *config
+	c.Bits = denom.Bits
+	h, err := newMinter(res, &c)
+	if err != nil {
+		return "", err
+	}
+	return h.ComputeContext(ctx)
+}
+
+// VerifyTotal verifies headers using h and checks they are worth at least
+// credits in total, returning their total value. Each header is valued by the
+// bits it claims, which must be backed by its collision, and a header given
+// more than once is rejected with ErrSpent error. Every check not involving
+// spending, including whether headers are already spent, runs before any
+// header is spent, so headers are not spent when the total is insufficient
+// and ErrInsufficientCredits error is returned. If spending a header fails
+// the headers spent before it are removed again when storage implements
+// Admin, so either all headers are spent or, storage permitting, none.
+func (d Denominations) VerifyTotal(h *Hashcash, headers []string, credits int) (int, error) {
+	var (
+		ctx    = context.Background()
+		total  = 0
+		keys   = make([]string, len(headers))
+		events = make([]VerifyEvent, len(headers))
+		seen   = make(map[string]bool, len(headers))
+	)
+	for i, header := range headers {
+		vals := strings.Split(header, ":")
+		if len(vals) != hashcashV1Length {
+			return 0, ErrInvalidHeader
+		}
+		// vals: [version bits date resource extension random counter]
+		bits, err := ParseBits(vals[1])
+		if err != nil {
+			return 0, ErrInvalidHeader
+		}
+		if zero := leadingZeroBits(h.digest(header)); zero < int(bits) {
+			return 0, &CollisionError{Bits: zero, Required: bits}
+		}
+		ev := &events[i]
+		*ev = VerifyEvent{Context: ctx, Instance: h.name, Header: header}
+		key, err := h.check(header, ev)
+		if err == nil && seen[key] {
+			err = ErrSpent
+		}
+		if err != nil {
+			return 0, h.reject(ev, err)
+		}
+		seen[key] = true
+		keys[i] = key
+		total += d.Value(bits)
+	}
+	isSpent, errs := h.spentBatch(ctx, keys)
+	for i := range headers {
+		err := errs[i]
+		if err == nil && isSpent[i] {
+			err = ErrSpent
+		}
+		if err != nil {
+			return 0, h.reject(&events[i], err)
+		}
+	}
+	if total < credits {
+		return total, ErrInsufficientCredits
+	}
+	for i := range headers {
+		ev := &events[i]
+		if _, err := h.run(ev, func() error { return h.claim(ev, keys[i]) }); err != nil {
+			h.unspend(keys[:i])
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// reject reports ev to Config.OnVerify as failed with err, returning err.
+func (h *Hashcash) reject(ev *VerifyEvent, err error) error {
+	h.run(ev, func() error { return err })
+	return err
+}
+
+// unspend removes keys from storage, when it implements Admin.
+func (h *Hashcash) unspend(keys []string) {
+	admin, ok := h.backend().(Admin)
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		admin.Remove(key)
+	}
+}
@@ -0,0 +1,53 @@
+package hashcash
+
+import (
+	"fmt"
+	"time"
+)
+
+// CollisionError describes a header whose digest has too few leading zero
+// bits. It wraps ErrNoCollision, errors.Is(err, ErrNoCollision) reports true.
+type CollisionError struct {
+	// Bits number of leading zero bits of the digest.
+	Bits int
+	// Required number of leading zero bits required.
+	Required Bits
+}
+
+// Error returns a description of the collision error.
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("%v: %d bits, %d required", ErrNoCollision, e.Bits, e.Required)
+}
+
+// Unwrap returns ErrNoCollision.
+func (e *CollisionError) Unwrap() error {
+	return ErrNoCollision
+}
+
+// TimestampError describes a header created outside the window in which
+// headers are accepted. It wraps ErrExpired or ErrFutureStamp, both of which
+// match ErrTimestamp with errors.Is.
+type TimestampError struct {
+	// Created date the header was created.
+	Created time.Time
+	// Earliest date headers may be created, Config.Expired.
+	Earliest time.Time
+	// Latest date headers may be created, Config.Future, or now plus
+	// Config.Skew when future stamps are rejected.
+	Latest time.Time
+	// Err ErrExpired or ErrFutureStamp.
+	Err error
+}
+
+// Error returns a description of the timestamp error.
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("%v: created %s, accepted from %s to %s", e.Err,
+		e.Created.UTC().Format(time.RFC3339),
+		e.Earliest.UTC().Format(time.RFC3339),
+		e.Latest.UTC().Format(time.RFC3339))
+}
+
+// Unwrap returns ErrExpired or ErrFutureStamp.
+func (e *TimestampError) Unwrap() error {
+	return e.Err
+}
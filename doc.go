@@ -6,6 +6,7 @@ Computing a hashcash:
     package main
 
     import (
+        "context"
         "fmt"
 
         "github.com/umahmood/hashcash"
@@ -30,11 +31,9 @@ Computing a hashcash:
             // handle error
         }
 
-        solution, err := hc.Compute()
+        solution, err := hc.ComputeContext(context.Background())
         if err != nil {
-            if err != hashcash.ErrSolutionFail {
-                // did not find a solution, can call compute again.
-            }
+            // handle error
         }
         fmt.Println(solution)
     }
@@ -1,27 +1,160 @@
 package hashcash
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrSolutionFail error cannot compute a solution
 	ErrSolutionFail = errors.New("exceeded 2^20 iterations failed to find solution")
 
+	// ErrBudgetExceeded error Config.Budget was exhausted before a solution
+	// was found
+	ErrBudgetExceeded = errors.New("budget exceeded before a solution was found")
+
+	// ErrAmplification error challenge reply would be larger than allowed for
+	// the request, see CheckHello
+	ErrAmplification = errors.New("challenge reply too large for request")
+
+	// ErrIssueLimit error a remote key was allowed as many challenges as
+	// Config.MaxChallenges or Config.MaxChallengeBytes permit, see CheckHello
+	ErrIssueLimit = errors.New("challenge issuance limit exceeded")
+
+	// ErrInvalidBits error bits is outside the supported range of 0-64
+	ErrInvalidBits = errors.New("bits must be between 0 and 64")
+
 	// ErrResourceEmpty error empty hashcash resource
 	ErrResourceEmpty = errors.New("empty hashcash resource")
 
 	// ErrInvalidHeader error invalid hashcash header format
 	ErrInvalidHeader = errors.New("invalid hashcash header format")
 
-	// ErrNoCollision error n 5 most significant hex digits (n most significant
-	// bits are not 0.
+	// ErrUnsupportedVersion error hashcash header format version is not
+	// supported
+	ErrUnsupportedVersion = errors.New("unsupported hashcash header version")
+
+	// ErrNoCollision error n most significant bits are not 0.
 	ErrNoCollision = errors.New("no collision most significant bits are not zero")
 
+	// ErrExcessBits error hashcash header has far more zero bits than
+	// required
+	ErrExcessBits = errors.New("hashcash header exceeds maximum bits")
+
 	// ErrTimestamp error futuristic and expired time stamps are rejected
 	ErrTimestamp = errors.New("time stamp is too far into the future or expired")
 
+	// ErrExpired error time stamp is expired, it wraps ErrTimestamp
+	ErrExpired = fmt.Errorf("%w: expired", ErrTimestamp)
+
+	// ErrFutureStamp error time stamp is too far into the future, it wraps
+	// ErrTimestamp
+	ErrFutureStamp = fmt.Errorf("%w: created in the future", ErrTimestamp)
+
+	// ErrChallengeExpired error a challenge expired before it was answered,
+	// or would before its answer could be minted, it wraps ErrExpired
+	ErrChallengeExpired = fmt.Errorf("%w: challenge expired", ErrExpired)
+
+	// ErrCounterPrefix error stamp was not minted under the counter prefix
+	// its challenge assigned, e.g. work shared by colluding clients
+	ErrCounterPrefix = errors.New("stamp not minted under the assigned counter prefix")
+
+	// ErrInvalidChallenge error invalid challenge format
+	ErrInvalidChallenge = errors.New("invalid hashcash challenge format")
+
 	// ErrResourceFail error hashcash resource data did not pass validation
 	ErrResourceFail = errors.New("resource data did not pass validation")
 
 	// ErrSpent error avoid accepting the same stamp twice
 	ErrSpent = errors.New("hashcash has already been spent")
+
+	// ErrStorage error spent storage failed, it wraps the storage error's
+	// message
+	ErrStorage = errors.New("spent storage failed")
+
+	// ErrBlocked error remote has been temporarily blocked after repeatedly
+	// failing verification
+	ErrBlocked = errors.New("remote is temporarily blocked")
+
+	// ErrPrepayKey error prepay minter has no signing key
+	ErrPrepayKey = errors.New("prepay minter requires a signing key")
+
+	// ErrQuotaExceeded error client has exhausted its minting quota
+	ErrQuotaExceeded = errors.New("minting quota exceeded")
+
+	// ErrSignature error hashcash header signature is missing or invalid
+	ErrSignature = errors.New("invalid hashcash header signature")
+
+	// ErrSignatureUsed error a header carrying the same signature was
+	// already accepted, it wraps ErrSignature
+	ErrSignatureUsed = fmt.Errorf("%w: already used", ErrSignature)
+
+	// ErrPrepayWindow error prepay quota window is not positive
+	ErrPrepayWindow = errors.New("prepay minter requires a positive quota window")
+
+	// ErrDenomination error no denomination is worth the requested credits
+	ErrDenomination = errors.New("unknown denomination")
+
+	// ErrInsufficientCredits error hashcash headers are not worth enough
+	// credits
+	ErrInsufficientCredits = errors.New("insufficient hashcash credits")
+
+	// ErrStateVersion error saved verifier state is in an unknown format
+	ErrStateVersion = errors.New("unsupported verifier state version")
+
+	// ErrRecordSize error hashcash entry is too large for file storage
+	ErrRecordSize = errors.New("hashcash entry too large for file storage")
+
+	// ErrLockTimeout error file storage lock was not acquired in time
+	ErrLockTimeout = errors.New("timed out waiting for file storage lock")
+
+	// ErrLockUnsupported error file locking is not supported on this
+	// platform
+	ErrLockUnsupported = errors.New("file locking not supported on this platform")
+
+	// ErrNotLister error storage cannot enumerate its entries
+	ErrNotLister = errors.New("storage does not implement Lister")
+
+	// ErrNotAdmin error storage cannot look up or remove its entries
+	ErrNotAdmin = errors.New("storage does not implement Admin")
+
+	// ErrProgressMismatch error saved mint progress is for a different
+	// resource or collision size
+	ErrProgressMismatch = errors.New("mint progress does not match instance")
+
+	// ErrReplayFilterFull error replay filter cannot hold more entries until
+	// it rotates
+	ErrReplayFilterFull = errors.New("replay filter is full")
+
+	// ErrNoStorage error Config.Storage is not set in a build without the
+	// default sqlite3 storage.
+	//
+	// Deprecated: storage defaults to MemoryStorage, the sqlite3 database
+	// is in storage/sqlite3.
+	ErrNoStorage = errors.New("no storage configured and sqlite3 storage excluded from build")
+
+	// ErrInvalidExtension error hashcash extension field is malformed
+	ErrInvalidExtension = errors.New("invalid hashcash extension")
+
+	// ErrExtension error hashcash extensions did not satisfy the extension
+	// policy
+	ErrExtension = errors.New("extensions did not pass validation")
+
+	// ErrHashUnavailable error configured hash algorithm is not linked into
+	// the binary
+	ErrHashUnavailable = errors.New("hash algorithm unavailable")
+
+	// ErrSHA1Sunset error SHA-1 header created after Config.SHA1Sunset
+	ErrSHA1Sunset = errors.New("sha-1 hashcash created after sunset")
+
+	// ErrRelayChain error relay stamp does not reference the stamp before it
+	ErrRelayChain = errors.New("broken relay stamp chain")
+
+	// ErrShutdownTimeout error background component did not stop within
+	// RuntimeConfig.ShutdownTimeout
+	ErrShutdownTimeout = errors.New("component shutdown timed out")
+
+	// ErrInsufficientBits error hashcash header claims fewer bits than
+	// required
+	ErrInsufficientBits = errors.New("hashcash header claims too few bits")
 )
@@ -0,0 +1,93 @@
+package hashcash
+
+import (
+	"context"
+	"time"
+)
+
+// Remote describes the party presenting a hashcash header for verification.
+type Remote struct {
+	// Key identifies the remote party, e.g. an IP address or account id.
+	Key string
+	// Meta caller supplied metadata, e.g. user agent or request id. It is
+	// passed through to OnVerify untouched.
+	Meta map[string]string
+}
+
+// VerifyEvent describes the outcome of a single hashcash verification. It is
+// delivered to Config.OnVerify once per call to Verify or VerifyRemote.
+type VerifyEvent struct {
+	// Context passed to VerifyContext, context.Background() for Verify and
+	// VerifyRemote.
+	Context context.Context
+	// Instance Config.Name of the instance which verified the header.
+	Instance string
+	// Header hashcash header as presented for verification.
+	Header string
+	// Bits number of bits claimed by the header. The header fields are only
+	// parsed once it has passed the collision check.
+	Bits Bits
+	// Created date the header was created, zero if it could not be parsed.
+	Created time.Time
+	// Resource data string the header was minted for.
+	Resource string
+	// Extensions extensions carried by the header, see SetExtensions. It
+	// must not be modified.
+	Extensions map[string]string
+	// Hash hex encoded digest of the header, empty if it failed the collision
+	// check.
+	Hash string
+	// CanonicalKey stable identifier of the header, see Hashcash.SpentKey. Empty
+	// if it failed the collision check.
+	CanonicalKey string
+	// ZeroBits number of leading zero bits in the digest of the header, zero
+	// if it failed the collision check.
+	ZeroBits int
+	// ExcessBits whether the digest exceeded Config.MaxBits.
+	ExcessBits bool
+	// SHA1 whether the header was minted with SHA-1 rather than Config.Hash,
+	// see Config.SHA1Sunset.
+	SHA1 bool
+	// FutureStamp whether the stamp was created more than Config.Skew ahead
+	// of the verifier's clock.
+	FutureStamp bool
+	// ScopeUse use of a header minted for a Resource.Scopes scope recorded
+	// by the verification, counting from 1, zero for other headers.
+	ScopeUse int
+	// Valid whether the header passed verification.
+	Valid bool
+	// Status state of the header after verification, StatusSpent if it is
+	// valid.
+	Status Status
+	// Err reason the header failed verification, nil if it is valid.
+	Err error
+	// Remote party which presented the header.
+	Remote Remote
+	// ParseTime time spent parsing the header.
+	ParseTime time.Duration
+	// HashTime time spent hashing the header and counting zero bits.
+	HashTime time.Duration
+	// StorageTime time spent checking and updating spent storage.
+	StorageTime time.Duration
+	// Duration total time spent verifying the header.
+	Duration time.Duration
+}
+
+// MintStats audit record of a computed hashcash header, demonstrating the
+// header was not precomputed or reused.
+type MintStats struct {
+	// Header computed hashcash header.
+	Header string
+	// CanonicalKey stable identifier of the header, see Hashcash.SpentKey.
+	CanonicalKey string
+	// RandSource source of the random characters in the header.
+	RandSource string
+	// Rand random characters in the header, encoded in base-64 format.
+	Rand string
+	// CounterStart counter value the search started from.
+	CounterStart uint64
+	// Attempts number of headers hashed to find the solution.
+	Attempts uint64
+	// Minted time the solution was found.
+	Minted time.Time
+}
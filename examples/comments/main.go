@@ -0,0 +1,144 @@
+// Command comments is an example comment API protected by hashcash. Browsers
+// fetch a challenge, mint a stamp in WebAssembly and post it with their
+// comment. Stamps are verified against a file backed spent database and
+// outcomes are published as expvar metrics at /debug/vars.
+//
+// Build the WebAssembly minter and run the server:
+//
+//	GOOS=js GOARCH=wasm go build -o static/mint.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" static/
+//	go run . -addr :8080
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// resource comment stamps are minted for
+const resource = "comments.example.com"
+
+var (
+	verified = expvar.NewMap("hashcash_verified")
+	rejected = expvar.NewMap("hashcash_rejected")
+)
+
+// challenge tells clients how to mint a stamp
+type challenge struct {
+	Resource string        `json:"resource"`
+	Bits     hashcash.Bits `json:"bits"`
+}
+
+// comment a posted comment
+type comment struct {
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+}
+
+// server comment API
+type server struct {
+	bits     hashcash.Bits
+	verifier *hashcash.Hashcash
+	mu       sync.Mutex
+	comments []comment
+}
+
+// challenge serves the minting parameters
+func (s *server) challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(challenge{Resource: resource, Bits: s.bits})
+}
+
+// list serves posted comments
+func (s *server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.comments)
+}
+
+// post adds a comment carrying a valid stamp in the X-Hashcash header
+func (s *server) post(w http.ResponseWriter, r *http.Request) {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	_, err := s.verifier.VerifyContext(r.Context(), r.Header.Get("X-Hashcash"), hashcash.Remote{Key: host})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	text, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil || len(text) == 0 {
+		http.Error(w, "empty comment", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.comments = append(s.comments, comment{Text: string(text), Created: time.Now()})
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleComments routes comment requests by method
+func (s *server) handleComments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.list(w, r)
+	case http.MethodPost:
+		s.post(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func main() {
+	var (
+		addr   = flag.String("addr", ":8080", "listen address")
+		bits   = flag.Uint("bits", 18, "bits required of stamps")
+		db     = flag.String("db", "spent.log", "spent database")
+		static = flag.String("static", "static", "directory with index.html, mint.wasm and wasm_exec.js")
+	)
+	flag.Parse()
+	storage, err := hashcash.NewFileStorage(*db, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+	s := &server{bits: hashcash.Bits(*bits)}
+	s.verifier, err = hashcash.New(
+		&hashcash.Resource{Accept: []string{resource}},
+		// stamps are minted on demand, so only those minted since shortly
+		// before start up are accepted, replays are caught by storage.
+		&hashcash.Config{
+			Bits:       s.bits,
+			Expired:    time.Now().Add(-time.Hour),
+			Future:     time.Now().AddDate(1, 0, 0),
+			Storage:    storage,
+			Reputation: hashcash.NewReputation(nil),
+			OnVerify: func(ev hashcash.VerifyEvent) {
+				if ev.Valid {
+					verified.Add("valid", 1)
+				} else if errors.Is(ev.Err, hashcash.ErrInvalidHeader) {
+					rejected.Add("invalid header", 1)
+				} else {
+					rejected.Add(ev.Err.Error(), 1)
+				}
+			},
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.HandleFunc("/challenge", s.challenge)
+	http.HandleFunc("/comments", s.handleComments)
+	http.Handle("/", http.FileServer(http.Dir(*static)))
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,56 @@
+//go:build js && wasm
+
+// Command wasm mints hashcash stamps in the browser. It registers
+// hashcashMint(resource, bits, callback), which mints in short time slices so
+// the page stays responsive, then calls callback(stamp, error).
+package main
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// nopStorage the browser only mints, spent stamps are never recorded
+type nopStorage struct{}
+
+func (nopStorage) Add(string) error  { return nil }
+func (nopStorage) Spent(string) bool { return false }
+
+// slice wall clock time minted before yielding to the event loop
+const slice = 10 * time.Millisecond
+
+// mint computes a stamp, yielding to the event loop between time slices.
+func mint(resource string, bits int) (string, error) {
+	hc, err := hashcash.New(
+		&hashcash.Resource{Data: resource},
+		&hashcash.Config{Bits: hashcash.Bits(bits), Storage: nopStorage{}},
+	)
+	if err != nil {
+		return "", err
+	}
+	for {
+		done, stamp, err := hc.MintStep(slice)
+		if done || err != nil {
+			return stamp, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func main() {
+	js.Global().Set("hashcashMint", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resource, bits, callback := args[0].String(), args[1].Int(), args[2]
+		go func() {
+			stamp, err := mint(resource, bits)
+			if err != nil {
+				callback.Invoke(js.Null(), err.Error())
+				return
+			}
+			callback.Invoke(stamp, js.Null())
+		}()
+		return nil
+	}))
+	select {}
+}
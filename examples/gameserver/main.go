@@ -0,0 +1,288 @@
+// Command gameserver is an example UDP game server which gates connections
+// with hashcash. A connecting client is sent a challenge bound to its address,
+// mints a compact binary stamp and presents it to join. The bits required rise
+// with the rate of connection attempts, so flooding the server costs more
+// work. Challenges are only sent in reply to hellos carrying a small stamp and
+// padded to at least the size of the challenge, so the server cannot be used
+// to amplify traffic to spoofed addresses. Spent stamps are kept in a storage
+// free replay filter.
+//
+// Run the server and connect a client:
+//
+//	go run . -addr :27015
+//	go run . -connect localhost:27015
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// packet types, the first byte of every packet
+const (
+	msgHello     byte = 'H' // client requests a challenge: [compact stamp][padding]
+	msgChallenge byte = 'C' // server challenge: [bits u8][resource]
+	msgJoin      byte = 'J' // client join: [compact stamp]
+	msgWelcome   byte = 'W' // server accepted the join
+	msgReject    byte = 'R' // server rejected the join: [reason]
+)
+
+const (
+	challengeTTL = 10 * time.Second // How long a challenge may be answered
+	maxPending   = 1 << 16          // Most challenges awaiting an answer
+	floodRate    = 64               // Connection attempts per second before bits rise
+	maxExtraBits = 8                // Most bits added under load
+	helloBits    = 4                // Bits of the stamp requesting a challenge
+	helloSize    = 128              // Bytes hellos are padded to
+	helloData    = "gameserver"     // Resource hello stamps are minted for
+)
+
+// pending challenge awaiting a join
+type pending struct {
+	resource string
+	bits     hashcash.Bits
+	issued   time.Time
+}
+
+// server game server connection gate
+type server struct {
+	conn     *net.UDPConn
+	base     hashcash.Bits
+	filter   *hashcash.ReplayFilter
+	mu       sync.Mutex
+	pending  map[string]pending
+	window   time.Time
+	attempts int
+}
+
+// bits returns the bits required of a new connection, one more than base for
+// each doubling of connection attempts per second above floodRate.
+func (s *server) bits(now time.Time) hashcash.Bits {
+	if now.Sub(s.window) >= time.Second {
+		s.window, s.attempts = now, 0
+	}
+	s.attempts++
+	var extra hashcash.Bits
+	for n := s.attempts; n > floodRate && extra < maxExtraBits; n /= 2 {
+		extra++
+	}
+	return s.base + extra
+}
+
+// helloConfig configuration of hello stamps, a fresh one so their windows
+// move with the clock.
+func helloConfig(storage hashcash.Storage) *hashcash.Config {
+	return &hashcash.Config{
+		Bits:             helloBits,
+		Expired:          time.Now().Add(-time.Minute),
+		Future:           time.Now().Add(time.Minute),
+		Storage:          storage,
+		MaxChallengeSize: helloSize,
+	}
+}
+
+// hello issues a challenge bound to addr, if the hello carries a valid stamp
+// and is no smaller than the challenge. Nothing is sent otherwise.
+func (s *server) hello(addr *net.UDPAddr, hello []byte) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return
+	}
+	resource := addr.String() + "/" + hex.EncodeToString(nonce)
+	guard, err := hashcash.New(&hashcash.Resource{Data: helloData}, helloConfig(s.filter))
+	if err != nil {
+		return
+	}
+	// payloads are compared, excluding the type byte of each packet
+	if err := guard.CheckHello(context.Background(), hello, 1+len(resource), hashcash.Remote{Key: addr.IP.String()}); err != nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if len(s.pending) >= maxPending {
+		for key, p := range s.pending {
+			if now.Sub(p.issued) > challengeTTL {
+				delete(s.pending, key)
+			}
+		}
+	}
+	if len(s.pending) >= maxPending {
+		s.mu.Unlock()
+		return
+	}
+	p := pending{
+		resource: resource,
+		bits:     s.bits(now),
+		issued:   now,
+	}
+	s.pending[addr.String()] = p
+	s.mu.Unlock()
+	packet := append([]byte{msgChallenge, byte(p.bits)}, p.resource...)
+	s.conn.WriteToUDP(packet, addr)
+}
+
+// join verifies the stamp presented by addr against its challenge.
+func (s *server) join(addr *net.UDPAddr, stamp []byte) error {
+	s.mu.Lock()
+	p, ok := s.pending[addr.String()]
+	delete(s.pending, addr.String())
+	s.mu.Unlock()
+	if !ok || time.Since(p.issued) > challengeTTL {
+		return errors.New("no challenge")
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{Data: p.resource},
+		&hashcash.Config{
+			Bits:    p.bits,
+			Expired: p.issued.Add(-time.Minute),
+			Future:  time.Now().Add(time.Minute),
+			Storage: s.filter,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = hc.VerifyCompactContext(ctx, stamp, hashcash.Remote{Key: addr.IP.String()})
+	return err
+}
+
+// serve handles packets until the connection is closed.
+func (s *server) serve() error {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		switch buf[0] {
+		case msgHello:
+			s.hello(addr, buf[1:n])
+		case msgJoin:
+			if err := s.join(addr, buf[1:n]); err != nil {
+				s.conn.WriteToUDP(append([]byte{msgReject}, err.Error()...), addr)
+				continue
+			}
+			log.Printf("%s joined", addr)
+			s.conn.WriteToUDP([]byte{msgWelcome}, addr)
+		}
+	}
+}
+
+// nopStorage clients only mint, spent stamps are never recorded
+type nopStorage struct{}
+
+func (nopStorage) Add(string) error  { return nil }
+func (nopStorage) Spent(string) bool { return false }
+
+// connect requests a challenge from the server at addr, mints a stamp and
+// joins.
+func connect(addr string) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(challengeTTL))
+	minter, err := hashcash.New(&hashcash.Resource{Data: helloData}, helloConfig(nopStorage{}))
+	if err != nil {
+		return err
+	}
+	token, err := minter.ComputeCompact()
+	if err != nil {
+		return err
+	}
+	hello := make([]byte, 1+helloSize)
+	hello[0] = msgHello
+	copy(hello[1:], token)
+	if _, err := conn.Write(hello); err != nil {
+		return err
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if n < 2 || buf[0] != msgChallenge {
+		return errors.New("unexpected reply to hello")
+	}
+	bits, resource := hashcash.Bits(buf[1]), string(buf[2:n])
+	hc, err := hashcash.New(
+		&hashcash.Resource{Data: resource},
+		&hashcash.Config{Bits: bits, Storage: nopStorage{}},
+	)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	stamp, err := hc.ComputeCompact()
+	for err == hashcash.ErrSolutionFail {
+		stamp, err = hc.ComputeCompact()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("minted %d bit stamp for %s in %v\n", bits, resource, time.Since(start))
+	if _, err := conn.Write(append([]byte{msgJoin}, stamp...)); err != nil {
+		return err
+	}
+	n, err = conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if n == 0 || buf[0] != msgWelcome {
+		return fmt.Errorf("join rejected: %s", buf[1:n])
+	}
+	fmt.Println("joined")
+	return nil
+}
+
+func main() {
+	var (
+		addr = flag.String("addr", ":27015", "listen address")
+		dial = flag.String("connect", "", "connect to a server at this address instead of serving")
+		bits = flag.Uint("bits", 12, "bits required of stamps when not under load")
+	)
+	flag.Parse()
+	if *dial != "" {
+		if err := connect(*dial); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	laddr, err := net.ResolveUDPAddr("udp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &server{
+		conn: conn,
+		base: hashcash.Bits(*bits),
+		// joins are answered within challengeTTL, so stamps need only be
+		// remembered for slightly longer.
+		filter: hashcash.NewReplayFilter(&hashcash.ReplayFilterConfig{
+			Window:   2 * time.Minute,
+			Capacity: 1 << 20,
+		}),
+		pending: make(map[string]pending),
+	}
+	log.Printf("listening on %s", conn.LocalAddr())
+	log.Fatal(s.serve())
+}
@@ -0,0 +1,81 @@
+// Command oauthserver is an example authorization server whose token endpoint
+// requires hashcash stamps of anonymous device flow and client credentials
+// clients, so tokens cannot be ground out without pre-registered secrets.
+// Stamps are bound to the client_id and grant type of each token request and
+// verified against a file backed spent database.
+//
+// Run the server and request a token with a stamp minted by the hashcash
+// command:
+//
+//	go run . -addr :8080
+//	stamp=$(hashcash mint -b 18 "$(go run . -resource tv-app)")
+//	curl -H "X-Hashcash: $stamp" -d client_id=tv-app \
+//		-d grant_type=client_credentials http://localhost:8080/token
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/oauth"
+)
+
+// token issues an opaque bearer token to any request reaching it, a real
+// server would authorize the device code or client here.
+func token(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": hex.EncodeToString(b),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func main() {
+	var (
+		addr     = flag.String("addr", ":8080", "listen address")
+		bits     = flag.Uint("bits", 18, "bits required of stamps")
+		db       = flag.String("db", "spent.log", "spent database")
+		resource = flag.String("resource", "", "print the client_credentials resource of a client_id and exit")
+	)
+	flag.Parse()
+	if *resource != "" {
+		fmt.Println(oauth.Resource(*resource, oauth.GrantClientCredentials))
+		return
+	}
+	storage, err := hashcash.NewFileStorage(*db, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+	config := hashcash.NewDefaultConfig()
+	config.Bits = hashcash.Bits(*bits)
+	// stamps are minted per token request, so only recent ones are accepted,
+	// replays are caught by storage.
+	config.ExpiryWindow = time.Hour
+	config.FutureWindow = time.Minute
+	config.Storage = storage
+	config.Reputation = hashcash.NewReputation(nil)
+	http.Handle("/token", oauth.Middleware(&oauth.Config{
+		Hashcash: config,
+		Grants:   []string{oauth.GrantDeviceCode, oauth.GrantClientCredentials},
+		OnReject: func(r *http.Request, err error) {
+			log.Printf("rejected token request from %s: %v", r.RemoteAddr, err)
+		},
+	}, http.HandlerFunc(token)))
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,114 @@
+package hashcash
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ExtensionPolicy requirements on the extensions of verified headers, so
+// applications can rely on metadata carried in the extension field, e.g.
+// app=checkout;uid=123.
+type ExtensionPolicy struct {
+	// Require names of extensions which must be present.
+	Require []string
+	// Validators optional validation of extension values by name, a header
+	// carrying an extension whose validator returns false fails
+	// verification.
+	Validators map[string]func(value string) bool
+	// ContextValidators optional validation of extension values by name, as
+	// Validators, receiving the context passed to VerifyContext, e.g. to
+	// check a uid against the tenant of the request. A validator set for a
+	// name here is used in place of one set in Validators.
+	ContextValidators map[string]func(ctx context.Context, value string) bool
+}
+
+// check checks ext, of a header verified with ctx, against the policy.
+func (p *ExtensionPolicy) check(ctx context.Context, ext map[string]string) error {
+	for _, name := range p.Require {
+		if _, ok := ext[name]; !ok {
+			return ErrExtension
+		}
+	}
+	for name, valid := range p.Validators {
+		if _, ok := p.ContextValidators[name]; ok {
+			continue
+		}
+		if value, ok := ext[name]; ok && !valid(value) {
+			return ErrExtension
+		}
+	}
+	for name, valid := range p.ContextValidators {
+		if value, ok := ext[name]; ok && !valid(ctx, value) {
+			return ErrExtension
+		}
+	}
+	return nil
+}
+
+// FormatExtensions formats ext as the extension field of a header, i.e.
+// name=value pairs separated by ';' in name order. Extensions with an empty
+// value are formatted as the name alone. If a name is empty or contains ':',
+// ';' or '=', or a value contains ':' or ';' ErrInvalidExtension error is
+// returned.
+func FormatExtensions(ext map[string]string) (string, error) {
+	names := make([]string, 0, len(ext))
+	for name, value := range ext {
+		if name == "" || strings.ContainsAny(name, ":;=") || strings.ContainsAny(value, ":;") {
+			return "", ErrInvalidExtension
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(name)
+		if value := ext[name]; value != "" {
+			b.WriteByte('=')
+			b.WriteString(value)
+		}
+	}
+	return b.String(), nil
+}
+
+// ParseExtensions parses the extension field of a header formatted by
+// FormatExtensions. If a name is empty or repeated ErrInvalidExtension error
+// is returned.
+func ParseExtensions(s string) (map[string]string, error) {
+	ext := make(map[string]string)
+	if s == "" {
+		return ext, nil
+	}
+	for _, field := range strings.Split(s, ";") {
+		name, value, _ := strings.Cut(field, "=")
+		if _, ok := ext[name]; ok || name == "" {
+			return nil, ErrInvalidExtension
+		}
+		ext[name] = value
+	}
+	return ext, nil
+}
+
+// HeaderExtensions returns the extensions carried by header. It does not
+// verify the header itself, see Verify.
+func HeaderExtensions(header string) (map[string]string, error) {
+	if _, err := scanHeader(header); err != nil {
+		return nil, err
+	}
+	// vals: [version bits date resource extension random counter]
+	return ParseExtensions(strings.Split(header, ":")[4])
+}
+
+// SetExtensions sets the extensions carried by headers computed by the
+// instance, it must be called before Compute.
+func (h *Hashcash) SetExtensions(ext map[string]string) error {
+	s, err := FormatExtensions(ext)
+	if err != nil {
+		return err
+	}
+	h.extension = s
+	return nil
+}
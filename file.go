@@ -0,0 +1,407 @@
+package hashcash
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	recordHeaderSize  = 11   // Size of the length, op and time prefix of a record
+	recordTrailerSize = 4    // Size of the checksum suffix of a record
+	maxRecordSize     = 1024 // Largest entry accepted by FileStorage
+)
+
+// record operations
+const (
+	opAdd    byte = iota // entry was spent
+	opRemove             // entry was removed by an operator
+)
+
+// SyncPolicy when file storage flushes writes to stable storage
+type SyncPolicy int
+
+const (
+	// SyncAlways fsync after every Add, entries survive power loss once Add
+	// returns.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsync on Add at most once per FileConfig.SyncInterval,
+	// entries added since the last fsync may be lost on power loss.
+	SyncInterval
+	// SyncNever leave flushing to the operating system.
+	SyncNever
+)
+
+// FileConfig for file storage
+type FileConfig struct {
+	// Sync when writes are flushed to stable storage.
+	Sync SyncPolicy
+	// SyncInterval minimum time between flushes with SyncInterval.
+	SyncInterval time.Duration
+	// Shared when set, the log may be shared by several processes on one
+	// host, e.g. MTA workers. Every operation takes an advisory lock on the
+	// file and first reads entries appended by other processes.
+	Shared bool
+	// LockTimeout how long a shared operation waits for the lock before
+	// failing with ErrLockTimeout, zero waits indefinitely. Spent falls back
+	// to entries already read when the lock cannot be taken.
+	LockTimeout time.Duration
+}
+
+// DefaultFileConfig default file storage configuration
+var DefaultFileConfig = &FileConfig{
+	Sync: SyncAlways,
+}
+
+// FileStorage spent storage kept in an append-only log file. Each entry is
+// written as a record with a checksum. When the file is opened, records are
+// checked and a torn or corrupt tail, left by an unclean shutdown, is
+// truncated, so earlier entries are never silently lost. It is safe for
+// concurrent use.
+type FileStorage struct {
+	mu       sync.Mutex
+	file     *os.File
+	config   FileConfig
+	spent    map[string]time.Time
+	size     int64
+	lastSync time.Time
+	// Recovered number of bytes truncated from the tail of the file when it
+	// was opened.
+	Recovered int64
+}
+
+// NewFileStorage opens or creates the log file at path, recovering entries
+// written before a crash. If config is nil DefaultFileConfig is used.
+func NewFileStorage(path string, config *FileConfig) (_ *FileStorage, err error) {
+	if config == nil {
+		config = DefaultFileConfig
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f := &FileStorage{
+		file:     file,
+		config:   *config,
+		spent:    make(map[string]time.Time),
+		lastSync: time.Now(),
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+	if err := f.lock(); err != nil {
+		return nil, err
+	}
+	defer f.unlock()
+	f.Recovered, err = f.recover()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// recover reads valid records appended since the last call into memory and
+// truncates the file after the last one, returning the number of bytes
+// truncated. In shared mode the lock must be held, so a record another
+// process is writing is not mistaken for a torn one.
+func (f *FileStorage) recover() (int64, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		r      = io.NewSectionReader(f.file, f.size, info.Size()-f.size)
+		offset = f.size
+	)
+	for {
+		op, added, hash, n, ok := readRecord(r)
+		if !ok {
+			break
+		}
+		if op == opRemove {
+			delete(f.spent, hash)
+		} else {
+			f.spent[hash] = added
+		}
+		offset += n
+	}
+	f.size = offset
+	if offset == info.Size() {
+		_, err = f.file.Seek(offset, io.SeekStart)
+		return 0, err
+	}
+	if err := f.file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if err := f.file.Sync(); err != nil {
+		return 0, err
+	}
+	_, err = f.file.Seek(offset, io.SeekStart)
+	return info.Size() - offset, err
+}
+
+// lock takes the file lock in shared mode, waiting at most LockTimeout.
+func (f *FileStorage) lock() error {
+	if !f.config.Shared {
+		return nil
+	}
+	var (
+		deadline = time.Now().Add(f.config.LockTimeout)
+		backoff  = time.Millisecond
+	)
+	for {
+		ok, err := tryLockFile(f.file)
+		if err != nil || ok {
+			return err
+		}
+		if f.config.LockTimeout > 0 && time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(backoff)
+		if backoff < 50*time.Millisecond {
+			backoff *= 2
+		}
+	}
+}
+
+// unlock releases the file lock in shared mode.
+func (f *FileStorage) unlock() error {
+	if !f.config.Shared {
+		return nil
+	}
+	return unlockFile(f.file)
+}
+
+// shared takes the file lock and reads entries appended by other processes.
+// The returned function releases the lock.
+func (f *FileStorage) shared() (func(), error) {
+	if !f.config.Shared {
+		return func() {}, nil
+	}
+	if err := f.lock(); err != nil {
+		return nil, err
+	}
+	if _, err := f.recover(); err != nil {
+		f.unlock()
+		return nil, err
+	}
+	return func() { f.unlock() }, nil
+}
+
+// readRecord reads a single record from r, returning its operation, time,
+// entry and size. ok is false at the end of the file or if the record is torn
+// or corrupt.
+func readRecord(r io.Reader) (op byte, at time.Time, hash string, n int64, ok bool) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, at, "", 0, false
+	}
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size > maxRecordSize {
+		return 0, at, "", 0, false
+	}
+	body := make([]byte, size+recordTrailerSize)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, at, "", 0, false
+	}
+	sum := crc32.ChecksumIEEE(append(header[:], body[:size]...))
+	if sum != binary.BigEndian.Uint32(body[size:]) {
+		return 0, at, "", 0, false
+	}
+	at = time.Unix(0, int64(binary.BigEndian.Uint64(header[3:])))
+	return header[2], at, string(body[:size]), int64(recordHeaderSize + len(body)), true
+}
+
+// Add appends a new hashcash entry to the log
+func (f *FileStorage) Add(hash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.shared()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	now := time.Now()
+	if err := f.write(opAdd, now, hash); err != nil {
+		return err
+	}
+	f.spent[hash] = now
+	return nil
+}
+
+// CheckAndAdd appends a hashcash entry to the log unless it exists,
+// reporting whether it did, see CheckAndAddContext
+func (f *FileStorage) CheckAndAdd(hash string) (bool, error) {
+	return f.CheckAndAddContext(context.Background(), hash, time.Time{})
+}
+
+// CheckAndAddContext appends a hashcash entry to the log unless it exists,
+// reporting whether it did. In shared mode entries appended by other
+// processes are read and the entry is written under the same file lock, so
+// processes sharing the log cannot both add it. Entries are dated when
+// added, created is not recorded.
+func (f *FileStorage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.shared()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if _, ok := f.spent[hash]; ok {
+		return true, nil
+	}
+	now := time.Now()
+	if err := f.write(opAdd, now, hash); err != nil {
+		return false, err
+	}
+	f.spent[hash] = now
+	return false, nil
+}
+
+// write appends a record to the log, flushing it according to the sync
+// policy.
+func (f *FileStorage) write(op byte, at time.Time, hash string) error {
+	if len(hash) > maxRecordSize {
+		return ErrRecordSize
+	}
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(hash)+recordTrailerSize)
+	binary.BigEndian.PutUint16(record, uint16(len(hash)))
+	record[2] = op
+	binary.BigEndian.PutUint64(record[3:], uint64(at.UnixNano()))
+	record = append(record, hash...)
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+	if _, err := f.file.Write(record); err != nil {
+		// drop the partial record, so later records are not lost behind it
+		// on recovery.
+		f.file.Truncate(f.size)
+		f.file.Seek(f.size, io.SeekStart)
+		return err
+	}
+	f.size += int64(len(record))
+	return f.sync()
+}
+
+// sync flushes the log according to the sync policy.
+func (f *FileStorage) sync() error {
+	switch f.config.Sync {
+	case SyncAlways:
+	case SyncInterval:
+		if time.Since(f.lastSync) < f.config.SyncInterval {
+			return nil
+		}
+	default:
+		return nil
+	}
+	f.lastSync = time.Now()
+	return f.file.Sync()
+}
+
+// Spent checks if a hashcash entry exists in the log
+func (f *FileStorage) Spent(hash string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if unlock, err := f.shared(); err == nil {
+		defer unlock()
+	}
+	_, ok := f.spent[hash]
+	return ok
+}
+
+// SpentBatch checks which hashcash entries exist in the log
+func (f *FileStorage) SpentBatch(hashes []string) ([]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.shared()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	isSpent := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		_, isSpent[i] = f.spent[hash]
+	}
+	return isSpent, nil
+}
+
+// Lookup returns when a hashcash entry was added to the log
+func (f *FileStorage) Lookup(hash string) (SpentInfo, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.shared()
+	if err != nil {
+		return SpentInfo{}, false, err
+	}
+	defer unlock()
+	added, ok := f.spent[hash]
+	if !ok {
+		return SpentInfo{}, false, nil
+	}
+	return SpentInfo{Key: hash, Added: added}, true, nil
+}
+
+// Remove appends a record removing a hashcash entry from the log
+func (f *FileStorage) Remove(hash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.shared()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, ok := f.spent[hash]; !ok {
+		return nil
+	}
+	if err := f.write(opRemove, time.Now(), hash); err != nil {
+		return err
+	}
+	delete(f.spent, hash)
+	return nil
+}
+
+// Recent calls fn with each entry added to the log since since, oldest
+// first
+func (f *FileStorage) Recent(since time.Time, fn func(SpentInfo) error) error {
+	f.mu.Lock()
+	unlock, err := f.shared()
+	if err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	var entries []SpentInfo
+	for hash, added := range f.spent {
+		if !added.Before(since) {
+			entries = append(entries, SpentInfo{Key: hash, Added: added})
+		}
+	}
+	unlock()
+	f.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Added.Before(entries[j].Added) })
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the log file.
+func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
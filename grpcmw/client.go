@@ -0,0 +1,130 @@
+package grpcmw
+
+import (
+	"context"
+
+	"github.com/umahmood/hashcash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ClientConfig for the client interceptors
+type ClientConfig struct {
+	// Hashcash configuration stamps are minted with, NewDefaultConfig when
+	// nil. Stamps are minted with its Bits and Hash.
+	Hashcash *hashcash.Config
+	// Methods bits minted per full method name, in place of Hashcash.Bits.
+	Methods map[string]hashcash.Bits
+	// Resource optional function returning the resource stamps for calls to
+	// method are minted for, the method itself when nil.
+	Resource func(ctx context.Context, method string) string
+	// Retries how many times a unary call failing with ResourceExhausted is
+	// made again with a stamp of RetryBits more bits. Zero never retries.
+	Retries int
+	// RetryBits bits added on each retry, 2 when zero.
+	RetryBits hashcash.Bits
+}
+
+// minter mints stamps for calls
+type minter struct {
+	config ClientConfig
+	mint   hashcash.Config
+}
+
+// newMinter creates a minter. If config is nil the defaults are used.
+func newMinter(config *ClientConfig) *minter {
+	if config == nil {
+		config = &ClientConfig{}
+	}
+	m := &minter{config: *config}
+	if config.Hashcash != nil {
+		m.mint = *config.Hashcash
+	} else {
+		m.mint = *hashcash.NewDefaultConfig()
+	}
+	// minting never touches storage, this avoids opening the default one
+	if m.mint.Storage == nil && m.mint.StorageV2 == nil {
+		m.mint.Storage = hashcash.NewMemoryStorage(nil)
+	}
+	if m.config.RetryBits == 0 {
+		m.config.RetryBits = 2
+	}
+	return m
+}
+
+// bits returns the bits stamps for calls to method are minted with.
+func (m *minter) bits(method string) hashcash.Bits {
+	if bits, ok := m.config.Methods[method]; ok {
+		return bits
+	}
+	return m.mint.Bits
+}
+
+// attach mints a stamp of bits for a call to method, returning ctx with the
+// stamp in its outgoing metadata.
+func (m *minter) attach(ctx context.Context, method string, bits hashcash.Bits) (context.Context, error) {
+	config := m.mint
+	config.Bits = bits
+	hc, err := hashcash.New(&hashcash.Resource{
+		Data: resourceOf(m.config.Resource, ctx, method),
+	}, &config)
+	if err != nil {
+		return nil, err
+	}
+	stamp, err := hc.ComputeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, stamp), nil
+}
+
+// UnaryClientInterceptor returns an interceptor minting a stamp for each
+// unary call, retrying calls rejected with ResourceExhausted with more bits
+// up to Retries times. Rejections advertising only stamp format versions
+// which cannot be minted in VersionsKey are not retried. If config is nil the
+// defaults are used.
+func UnaryClientInterceptor(config *ClientConfig) grpc.UnaryClientInterceptor {
+	m := newMinter(config)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		bits := m.bits(method)
+		for retry := 0; ; retry++ {
+			callCtx, err := m.attach(ctx, method, bits)
+			if err != nil {
+				return err
+			}
+			var trailer metadata.MD
+			err = invoker(callCtx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+			if retry >= m.config.Retries || status.Code(err) != codes.ResourceExhausted || !negotiable(trailer) {
+				return err
+			}
+			bits += m.config.RetryBits
+		}
+	}
+}
+
+// negotiable reports whether a stamp format version advertised in trailer, if
+// any, can be minted, so a retry may be accepted.
+func negotiable(trailer metadata.MD) bool {
+	v := trailer.Get(VersionsKey)
+	if len(v) == 0 {
+		return true
+	}
+	_, ok := hashcash.NegotiateStampVersion(hashcash.ParseStampVersions(v[0]))
+	return ok
+}
+
+// StreamClientInterceptor returns an interceptor minting a stamp for each
+// stream opened. Streams are not retried. If config is nil the defaults are
+// used.
+func StreamClientInterceptor(config *ClientConfig) grpc.StreamClientInterceptor {
+	m := newMinter(config)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := m.attach(ctx, method, m.bits(method))
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
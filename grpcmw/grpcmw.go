@@ -0,0 +1,203 @@
+/*
+Package grpcmw requires hashcash stamps on gRPC calls, carried in the
+x-hashcash metadata key and minted for the full method name of the call, with
+the bits required configurable per method:
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcmw.UnaryServerInterceptor(config)),
+		grpc.StreamInterceptor(grpcmw.StreamServerInterceptor(config)),
+	)
+
+Clients mint stamps with the matching client interceptors:
+
+	conn, err := grpc.Dial(addr,
+		grpc.WithUnaryInterceptor(grpcmw.UnaryClientInterceptor(clientConfig)),
+		grpc.WithStreamInterceptor(grpcmw.StreamClientInterceptor(clientConfig)),
+	)
+*/
+package grpcmw
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/umahmood/hashcash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey metadata key carrying the stamp
+const MetadataKey = "x-hashcash"
+
+// VersionsKey trailer metadata key of rejections advertising the stamp format
+// versions accepted, see hashcash.FormatStampVersions.
+const VersionsKey = "x-hashcash-versions"
+
+var (
+	// ErrMissing error call does not carry a stamp
+	ErrMissing = errors.New("grpcmw: missing " + MetadataKey + " metadata")
+	// ErrNoStorage error configuration sets no spent storage
+	ErrNoStorage = errors.New("grpcmw: ServerConfig.Hashcash sets no storage")
+)
+
+// ServerConfig for the server interceptors
+type ServerConfig struct {
+	// Hashcash configuration stamps are verified with. Storage or StorageV2
+	// must be set. Instances are built when an interceptor is, one for the
+	// methods of Methods each and one for the others, so windows, caches and
+	// reputation are shared by their calls.
+	Hashcash *hashcash.Config
+	// Methods bits required per full method name, e.g.
+	// "/comments.Comments/Post", in place of Hashcash.Bits.
+	Methods map[string]hashcash.Bits
+	// Skip optional function reporting whether calls to method need no
+	// stamp, e.g. health checks.
+	Skip func(method string) bool
+	// Resource optional function returning the resource stamps for calls to
+	// method must be minted for, the method itself when nil.
+	Resource func(ctx context.Context, method string) string
+	// Remote optional function identifying the client of a call, for
+	// reputation and accounting, its IP address when nil.
+	Remote func(ctx context.Context) hashcash.Remote
+	// OnReject optional callback invoked when a call is rejected.
+	OnReject func(ctx context.Context, method string, err error)
+}
+
+// UnaryServerInterceptor returns an interceptor rejecting unary calls which
+// do not carry a valid stamp for their method, see StreamServerInterceptor.
+func UnaryServerInterceptor(cfg *ServerConfig) grpc.UnaryServerInterceptor {
+	v := newVerifier(cfg)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := v.verify(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor rejecting streams which do
+// not carry a valid stamp for their method when opened. Calls are rejected
+// with code ResourceExhausted if the stamp has too few bits, has already
+// been spent or the client is blocked, Unavailable if spent storage failed,
+// and Unauthenticated otherwise.
+//
+// Both server interceptors panic if cfg.Hashcash sets no storage or is
+// invalid.
+func StreamServerInterceptor(cfg *ServerConfig) grpc.StreamServerInterceptor {
+	v := newVerifier(cfg)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := v.verify(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// verifier verifies the stamps of calls with instances built once
+type verifier struct {
+	cfg *ServerConfig
+	// hc verifies calls to methods not in methods
+	hc      *hashcash.Hashcash
+	methods map[string]*hashcash.Hashcash
+}
+
+// resourceKey context key of the resource of the call being verified
+type resourceKey struct{}
+
+// newVerifier builds the instances verifying calls configured by cfg,
+// panicking if it is invalid.
+func newVerifier(cfg *ServerConfig) *verifier {
+	if cfg.Hashcash == nil || cfg.Hashcash.Storage == nil && cfg.Hashcash.StorageV2 == nil {
+		panic(ErrNoStorage)
+	}
+	res := &hashcash.Resource{
+		ValidatorContextFunc: func(ctx context.Context, resource string) bool {
+			want, ok := ctx.Value(resourceKey{}).(string)
+			return ok && resource == want
+		},
+	}
+	v := &verifier{cfg: cfg, methods: make(map[string]*hashcash.Hashcash, len(cfg.Methods))}
+	var err error
+	if v.hc, err = hashcash.New(res, cfg.Hashcash); err != nil {
+		panic("grpcmw: " + err.Error())
+	}
+	for method, bits := range cfg.Methods {
+		config := *cfg.Hashcash
+		config.Bits = bits
+		if v.methods[method], err = hashcash.New(res, &config); err != nil {
+			panic("grpcmw: " + method + ": " + err.Error())
+		}
+	}
+	return v
+}
+
+// verify checks the stamp of a call to method, returning a status error.
+func (v *verifier) verify(ctx context.Context, method string) error {
+	cfg := v.cfg
+	if cfg.Skip != nil && cfg.Skip(method) {
+		return nil
+	}
+	resource := resourceOf(cfg.Resource, ctx, method)
+	err := v.check(ctx, method, resource)
+	if err == nil {
+		return nil
+	}
+	if cfg.OnReject != nil {
+		cfg.OnReject(ctx, method, err)
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(VersionsKey, hashcash.FormatStampVersions(hashcash.StampVersions())))
+	code := codes.Unauthenticated
+	switch {
+	case errors.Is(err, hashcash.ErrNoCollision), errors.Is(err, hashcash.ErrInsufficientBits),
+		errors.Is(err, hashcash.ErrSpent), errors.Is(err, hashcash.ErrBlocked):
+		code = codes.ResourceExhausted
+	case errors.Is(err, hashcash.ErrStorage):
+		code = codes.Unavailable
+	}
+	return status.Errorf(code, "hashcash stamp for resource %q required in %s metadata: %v", resource, MetadataKey, err)
+}
+
+// check verifies the stamp of a call to method against resource.
+func (v *verifier) check(ctx context.Context, method, resource string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	stamps := md.Get(MetadataKey)
+	if len(stamps) == 0 || stamps[0] == "" {
+		return ErrMissing
+	}
+	hc, ok := v.methods[method]
+	if !ok {
+		hc = v.hc
+	}
+	remote := hashcash.Remote{Key: remoteKey(ctx)}
+	if v.cfg.Remote != nil {
+		remote = v.cfg.Remote(ctx)
+	}
+	_, err := hc.VerifyContext(context.WithValue(ctx, resourceKey{}, resource), stamps[0], remote)
+	return err
+}
+
+// resourceOf returns the resource of a call to method.
+func resourceOf(resource func(context.Context, string) string, ctx context.Context, method string) string {
+	if resource != nil {
+		return resource(ctx, method)
+	}
+	return method
+}
+
+// remoteKey returns the IP address of the peer of a call.
+func remoteKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
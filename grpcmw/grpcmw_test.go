@@ -0,0 +1,124 @@
+package grpcmw_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/grpcmw"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var config = &hashcash.Config{
+	Bits:    8,
+	Future:  time.Now().AddDate(0, 0, 2),
+	Expired: time.Now().AddDate(0, 0, -30),
+	Storage: hashcash.NewMemoryStorage(nil),
+}
+
+// serverStream server stream with a context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+func TestInterceptors(t *testing.T) {
+	server := &grpcmw.ServerConfig{
+		Hashcash: config,
+		Methods:  map[string]hashcash.Bits{"/comments.Comments/Post": 16},
+		Skip:     func(method string) bool { return method == "/grpc.health.v1.Health/Check" },
+	}
+	unary := grpcmw.UnaryServerInterceptor(server)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	// invoker passes the outgoing metadata of the client to the server
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		_, err := unary(metadata.NewIncomingContext(ctx, sent), req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	call := func(client *grpcmw.ClientConfig, method string) error {
+		return grpcmw.UnaryClientInterceptor(client)(context.Background(), method, nil, nil, nil, invoker)
+	}
+	if _, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/comments.Comments/List"}, handler); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("missing stamp: %v\n", err)
+	}
+	if _, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler); err != nil {
+		t.Errorf("skipped method: %v\n", err)
+	}
+	client := &grpcmw.ClientConfig{Hashcash: config}
+	if err := call(client, "/comments.Comments/List"); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	// replayed
+	_, err := unary(metadata.NewIncomingContext(context.Background(), sent), nil, &grpc.UnaryServerInfo{FullMethod: "/comments.Comments/List"}, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("replayed stamp: %v\n", err)
+	}
+	// stamps are bound to their method
+	_, err = unary(metadata.NewIncomingContext(context.Background(), sent), nil, &grpc.UnaryServerInfo{FullMethod: "/comments.Comments/Delete"}, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stamp for another method: %v\n", err)
+	}
+	// too few bits to meet 16 by chance
+	if err := call(&grpcmw.ClientConfig{
+		Hashcash: config,
+		Methods:  map[string]hashcash.Bits{"/comments.Comments/Post": 0},
+	}, "/comments.Comments/Post"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("insufficient bits: %v\n", err)
+	}
+	if err := call(&grpcmw.ClientConfig{Hashcash: config, Retries: 2, RetryBits: 4}, "/comments.Comments/Post"); err != nil {
+		t.Errorf("retried call: %v\n", err)
+	}
+	if err := call(&grpcmw.ClientConfig{
+		Hashcash: config,
+		Methods:  map[string]hashcash.Bits{"/comments.Comments/Post": 16},
+	}, "/comments.Comments/Post"); err != nil {
+		t.Errorf("call minted per method: %v\n", err)
+	}
+	// servers sharing no stamp version with the client are not retried
+	calls := 0
+	future := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		for _, opt := range opts {
+			if trailer, ok := opt.(grpc.TrailerCallOption); ok {
+				*trailer.TrailerAddr = metadata.Pairs(grpcmw.VersionsKey, "2,3")
+			}
+		}
+		return status.Error(codes.ResourceExhausted, "stamp version 2 required")
+	}
+	err = grpcmw.UnaryClientInterceptor(&grpcmw.ClientConfig{Hashcash: config, Retries: 2})(context.Background(), "/comments.Comments/Post", nil, nil, nil, future)
+	if status.Code(err) != codes.ResourceExhausted || calls != 1 {
+		t.Errorf("made %d calls: %v\n", calls, err)
+	}
+
+	stream := grpcmw.StreamServerInterceptor(server)
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ss := &serverStream{ctx: metadata.NewIncomingContext(ctx, md)}
+		err := stream(nil, ss, &grpc.StreamServerInfo{FullMethod: method}, func(interface{}, grpc.ServerStream) error { return nil })
+		return nil, err
+	}
+	if _, err := grpcmw.StreamClientInterceptor(client)(context.Background(), &grpc.StreamDesc{}, nil, "/comments.Comments/Watch", streamer); err != nil {
+		t.Errorf("stream: %v\n", err)
+	}
+	ss := &serverStream{ctx: context.Background()}
+	if err := stream(nil, ss, &grpc.StreamServerInfo{FullMethod: "/comments.Comments/Watch"}, nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stream without stamp: %v\n", err)
+	}
+}
+
+func TestServerInterceptorNoStorage(t *testing.T) {
+	defer func() {
+		if err := recover(); err != grpcmw.ErrNoStorage {
+			t.Errorf("got %v\n", err)
+		}
+	}()
+	grpcmw.UnaryServerInterceptor(&grpcmw.ServerConfig{Hashcash: &hashcash.Config{Bits: 8}})
+}
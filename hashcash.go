@@ -1,55 +1,285 @@
 package hashcash
 
 import (
-	"fmt"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	maxIterations    int    = 1 << 20        // Max iterations to find a solution
+	maxIterations    uint64 = 1 << 20        // Max iterations per call to find a solution
+	mintStepCheck    uint64 = 1 << 10        // Iterations between deadline checks in MintStep
+	maxBits          int    = 64             // Largest supported collision size
 	bytesToRead      int    = 8              // Bytes to read for random token
-	bitsPerHexChar   int    = 4              // Each hex character takes 4 bits
-	zero             rune   = 48             // ASCII code for number zero
 	hashcashV1Length int    = 7              // Number of items in a V1 hashcash header
 	timeFormat       string = "060102150405" // YYMMDDhhmmss
 )
 
+// defaultProgressInterval minimum time between calls of Config.OnProgress
+const defaultProgressInterval = 100 * time.Millisecond
+
 // Resource represents a hashcash resource
 type Resource struct {
 	// Data email, IP address, etc...
 	Data string
 	// ValidatorFunc user supplied function which validates Data
 	ValidatorFunc func(string) bool
+	// ValidatorContextFunc user supplied function which validates Data,
+	// receiving the context passed to VerifyContext. If set, it is used in
+	// place of ValidatorFunc.
+	ValidatorContextFunc func(context.Context, string) bool
+	// Accept resources accepted at verification, e.g. all aliases of a
+	// mailbox or all domains of a virtual host. If set, a header's resource
+	// must be one of Accept, in addition to passing any validator function.
+	Accept []string
+	// FoldCase compare resources against Accept case insensitively.
+	FoldCase bool
+	// Normalize optional normalizer applied to Data before minting, and to
+	// Accept and the resource of headers before they are compared or passed
+	// to validator functions, e.g. ChainNormalizers(FoldASCII,
+	// DomainNormalizer(idna.Lookup.ToASCII)). With Salt, Data and Accept are
+	// normalized before they are hashed.
+	Normalize Normalizer
+	// Salt when set, headers carry HashResource(Salt, Data) in place of the
+	// clear resource, so headers logged or relayed through intermediaries do
+	// not leak e.g. recipient addresses. Entries of Accept are hashed for
+	// verification, Accept defaults to Data when no validator function is
+	// set. Validator functions receive the hashed resource.
+	Salt []byte
+	// Scopes scopes whose stamps are accepted for resources they cover, a
+	// limited number of times, in addition to stamps minted for the resource
+	// itself. The resources covered are Accept, or Data if Accept is empty.
+	// Scopes are ignored with Salt.
+	Scopes []Scope
+	// ConstantTime compare resources against every entry of Accept in
+	// constant time, and run every check during verification rather than
+	// returning on the first failure, so timing does not reveal valid
+	// resources or which check failed. The first failure is still returned.
+	ConstantTime bool
 }
 
 // Config for a hashcash instance
 type Config struct {
-	// Bits recommended default collision sizes are 20-bits
-	Bits int
+	// Bits recommended default collision sizes are 20-bits, at most 64 bits
+	// are supported.
+	Bits Bits
+	// Schedule optional calendar of required bits, when set it takes
+	// precedence over Bits. Headers are minted with the bits scheduled at
+	// the time the instance is created.
+	Schedule *BitsSchedule
+	// Policy optional cache of bits fetched from a policy source, when set
+	// it takes precedence over Bits and Schedule. Headers are minted with the
+	// bits cached at the time the instance is created.
+	Policy *PolicyCache
 	// Expiry time before hashcash tokens are considered expired. Recommended
-	// expiry time is 28 days
+	// expiry time is 28 days. It is fixed, prefer ExpiryWindow for
+	// instances which outlive a day.
 	Expired time.Time
 	// Future hashcash in the future that should be rejected. Recommended
-	// tolerance for clock skew is 48 hours
+	// tolerance for clock skew is 48 hours. It is fixed, prefer FutureWindow
+	// for instances which outlive a day.
 	Future time.Time
-	// Storage underlying storage where hashcash tokens are stored and retrieved.
+	// ExpiryWindow when non zero, headers created more than ExpiryWindow
+	// before verification are expired, in place of Expired. The window moves
+	// with the clock, so long running verifiers never go stale.
+	ExpiryWindow time.Duration
+	// FutureWindow when non zero, headers created more than FutureWindow
+	// ahead of verification are rejected, in place of Future.
+	FutureWindow time.Duration
+	// Now optional clock dating minted headers and checking the dates of
+	// verified headers against the windows, time.Now when nil. Durations
+	// such as timings and budgets are measured with the system clock, e.g.
+	// to inject clock faults with chaos.Clock.
+	Now func() time.Time
+	// Skew tolerance for clock skew, stamps created up to Skew ahead of the
+	// verifier's clock are treated as current.
+	Skew time.Duration
+	// FutureStamps action taken for stamps created more than Skew ahead of
+	// the verifier's clock, but not after Future.
+	FutureStamps FutureStampAction
+	// Storage underlying storage where hashcash tokens are stored and retrieved,
+	// a MemoryStorage when neither it nor StorageV2 is set. Only its failures
+	// to add entries are reported, new code should prefer StorageV2.
 	Storage Storage
+	// StorageV2 optional storage reporting failures and receiving expiry
+	// times, used in place of Storage when set.
+	StorageV2 StorageV2
+	// Name optional instance name passed to OnVerify in VerifyEvent.Instance,
+	// so hooks shared by several instances in one process (e.g. one per
+	// tenant) can label metrics per instance.
+	Name string
+	// OnVerify optional callback invoked with the outcome of every
+	// verification, e.g. to feed custom dashboards.
+	OnVerify func(VerifyEvent)
+	// Reputation optional tracker which blocks remote keys repeatedly
+	// presenting invalid headers, see VerifyRemote.
+	Reputation *Reputation
+	// Accounting optional ledger summing the bits of headers verified per
+	// remote key, see VerifyRemote.
+	Accounting *Accounting
+	// Audit record how each header was minted, see MintStats.
+	Audit bool
+	// MaxBits when non zero, headers whose digest has more than MaxBits
+	// leading zero bits are handled according to ExcessBits. Far more work
+	// than required can be a sign of abusive minting farms.
+	MaxBits Bits
+	// ExcessBits action taken for headers exceeding MaxBits.
+	ExcessBits ExcessBitsAction
+	// RetryWindow when non zero, a header verified again by the same remote
+	// key within this duration is accepted without side effects rather than
+	// rejected with ErrSpent, accommodating client retries after network
+	// timeouts. See VerifyRemote.
+	RetryWindow time.Duration
+	// ParseCacheTTL when non zero, the digest and parsed fields of verified
+	// headers are cached for this duration, so a header verified repeatedly
+	// in a burst is hashed and parsed once. Time, resource and spent checks
+	// are still run on every verification.
+	ParseCacheTTL time.Duration
+	// Extensions optional requirements on the extensions of verified
+	// headers, see SetExtensions.
+	Extensions *ExtensionPolicy
+	// Hash algorithm headers are minted and verified with, SHA-1 when zero.
+	// Minters and verifiers must agree on the algorithm. The algorithm must
+	// be linked into the binary, e.g. crypto/sha256 for crypto.SHA256 or
+	// golang.org/x/crypto/blake2b for crypto.BLAKE2b_256, otherwise New
+	// fails with ErrHashUnavailable.
+	Hash crypto.Hash
+	// Hasher optional constructor of the hash algorithm, e.g. sha256.New,
+	// when set it takes precedence over Hash.
+	Hasher func() hash.Hash
+	// SHA1Sunset when set with a Hash other than SHA-1, headers minted with
+	// SHA-1 are also accepted if they were created before SHA1Sunset, so a
+	// fleet can migrate in stages. Later SHA-1 headers fail with
+	// ErrSHA1Sunset. As the creation date is chosen by the minter, SHA-1
+	// headers are only rejected outright once Expired passes SHA1Sunset.
+	SHA1Sunset time.Time
+	// Strict when set, verification continues past failed collision,
+	// timestamp and resource checks and every failure is returned, joined
+	// with errors.Join, so clients can fix all problems with their headers
+	// at once.
+	Strict bool
+	// OnProgress optional callback invoked about every ProgressInterval
+	// while Compute, ComputeContext and ComputeParallel search for a
+	// solution, with the headers hashed and time spent since the call
+	// began, e.g. to show an ETA or log slow mints. ComputeParallel invokes
+	// it from one of its workers.
+	OnProgress func(attempts uint64, elapsed time.Duration)
+	// OnProgressContext optional callback invoked as OnProgress, receiving
+	// the context passed to ComputeContext or ComputeParallel, e.g. to
+	// report progress on the span of the request minting. If set, it is
+	// used in place of OnProgress.
+	OnProgressContext func(ctx context.Context, attempts uint64, elapsed time.Duration)
+	// ProgressInterval minimum time between calls of OnProgress, 100
+	// milliseconds when zero.
+	ProgressInterval time.Duration
+	// Budget optional bound on the work of each call of ComputeContext,
+	// ComputeParallel and ComputeResult, which fail with ErrBudgetExceeded
+	// once it is exhausted.
+	Budget Budget
+	// MaxChallengeSize when non zero, CheckHello rejects challenge replies
+	// larger than MaxChallengeSize bytes.
+	MaxChallengeSize int
+	// AmplificationFactor most bytes a challenge reply checked by CheckHello
+	// may hold per byte of the request, 1 when zero, so requests with a
+	// spoofed source cannot be reflected at a larger size.
+	AmplificationFactor float64
+	// MaxChallenges when non zero, CheckHello rejects requests of a remote
+	// key once MaxChallenges challenges were allowed for it within
+	// ChallengeWindow.
+	MaxChallenges int
+	// MaxChallengeBytes when non zero, CheckHello rejects requests of a
+	// remote key once challenges of MaxChallengeBytes bytes in total were
+	// allowed for it within ChallengeWindow.
+	MaxChallengeBytes int
+	// ChallengeWindow window over which the challenges allowed for each
+	// remote key are counted, a minute when zero.
+	ChallengeWindow time.Duration
+}
+
+// Budget bound on the work spent searching for a solution. Zero fields are
+// unbounded.
+type Budget struct {
+	// Attempts maximum number of headers hashed.
+	Attempts uint64
+	// Duration maximum wall clock time spent.
+	Duration time.Duration
 }
 
-// DefaultConfig default hashcash configuration
+// DefaultConfig default hashcash configuration, as NewDefaultConfig without
+// storage. New no longer reads it when passed a nil config.
+//
+// Deprecated: it is shared by every caller, use NewDefaultConfig or
+// NewWithOptions.
 var DefaultConfig = &Config{
-	Bits:    20,
-	Future:  time.Now().AddDate(0, 0, 2),
-	Expired: time.Now().AddDate(0, 0, -30),
+	Bits:         defaultBits,
+	ExpiryWindow: defaultExpiryWindow,
+	FutureWindow: defaultFutureWindow,
 }
 
+// defaults of NewDefaultConfig
+const (
+	defaultBits         Bits          = 20
+	defaultExpiryWindow time.Duration = 28 * 24 * time.Hour
+	defaultFutureWindow time.Duration = 48 * time.Hour
+)
+
+// NewDefaultConfig returns the default hashcash configuration, used by New
+// when passed a nil config and by NewWithOptions: 20 bits, stamps created up
+// to 48 hours ahead or 28 days ago are accepted, and spent stamps are kept in
+// memory. The windows move with the clock.
+func NewDefaultConfig() *Config {
+	return &Config{
+		Bits:         defaultBits,
+		ExpiryWindow: defaultExpiryWindow,
+		FutureWindow: defaultFutureWindow,
+		Storage:      NewMemoryStorage(nil),
+	}
+}
+
+// ExcessBitsAction action taken when a header exceeds Config.MaxBits
+type ExcessBitsAction int
+
+const (
+	// FlagExcessBits accept the header, flagging it in VerifyEvent.ExcessBits
+	FlagExcessBits ExcessBitsAction = iota
+	// RejectExcessBits reject the header with ErrExcessBits
+	RejectExcessBits
+)
+
+// FutureStampAction action taken for stamps created in the future, see
+// Config.FutureStamps
+type FutureStampAction int
+
+const (
+	// AcceptFutureStamps accept the stamp
+	AcceptFutureStamps FutureStampAction = iota
+	// FlagFutureStamps accept the stamp, flagging it in
+	// VerifyEvent.FutureStamp
+	FlagFutureStamps
+	// RejectFutureStamps reject the stamp with ErrFutureStamp
+	RejectFutureStamps
+)
+
 // Hashcash instance
 type Hashcash struct {
 	// version hashcash format version, 1 (which supersedes version 0).
 	version int
 	// bits number of "partial pre-image" (zero) bits in the hashed code.
-	bits int
+	bits Bits
+	// schedule calendar of required bits
+	schedule *BitsSchedule
+	// policy cached bits of a policy source
+	policy *PolicyCache
 	// created date The time that the message was sent.
 	created time.Time
 	// resource data string being transmitted, e.g., an IP address or email address.
@@ -58,130 +288,960 @@ type Hashcash struct {
 	extension string
 	// rand characters, encoded in base-64 format.
 	rand string
-	// counter (up to 2^20), encoded in base-64 format.
-	counter int
+	// counter encoded in base-64 format.
+	counter uint64
 	// validatorFunc user supplied function which validates resource
-	validatorFunc func(string) bool
+	validatorFunc func(context.Context, string) bool
 	// expired expiry time for headers
 	expired time.Time
 	// future tolerance for clock skew
 	future time.Time
+	// expiryWindow and futureWindow windows relative to the clock, in place
+	// of expired and future when non zero
+	expiryWindow time.Duration
+	futureWindow time.Duration
+	// now clock dates are checked against
+	now func() time.Time
+	// skew tolerance for stamps created ahead of the clock
+	skew time.Duration
+	// futureStamps action for stamps created beyond skew
+	futureStamps FutureStampAction
 	// store the spent hashcash stamps
 	storage Storage
+	// store storage v2, used in place of storage when set
+	store StorageV2
+	// window time between the creation of the instance and Expired, for
+	// which headers are accepted
+	window time.Duration
+	// name instance name reported in verify events
+	name string
+	// onVerify callback invoked after each verification
+	onVerify func(VerifyEvent)
+	// reputation tracks failures per remote key
+	reputation *Reputation
+	// accounting sums verified bits per remote key
+	accounting *Accounting
+	// audit record minted headers in mintStats
+	audit bool
+	// onProgress called with the progress of searches
+	onProgress func(context.Context, uint64, time.Duration)
+	// progressEvery minimum time between calls of onProgress
+	progressEvery time.Duration
+	// budget bound on the work of each search
+	budget Budget
+	// maxChallenge and amplification bounds on challenge replies
+	maxChallenge  int
+	amplification float64
+	// issued challenges allowed per remote key, nil when unlimited
+	issued *issuance
+	// counterStart counter value the search started from
+	counterStart uint64
+	// mintStats audit records of minted headers
+	mintStats []MintStats
+	// retries headers recently verified per remote key
+	retries *retryCache
+	// parsed headers recently parsed
+	parsed *parseCache
+	// extensions requirements on extensions of verified headers
+	extensions *ExtensionPolicy
+	// hashers pool of hashers of Config.Hash, nil for SHA-1
+	hashers *sync.Pool
+	// sha1Sunset creation date from which SHA-1 headers are rejected
+	sha1Sunset time.Time
+	// maxBits leading zero bits above which excessBits is applied
+	maxBits Bits
+	// excessBits action for headers exceeding maxBits
+	excessBits ExcessBitsAction
+	// strict report every failed check
+	strict bool
+	// constantTime run every check, without returning early
+	constantTime bool
+	// foldCase resources are compared case insensitively
+	foldCase bool
+	// normalize normalizes resources before they are compared
+	normalize Normalizer
+	// scopes scopes whose stamps are accepted a number of times
+	scopes []Scope
 }
 
-// Compute a new hashcash header. If no solution can be found 'ErrSolutionFail'
-// error is returned.
+// Compute a new hashcash header. If no solution can be found within 2^20
+// iterations 'ErrSolutionFail' error is returned, Compute can be called again
+// to continue the search where it left off.
+//
+// Deprecated: use ComputeContext, which searches until a solution is found
+// or its context is done, rather than returning ErrSolutionFail.
 func (h *Hashcash) Compute() (string, error) {
-	// hex char: 0    0    0    0    0
-	// binary  : 0000 0000 0000 0000 0000 = 4 bits per char = 20 bits total
 	var (
-		wantZeros = h.bits / bitsPerHexChar
-		header    = h.createHeader()
-		hash      = sha1Hash(header)
+		limit    = h.counter + maxIterations
+		header   = h.createHeader()
+		progress = h.newProgress(context.Background())
 	)
-	for !acceptableHeader(hash, zero, wantZeros) {
+	for !acceptableHeader(h.digest(header), h.bits) {
 		h.counter++
-		header = h.createHeader()
-		hash = sha1Hash(header)
-		if h.counter >= maxIterations {
+		if h.counter >= limit {
 			return "", ErrSolutionFail
 		}
+		if h.counter%mintStepCheck == 0 {
+			progress.report(h.counter)
+		}
+		header = h.createHeader()
 	}
+	h.minted(header)
 	return header, nil
 }
 
+// ComputeContext computes a new hashcash header as Compute does, but searches
+// until a solution is found or ctx is done, in which case ctx's error is
+// returned. If Config.Budget is exhausted first, ErrBudgetExceeded is
+// returned. ComputeContext can be called again to continue the search where
+// it left off.
+func (h *Hashcash) ComputeContext(ctx context.Context) (string, error) {
+	var (
+		header   = h.createHeader()
+		progress = h.newProgress(ctx)
+		budget   = h.newBudget()
+	)
+	for !acceptableHeader(h.digest(header), h.bits) {
+		h.counter++
+		if budget.exhausted(h.counter) {
+			return "", ErrBudgetExceeded
+		}
+		if h.counter%mintStepCheck == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			if budget.expired() {
+				return "", ErrBudgetExceeded
+			}
+			progress.report(h.counter)
+		}
+		header = h.createHeader()
+	}
+	h.minted(header)
+	return header, nil
+}
+
+// ComputeParallel computes a new hashcash header as ComputeContext does,
+// sharding the counter space across workers goroutines, or GOMAXPROCS if
+// workers is not positive. The first solution found is returned and the
+// remaining workers are stopped.
+func (h *Hashcash) ComputeParallel(ctx context.Context, workers int) (string, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	search, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg     sync.WaitGroup
+		once   sync.Once
+		header string
+		found  uint64
+		start  = h.counter
+		// next counter each worker would have tried
+		next     = make([]uint64, workers)
+		progress = h.newProgress(ctx)
+		budget   = h.newBudget()
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counter := start + uint64(i)
+			for n := uint64(1); ; n++ {
+				s := h.headerAt(counter)
+				if acceptableHeader(h.digest(s), h.bits) {
+					once.Do(func() {
+						header, found = s, counter
+						cancel()
+					})
+					break
+				}
+				counter += uint64(workers)
+				if budget.exhausted(counter) {
+					break
+				}
+				if n%mintStepCheck == 0 {
+					if search.Err() != nil || budget.expired() {
+						break
+					}
+					if i == 0 {
+						// workers progress at about the same rate
+						progress.report(start + n*uint64(workers))
+					}
+				}
+			}
+			next[i] = counter
+		}(i)
+	}
+	wg.Wait()
+	if header == "" {
+		// every counter below the lowest next has been tried
+		h.counter = next[0]
+		for _, c := range next[1:] {
+			if c < h.counter {
+				h.counter = c
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "", ErrBudgetExceeded
+	}
+	h.counter = found
+	h.minted(header)
+	return header, nil
+}
+
+// MintStep performs at most budget of wall clock work searching for a
+// solution, so callers such as game loops, UI threads and event loops can
+// interleave minting without goroutines. done is false if no solution was
+// found within budget, MintStep can be called again to continue the search
+// where it left off.
+func (h *Hashcash) MintStep(budget time.Duration) (done bool, token string, err error) {
+	var (
+		deadline = time.Now().Add(budget)
+		header   = h.createHeader()
+	)
+	for !acceptableHeader(h.digest(header), h.bits) {
+		h.counter++
+		if h.counter%mintStepCheck == 0 && !time.Now().Before(deadline) {
+			return false, "", nil
+		}
+		header = h.createHeader()
+	}
+	h.minted(header)
+	return true, header, nil
+}
+
+// searchLimits limits of a single search, see Config.Budget
+type searchLimits struct {
+	// limit counter at which the search stops, zero when unbounded.
+	limit    uint64
+	deadline time.Time
+}
+
+// newBudget returns the limits of a search beginning now.
+func (h *Hashcash) newBudget() searchLimits {
+	var b searchLimits
+	if h.budget.Attempts > 0 {
+		b.limit = h.counter + h.budget.Attempts
+	}
+	if h.budget.Duration > 0 {
+		b.deadline = time.Now().Add(h.budget.Duration)
+	}
+	return b
+}
+
+// exhausted reports whether the search reached counter beyond its attempts.
+func (b searchLimits) exhausted(counter uint64) bool {
+	return b.limit != 0 && counter >= b.limit
+}
+
+// expired reports whether the search ran out of time.
+func (b searchLimits) expired() bool {
+	return !b.deadline.IsZero() && !time.Now().Before(b.deadline)
+}
+
+// progress reports the progress of a search to Config.OnProgress
+type progress struct {
+	fn       func(context.Context, uint64, time.Duration)
+	ctx      context.Context
+	interval time.Duration
+	// counter and time the search began at, and time last reported.
+	counter uint64
+	start   time.Time
+	last    time.Time
+}
+
+// newProgress returns the progress of a search with ctx beginning now, nil
+// when neither Config.OnProgress nor Config.OnProgressContext is set.
+func (h *Hashcash) newProgress(ctx context.Context) *progress {
+	if h.onProgress == nil {
+		return nil
+	}
+	now := time.Now()
+	return &progress{fn: h.onProgress, ctx: ctx, interval: h.progressEvery, counter: h.counter, start: now, last: now}
+}
+
+// report calls Config.OnProgress with the search at counter, if interval has
+// passed since it was last called.
+func (p *progress) report(counter uint64) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+	p.fn(p.ctx, counter-p.counter, now.Sub(p.start))
+}
+
+// minted records an audit record of header when auditing is enabled.
+func (h *Hashcash) minted(header string) {
+	if !h.audit {
+		return
+	}
+	key, _ := h.SpentKey(header)
+	h.mintStats = append(h.mintStats, MintStats{
+		Header:       header,
+		CanonicalKey: key,
+		RandSource:   randSource,
+		Rand:         h.rand,
+		CounterStart: h.counterStart,
+		Attempts:     h.counter - h.counterStart + 1,
+		Minted:       time.Now(),
+	})
+}
+
+// MintStats returns audit records of headers computed by the instance. Records
+// are only kept when Config.Audit is set.
+func (h *Hashcash) MintStats() []MintStats {
+	return append([]MintStats(nil), h.mintStats...)
+}
+
 // Verify that a hashcash header is valid. If the header is not in a valid
 // format, ErrInvalidHeader error is returned.
 func (h *Hashcash) Verify(header string) (bool, error) {
-	vals := strings.Split(header, ":")
-	if len(vals) != hashcashV1Length {
-		return false, ErrInvalidHeader
-	}
-	// vals: [version bits date resource extension random counter]
+	return h.VerifyContext(context.Background(), header, Remote{})
+}
+
+// VerifyRemote verifies a hashcash header presented by remote. It behaves as
+// Verify, remote is passed through to Config.OnVerify. If a reputation tracker
+// is configured and remote.Key is blocked, ErrBlocked is returned without
+// checking the header. If Config.RetryWindow is set, remote.Key may verify the
+// same header again within the window. If Config.Accounting is set, the bits
+// of valid headers are recorded against remote.Key.
+func (h *Hashcash) VerifyRemote(header string, remote Remote) (bool, error) {
+	return h.VerifyContext(context.Background(), header, remote)
+}
+
+// VerifyContext verifies a hashcash header presented by remote as
+// VerifyRemote does. ctx is passed to ValidatorContextFunc, storage
+// implementing ContextSpender and Config.OnVerify, so request scoped values
+// such as request ids and tracing spans flow through verification. If ctx is
+// done before storage is updated, its error is returned.
+func (h *Hashcash) VerifyContext(ctx context.Context, header string, remote Remote) (bool, error) {
+	ev := &VerifyEvent{Context: ctx, Instance: h.name, Header: header, Remote: remote}
+	return h.run(ev, func() error { return h.verify(header, ev) })
+}
+
+// run runs verify, unless the remote of ev is blocked, recording the outcome
+// with the reputation tracker and reporting ev to Config.OnVerify.
+func (h *Hashcash) run(ev *VerifyEvent, verify func() error) (bool, error) {
 	var (
-		hash      = sha1Hash(header)
-		wantZeros = h.bits / bitsPerHexChar
+		track = h.reputation != nil && ev.Remote.Key != ""
+		start = time.Now()
+		err   error
 	)
-	// test 1 - zero count
-	if !acceptableHeader(hash, zero, wantZeros) {
-		return false, ErrNoCollision
+	if track && h.reputation.ShouldBlock(ev.Remote.Key) {
+		err = ErrBlocked
+	} else {
+		err = verify()
+		if track {
+			h.reputation.Record(ev.Remote.Key, err)
+		}
+		if err == nil && h.accounting != nil && ev.Remote.Key != "" {
+			h.accounting.Record(ev.Remote.Key, verifiedBits(ev))
+		}
+	}
+	ev.Duration = time.Since(start)
+	ev.Valid = err == nil
+	ev.Err = err
+	ev.Status = statusOf(err)
+	if h.onVerify != nil {
+		h.onVerify(*ev)
 	}
+	return ev.Valid, err
+}
+
+// verify runs the hashcash checks against header, recording the parsed
+// fields and time spent in each stage in ev.
+func (h *Hashcash) verify(header string, ev *VerifyEvent) error {
+	key, err := h.check(header, ev)
+	if err != nil {
+		return err
+	}
+	// test 4 - check if hash is in spent storage
+	t := time.Now()
+	defer func() { ev.StorageTime = time.Since(t) }()
+	return h.claim(ev, key)
+}
+
+// check runs the checks against header which do not involve spent storage,
+// returning the key header is recorded under.
+func (h *Hashcash) check(header string, ev *VerifyEvent) (string, error) {
+	// cheap structural checks which do not allocate, so garbage is rejected
+	// before any hashing or parsing takes place.
+	t := time.Now()
+	version, err := scanHeader(header)
+	if err != nil {
+		ev.ParseTime = time.Since(t)
+		return "", err
+	}
+	if !SupportsStampVersion(version) {
+		ev.ParseTime = time.Since(t)
+		return "", ErrUnsupportedVersion
+	}
+	ev.ParseTime = time.Since(t)
+	// failures of the collision, timestamp and resource checks, in strict
+	// mode verification continues past them.
+	var errs []error
+	fail := func(err error) bool {
+		errs = append(errs, err)
+		return !h.strict && !h.constantTime
+	}
+	// test 1 - zero count, checked a byte at a time before the header is
+	// fully parsed.
+	p, cached := h.parsed.get(header)
+	t = time.Now()
+	required := h.requiredBits()
+	if !cached {
+		p = &parsedHeader{digest: h.digest(header)}
+		if !h.sha1Sunset.IsZero() && !acceptableHeader(p.digest, required) {
+			p.sha1Digest = sha1Sum(header)
+		}
+	}
+	digest := p.digest
+	ok := acceptableHeader(digest, required)
+	if !ok && p.sha1Digest != nil && acceptableHeader(p.sha1Digest, required) {
+		digest, ok, ev.SHA1 = p.sha1Digest, true, true
+	}
+	ev.HashTime = time.Since(t)
+	if !ok {
+		err := &CollisionError{Bits: leadingZeroBits(digest), Required: required}
+		if fail(err) {
+			return "", err
+		}
+	}
+	if ok {
+		if err := h.checkExcess(digest, ev); err != nil {
+			return "", err
+		}
+	}
+	t = time.Now()
+	if !cached {
+		p.parse(header, h.digest)
+		h.parsed.put(header, p)
+	}
+	// vals: [version bits date resource extension random counter]
+	ev.Bits = p.bits
+	ev.CanonicalKey = p.key
+	ev.Resource = p.vals[3]
+	ev.Extensions = p.ext
+	if p.bitsErr != nil && fail(p.bitsErr) {
+		ev.ParseTime += time.Since(t)
+		return "", p.bitsErr
+	}
+	created, err := p.created, p.dateErr
+	ev.Created = created
+	ev.ParseTime += time.Since(t)
 	// test 2 - check token is not too far in the future or expired
-	created, err := parseHashcashTime(vals[2])
 	if err != nil {
-		return false, err
+		if fail(err) {
+			return "", err
+		}
+	} else if err := h.checkTime(created, ev); err != nil && fail(err) {
+		return "", err
 	}
-	if created.After(h.future) || created.Before(h.expired) {
-		return false, ErrTimestamp
+	// test 2b - check SHA-1 headers were created before the sunset
+	if ev.SHA1 && (err != nil || !created.Before(h.sha1Sunset)) && fail(ErrSHA1Sunset) {
+		return "", ErrSHA1Sunset
 	}
 	// test 3 - check resource is valid
-	resource := vals[3]
-	if !h.validatorFunc(resource) {
-		return false, ErrResourceFail
+	if !h.validatorFunc(ev.Context, ev.Resource) && fail(ErrResourceFail) {
+		return "", ErrResourceFail
 	}
-	// test 4 - check if hash is in spent storage
-	if h.storage.Spent(hash) {
-		return false, ErrSpent
+	// test 3b - check extensions satisfy the policy
+	if h.extensions != nil {
+		err := p.extErr
+		if err == nil {
+			err = h.extensions.check(ev.Context, p.ext)
+		}
+		if err != nil && fail(ErrExtension) {
+			return "", ErrExtension
+		}
+	}
+	switch {
+	case len(errs) == 0:
+	case len(errs) == 1 || !h.strict:
+		return "", errs[0]
+	default:
+		return "", errors.Join(errs...)
+	}
+	if err := ev.Context.Err(); err != nil {
+		return "", err
+	}
+	return p.key, nil
+}
+
+// checkExcess records the zero bits of digest in ev, applying the policy for
+// digests exceeding MaxBits.
+func (h *Hashcash) checkExcess(digest []byte, ev *VerifyEvent) error {
+	ev.ZeroBits = leadingZeroBits(digest)
+	ev.Hash = hex.EncodeToString(digest)
+	if h.maxBits > 0 && ev.ZeroBits > int(h.maxBits) {
+		ev.ExcessBits = true
+		if h.excessBits == RejectExcessBits {
+			return ErrExcessBits
+		}
+	}
+	return nil
+}
+
+// checkTime checks created is neither expired nor too far in the future,
+// applying the policy for stamps created in the future.
+func (h *Hashcash) checkTime(created time.Time, ev *VerifyEvent) error {
+	now := h.now()
+	earliest, future := h.bounds(now)
+	if created.Before(earliest) {
+		return &TimestampError{Created: created, Earliest: earliest, Latest: future, Err: ErrExpired}
+	}
+	if created.After(future) {
+		return &TimestampError{Created: created, Earliest: earliest, Latest: future, Err: ErrFutureStamp}
+	}
+	if latest := now.Add(h.skew); created.After(latest) {
+		ev.FutureStamp = true
+		if h.futureStamps == RejectFutureStamps {
+			return &TimestampError{Created: created, Earliest: earliest, Latest: latest, Err: ErrFutureStamp}
+		}
+	}
+	return nil
+}
+
+// bounds returns the earliest and latest creation dates of headers accepted
+// at now, from the windows when set.
+func (h *Hashcash) bounds(now time.Time) (earliest, latest time.Time) {
+	earliest, latest = h.expired, h.future
+	if h.expiryWindow > 0 {
+		earliest = now.Add(-h.expiryWindow)
+	}
+	if h.futureWindow > 0 {
+		latest = now.Add(h.futureWindow)
+	}
+	return earliest, latest
+}
+
+// claim checks key, which passed check, is not spent and records it as
+// spent, atomically when storage implements ContextCheckAndAdder or
+// CheckAndAdder.
+func (h *Hashcash) claim(ev *VerifyEvent, key string) error {
+	if scope, ok := findScope(h.scopes, h.normalizeResource(ev.Resource)); ok {
+		return h.claimUses(ev, key, scope.Uses)
+	}
+	isSpent, ok, err := h.checkAndAdd(ev.Context, key, ev.Created)
+	if !ok {
+		isSpent, err := h.isSpent(ev.Context, key)
+		if err != nil {
+			return err
+		}
+		return h.spend(ev, key, isSpent)
+	}
+	if err != nil {
+		return err
+	}
+	if isSpent {
+		return h.replay(ev, key)
+	}
+	h.remember(ev, key)
+	return nil
+}
+
+// spend records key, which passed check, as spent. isSpent whether storage
+// already holds key.
+func (h *Hashcash) spend(ev *VerifyEvent, key string, isSpent bool) error {
+	if isSpent {
+		return h.replay(ev, key)
+	}
+	if err := h.record(ev.Context, key, ev.Created); err != nil {
+		return err
+	}
+	h.remember(ev, key)
+	return nil
+}
+
+// replay returns ErrSpent for key, which storage already holds, unless it
+// is retried by the same remote within Config.RetryWindow.
+func (h *Hashcash) replay(ev *VerifyEvent, key string) error {
+	if h.retries != nil && ev.Remote.Key != "" && h.retries.retry(key, ev.Remote.Key) {
+		return nil
 	}
-	h.storage.Add(hash)
-	return true, nil
+	return ErrSpent
 }
 
-// New creates a new Hashcash instance
+// remember records the remote which spent key, for Config.RetryWindow.
+func (h *Hashcash) remember(ev *VerifyEvent, key string) {
+	if h.retries != nil && ev.Remote.Key != "" {
+		h.retries.add(key, ev.Remote.Key)
+	}
+}
+
+// mintOnly storage of instances which only mint, recording nothing
+type mintOnly struct{}
+
+func (mintOnly) Add(string) error  { return nil }
+func (mintOnly) Spent(string) bool { return false }
+
+// newMinter creates an instance which only mints headers for res, using
+// config, NewDefaultConfig when nil, without opening storage when none is set.
+func newMinter(res *Resource, config *Config) (*Hashcash, error) {
+	if config == nil {
+		config = NewDefaultConfig()
+	}
+	c := *config
+	if c.Storage == nil && c.StorageV2 == nil {
+		c.Storage = mintOnly{}
+	}
+	return New(res, &c)
+}
+
+// New creates a new Hashcash instance. If config is nil NewDefaultConfig is
+// used.
 func New(res *Resource, config *Config) (*Hashcash, error) {
 	if res == nil {
 		return nil, ErrResourceEmpty
 	}
 	if config == nil {
-		config = DefaultConfig
+		config = NewDefaultConfig()
 	}
-	if config.Storage == nil {
-		storage, err := NewSQLite3DB()
-		if err != nil {
-			return nil, err
-		}
-		config.Storage = storage
+	if err := config.Bits.Validate(); err != nil {
+		return nil, err
+	}
+	clock := config.Now
+	if clock == nil {
+		clock = time.Now
+	}
+	// the default storage is not written back, config may be shared
+	storage := config.Storage
+	if storage == nil && config.StorageV2 == nil {
+		storage = NewMemoryStorage(nil)
 	}
 	rand, err := randomBytes(bytesToRead)
 	if err != nil {
 		return nil, err
 	}
+	resource, accept := res.Data, res.Accept
+	normalize := res.Normalize
+	if normalize != nil {
+		resource = normalize(resource)
+		accept = make([]string, len(res.Accept))
+		for i, a := range res.Accept {
+			accept[i] = normalize(a)
+		}
+	}
+	if len(res.Salt) > 0 {
+		if len(accept) == 0 && res.ValidatorFunc == nil && res.ValidatorContextFunc == nil {
+			accept = []string{resource}
+		}
+		hashed := make([]string, len(accept))
+		for i, a := range accept {
+			hashed[i] = HashResource(res.Salt, foldCase(a, res.FoldCase))
+		}
+		resource = HashResource(res.Salt, foldCase(resource, res.FoldCase))
+		accept = hashed
+		// headers carry the hashed resource, which is not normalized
+		normalize = nil
+	}
+	validator := res.ValidatorContextFunc
+	if validator == nil && (res.ValidatorFunc != nil || len(accept) == 0) {
+		validator = func(_ context.Context, s string) bool {
+			return res.ValidatorFunc(s)
+		}
+	}
+	if len(accept) > 0 {
+		validator = acceptValidator(accept, res.FoldCase, res.ConstantTime, validator)
+	}
+	var scopes []Scope
+	if len(res.Scopes) > 0 && len(res.Salt) == 0 {
+		targets := accept
+		if len(targets) == 0 {
+			targets = []string{resource}
+		}
+		scopes = make([]Scope, len(res.Scopes))
+		for i, sc := range res.Scopes {
+			if normalize != nil {
+				sc.Pattern = normalize(sc.Pattern)
+			}
+			sc.Pattern = foldCase(sc.Pattern, res.FoldCase)
+			scopes[i] = sc
+		}
+		validator = scopeValidator(scopes, targets, res.FoldCase, validator)
+	}
+	if normalize != nil && validator != nil {
+		next := validator
+		validator = func(ctx context.Context, s string) bool {
+			return next(ctx, normalize(s))
+		}
+	}
+	bits := config.Bits
+	if config.Schedule != nil {
+		bits = config.Schedule.BitsAt(clock())
+	}
+	if config.Policy != nil {
+		bits = config.Policy.Bits()
+	}
+	var retries *retryCache
+	if config.RetryWindow > 0 {
+		retries = newRetryCache(config.RetryWindow)
+	}
+	var hashers *sync.Pool
+	if config.Hasher != nil {
+		hasher := config.Hasher
+		hashers = &sync.Pool{
+			New: func() interface{} { return hasher() },
+		}
+	} else if config.Hash != 0 && config.Hash != crypto.SHA1 {
+		if !config.Hash.Available() {
+			return nil, ErrHashUnavailable
+		}
+		hash := config.Hash
+		hashers = &sync.Pool{
+			New: func() interface{} { return hash.New() },
+		}
+	}
+	var sunset time.Time
+	if hashers != nil {
+		sunset = config.SHA1Sunset
+	}
+	var parsed *parseCache
+	if config.ParseCacheTTL > 0 {
+		parsed = newParseCache(config.ParseCacheTTL)
+	}
+	now := clock()
+	window := now.Sub(config.Expired)
+	if config.ExpiryWindow > 0 {
+		window = config.ExpiryWindow
+	}
+	amplification := config.AmplificationFactor
+	if amplification <= 0 {
+		amplification = 1
+	}
+	var issued *issuance
+	if config.MaxChallenges > 0 || config.MaxChallengeBytes > 0 {
+		issued = newIssuance(config)
+	}
+	onProgress := config.OnProgressContext
+	if onProgress == nil && config.OnProgress != nil {
+		fn := config.OnProgress
+		onProgress = func(_ context.Context, attempts uint64, elapsed time.Duration) {
+			fn(attempts, elapsed)
+		}
+	}
+	progressEvery := config.ProgressInterval
+	if progressEvery <= 0 {
+		progressEvery = defaultProgressInterval
+	}
 	return &Hashcash{
 		version:       1,
-		bits:          config.Bits,
-		created:       time.Now(),
-		resource:      res.Data,
-		validatorFunc: res.ValidatorFunc,
+		bits:          bits,
+		schedule:      config.Schedule,
+		policy:        config.Policy,
+		created:       now,
+		resource:      resource,
+		validatorFunc: validator,
 		extension:     "",
 		rand:          base64EncodeBytes(rand),
 		counter:       1,
+		counterStart:  1,
 		expired:       config.Expired,
 		future:        config.Future,
-		storage:       config.Storage,
+		now:           clock,
+		skew:          config.Skew,
+		futureStamps:  config.FutureStamps,
+		storage:       storage,
+		store:         config.StorageV2,
+		window:        window,
+		expiryWindow:  config.ExpiryWindow,
+		futureWindow:  config.FutureWindow,
+		name:          config.Name,
+		onVerify:      config.OnVerify,
+		reputation:    config.Reputation,
+		accounting:    config.Accounting,
+		audit:         config.Audit,
+		onProgress:    onProgress,
+		progressEvery: progressEvery,
+		budget:        config.Budget,
+		maxChallenge:  config.MaxChallengeSize,
+		amplification: amplification,
+		issued:        issued,
+		retries:       retries,
+		parsed:        parsed,
+		extensions:    config.Extensions,
+		hashers:       hashers,
+		sha1Sunset:    sunset,
+		maxBits:       config.MaxBits,
+		excessBits:    config.ExcessBits,
+		strict:        config.Strict,
+		constantTime:  res.ConstantTime,
+		foldCase:      res.FoldCase,
+		normalize:     normalize,
+		scopes:        scopes,
 	}, nil
 }
 
-// acceptableHeader determines if the string 'hash' is prefixed with 'n',
-// 'char' characters.
-func acceptableHeader(hash string, char rune, n int) bool {
-	for _, val := range hash[:n] {
-		if val != char {
+// digest returns the digest of header with Config.Hash.
+func (h *Hashcash) digest(header string) []byte {
+	if h.hashers == nil {
+		return sha1Sum(header)
+	}
+	hash := h.hashers.Get().(hash.Hash)
+	defer h.hashers.Put(hash)
+	hash.Reset()
+	io.WriteString(hash, header)
+	return hash.Sum(nil)
+}
+
+// requiredBits returns the bits required of headers verified now.
+func (h *Hashcash) requiredBits() Bits {
+	if h.policy != nil {
+		return h.policy.Bits()
+	}
+	if h.schedule != nil {
+		return h.schedule.Required(h.now())
+	}
+	return h.bits
+}
+
+// HashResource returns the hashed form of resource carried by headers minted
+// with Resource.Salt, the hex encoded sha256 digest of salt followed by
+// resource.
+func HashResource(salt []byte, resource string) string {
+	h := sha256.New()
+	h.Write(salt)
+	io.WriteString(h, resource)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// foldCase lower cases s if fold is set.
+func foldCase(s string, fold bool) string {
+	if fold {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// acceptValidator returns a validator accepting resources in accept, which
+// must also pass next if it is not nil. With constantTime every entry of
+// accept is compared in constant time, rather than looked up in a set.
+func acceptValidator(accept []string, foldCase, constantTime bool, next func(context.Context, string) bool) func(context.Context, string) bool {
+	set := make(map[string]struct{}, len(accept))
+	for _, a := range accept {
+		if foldCase {
+			a = strings.ToLower(a)
+		}
+		set[a] = struct{}{}
+	}
+	return func(ctx context.Context, s string) bool {
+		key := s
+		if foldCase {
+			key = strings.ToLower(s)
+		}
+		var ok bool
+		if constantTime {
+			found := 0
+			for a := range set {
+				found |= subtle.ConstantTimeCompare([]byte(a), []byte(key))
+			}
+			ok = found == 1
+			// run next regardless, so its cost does not reveal the match.
+			valid := next == nil || next(ctx, s)
+			return ok && valid
+		}
+		if _, ok = set[key]; !ok {
+			return false
+		}
+		return next == nil || next(ctx, s)
+	}
+}
+
+// acceptableHeader determines if the digest has at least 'bits' leading zero
+// bits. Whole bytes are checked first, so most digests are rejected on their
+// first byte without counting bits.
+func acceptableHeader(digest []byte, bits Bits) bool {
+	n := int(bits / 8)
+	if n > len(digest) {
+		return false
+	}
+	for _, c := range digest[:n] {
+		if c != 0 {
 			return false
 		}
 	}
+	if r := uint(bits % 8); r != 0 {
+		return n < len(digest) && digest[n]>>(8-r) == 0
+	}
 	return true
 }
 
+// CanonicalKey returns the stable identifier of token, the hex encoded SHA-1
+// digest of its canonical form. It is the key under which instances minting
+// and verifying with SHA-1 record the token in spent storage and caches, and
+// report it in VerifyEvent.CanonicalKey and MintStats.CanonicalKey, so
+// external log pipelines can deduplicate events about the same token as this
+// package does. Instances set with Config.Hash or Config.Hasher key tokens
+// with that algorithm instead, see Hashcash.SpentKey. If token is not in a
+// valid format, ErrInvalidHeader error is returned.
+func CanonicalKey(token string) (string, error) {
+	vals := strings.Split(token, ":")
+	if len(vals) != hashcashV1Length {
+		return "", ErrInvalidHeader
+	}
+	return spentKey(vals, sha1Sum), nil
+}
+
+// SpentKey returns the key under which header is recorded in spent storage
+// once verified by an instance minting and verifying with SHA-1, e.g. to look
+// up or remove a disputed header with Admin. It is the same as CanonicalKey.
+func SpentKey(header string) (string, error) {
+	return CanonicalKey(header)
+}
+
+// SpentKey returns the key under which h records header in spent storage
+// once verified, and reports it in VerifyEvent.CanonicalKey and
+// MintStats.CanonicalKey, the hex encoded digest of its canonical form with
+// Config.Hash or Config.Hasher. If header is not in a valid format,
+// ErrInvalidHeader error is returned.
+func (h *Hashcash) SpentKey(header string) (string, error) {
+	vals := strings.Split(header, ":")
+	if len(vals) != hashcashV1Length {
+		return "", ErrInvalidHeader
+	}
+	return spentKey(vals, h.digest), nil
+}
+
+// spentKey computes the key under which the header fields vals are recorded
+// in spent storage, the hex encoded digest with sum of their canonical form.
+// The random and counter fields are decoded and re-encoded, so re-encodings
+// of the same solution (e.g. with or without base64 padding) share a key. For
+// headers minted by this package the key is the hex encoded digest of the
+// header.
+func spentKey(vals []string, sum func(string) []byte) string {
+	canon := append([]string(nil), vals...)
+	// vals: [version bits date resource extension random counter]
+	for _, i := range []int{5, 6} {
+		if b, ok := base64DecodeAny(vals[i]); ok {
+			canon[i] = base64EncodeBytes(b)
+		}
+	}
+	return hex.EncodeToString(sum(strings.Join(canon, ":")))
+}
+
 // createHeader creates a new hashcash header
 func (h *Hashcash) createHeader() string {
-	return fmt.Sprintf("%d:%d:%s:%s:%s:%s:%s", h.version,
-		h.bits,
-		h.created.Format(timeFormat),
-		h.resource,
-		h.extension,
-		h.rand,
-		base64EncodeInt(h.counter))
+	return h.headerAt(h.counter)
+}
+
+// headerAt creates a hashcash header with counter. It is called for every
+// attempt, so it concatenates rather than formatting with fmt, which is slow
+// and relies on reflection unavailable on small TinyGo targets.
+func (h *Hashcash) headerAt(counter uint64) string {
+	return strconv.Itoa(h.version) + ":" +
+		h.bits.String() + ":" +
+		h.created.UTC().Format(timeFormat) + ":" +
+		h.resource + ":" +
+		h.extension + ":" +
+		h.rand + ":" +
+		base64EncodeUint(counter)
 }
 
 // parseHashcashTime parses datetime in hashcash format
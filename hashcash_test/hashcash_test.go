@@ -1,10 +1,22 @@
 package hashcash_test
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -146,7 +158,7 @@ func TestHashcashInvalidHeader(t *testing.T) {
 		t.Errorf("%v\n", err)
 	}
 	_, err = hc.Verify(invalidToken)
-	if err != hashcash.ErrInvalidHeader {
+	if !errors.Is(err, hashcash.ErrInvalidHeader) {
 		t.Errorf("%v\n", err)
 	}
 }
@@ -163,7 +175,7 @@ func TestHashcashNoCollsion(t *testing.T) {
 		t.Errorf("%v\n", err)
 	}
 	_, err = hc.Verify(noCollisionToken)
-	if err != hashcash.ErrNoCollision {
+	if !errors.Is(err, hashcash.ErrNoCollision) {
 		t.Errorf("%v\n", err)
 	}
 }
@@ -180,7 +192,7 @@ func TestHashcashInvalidTimestamp(t *testing.T) {
 		t.Errorf("%v\n", err)
 	}
 	_, err = hc.Verify(expiredToken)
-	if err != hashcash.ErrTimestamp {
+	if !errors.Is(err, hashcash.ErrTimestamp) {
 		t.Errorf("%v\n", err)
 	}
 }
@@ -218,3 +230,3313 @@ func TestHashcashSpent(t *testing.T) {
 		t.Errorf("%v\n", err)
 	}
 }
+
+func TestOnVerify(t *testing.T) {
+	var events []hashcash.VerifyEvent
+	config := *testConfig
+	config.Name = "tenant-a"
+	config.OnVerify = func(ev hashcash.VerifyEvent) {
+		events = append(events, ev)
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Errorf("%v\n", err)
+	}
+	remote := hashcash.Remote{Key: "127.0.0.1"}
+	_, err = hc.VerifyRemote(expiredToken, remote)
+	if !errors.Is(err, hashcash.ErrTimestamp) {
+		t.Errorf("%v\n", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events want 1\n", len(events))
+	}
+	ev := events[0]
+	if ev.Valid || !errors.Is(ev.Err, hashcash.ErrTimestamp) {
+		t.Errorf("event outcome got %v %v\n", ev.Valid, ev.Err)
+	}
+	if ev.Remote.Key != remote.Key {
+		t.Errorf("event remote got %q want %q\n", ev.Remote.Key, remote.Key)
+	}
+	if ev.Instance != "tenant-a" {
+		t.Errorf("event instance got %q\n", ev.Instance)
+	}
+	if ev.Resource != "foo" || ev.Bits != 20 || ev.Hash == "" {
+		t.Errorf("event missing parsed header fields: %+v\n", ev)
+	}
+}
+
+// leadingZeroBits counts the leading zero bits of the sha1 digest of header.
+func leadingZeroBits(header string) int {
+	digest := sha1.Sum([]byte(header))
+	n := 0
+	for _, b := range digest {
+		for i := 7; i >= 0; i-- {
+			if b&(1<<uint(i)) != 0 {
+				return n
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func TestComputeBits(t *testing.T) {
+	for _, bits := range []hashcash.Bits{1, 7, 20} {
+		config := *testConfig
+		config.Bits = bits
+		hc, err := hashcash.New(
+			&hashcash.Resource{
+				Data:          "someone@gmail.com",
+				ValidatorFunc: func(res string) bool { return true },
+			},
+			&config,
+		)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		solution, err := hc.Compute()
+		for err == hashcash.ErrSolutionFail {
+			solution, err = hc.Compute()
+		}
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if got := leadingZeroBits(solution); got < int(bits) {
+			t.Errorf("bits %d: got %d leading zero bits\n", bits, got)
+		}
+		valid, err := hc.Verify(solution)
+		if !valid || err != nil {
+			t.Errorf("bits %d: %v\n", bits, err)
+		}
+	}
+}
+
+func TestVerifyBits33(t *testing.T) {
+	const token = "1:33:261015:someone@gmail.com::aGFzaGNhc2g=:MzExMzc4NDE1"
+	config := *testConfig
+	config.Bits = 33
+	config.Expired = time.Time{}
+	config.Future = time.Now().AddDate(100, 0, 0)
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	_, err = hc.Verify(createValidTestToken(false))
+	if !errors.Is(err, hashcash.ErrNoCollision) {
+		t.Errorf("20 bit token at 33 bits: %v\n", err)
+	}
+	valid, err := hc.Verify(token)
+	if !valid || err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestInvalidBits(t *testing.T) {
+	config := *testConfig
+	config.Bits = 65
+	_, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != hashcash.ErrInvalidBits {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestReputationBounded(t *testing.T) {
+	rep := hashcash.NewReputation(&hashcash.ReputationConfig{
+		Threshold: 100,
+		Window:    time.Minute,
+		BlockFor:  time.Minute,
+		MaxKeys:   2,
+	})
+	rep.Record("a", hashcash.ErrSpent)
+	rep.Record("b", hashcash.ErrSpent)
+	rep.Record("a", hashcash.ErrSpent)
+	// b failed least recently, so it is forgotten
+	rep.Record("c", hashcash.ErrSpent)
+	if rep.Len() != 2 || rep.Score("a") != 10 || rep.Score("b") != 0 || rep.Score("c") != 5 {
+		t.Errorf("%d keys, scores %d %d %d\n", rep.Len(), rep.Score("a"), rep.Score("b"), rep.Score("c"))
+	}
+	// expired keys are swept as failures are recorded
+	rep = hashcash.NewReputation(&hashcash.ReputationConfig{
+		Threshold: 10,
+		Window:    time.Millisecond,
+		BlockFor:  time.Millisecond,
+	})
+	for _, key := range []string{"a", "b", "c"} {
+		rep.Record(key, hashcash.ErrSpent)
+	}
+	time.Sleep(5 * time.Millisecond)
+	rep.Record("d", hashcash.ErrSpent)
+	if rep.Len() != 1 {
+		t.Errorf("%d keys left\n", rep.Len())
+	}
+}
+
+func TestReputationBlocks(t *testing.T) {
+	config := *testConfig
+	config.Reputation = hashcash.NewReputation(&hashcash.ReputationConfig{
+		Threshold: 6,
+		Window:    time.Minute,
+		BlockFor:  time.Minute,
+	})
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	remote := hashcash.Remote{Key: "10.0.0.1"}
+	for i := 0; i < 2; i++ {
+		_, err = hc.VerifyRemote(noCollisionToken, remote)
+		if !errors.Is(err, hashcash.ErrNoCollision) {
+			t.Errorf("%v\n", err)
+		}
+	}
+	if !config.Reputation.ShouldBlock(remote.Key) {
+		t.Errorf("remote not blocked after repeated failures\n")
+	}
+	_, err = hc.VerifyRemote(noCollisionToken, remote)
+	if err != hashcash.ErrBlocked {
+		t.Errorf("%v\n", err)
+	}
+	if config.Reputation.ShouldBlock("10.0.0.2") {
+		t.Errorf("unrelated remote blocked\n")
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.Accounting = hashcash.NewAccounting(nil)
+	remote := hashcash.Remote{Key: "10.0.0.1"}
+	for i := 0; i < 3; i++ {
+		// a fresh instance mints a fresh header
+		hc, err := hashcash.New(
+			&hashcash.Resource{
+				Data:          "someone@gmail.com",
+				ValidatorFunc: func(res string) bool { return true },
+			},
+			&config,
+		)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		stamp, err := hc.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if valid, err := hc.VerifyRemote(stamp, remote); !valid {
+			t.Errorf("%v\n", err)
+		}
+		// invalid and spent headers are not credited
+		hc.VerifyRemote(stamp, remote)
+		hc.VerifyRemote(noCollisionToken, remote)
+	}
+	if bits := config.Accounting.BitsSpent(remote.Key, time.Hour); bits != 24 {
+		t.Errorf("bits spent %d want 24\n", bits)
+	}
+	if work := config.Accounting.WorkSpent(remote.Key, time.Hour); work != 3*256 {
+		t.Errorf("work spent %v want 768\n", work)
+	}
+	if bits := config.Accounting.BitsSpent("10.0.0.2", time.Hour); bits != 0 {
+		t.Errorf("unrelated remote credited %d bits\n", bits)
+	}
+}
+
+func TestCanonicalKey(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.Audit = true
+	var ev hashcash.VerifyEvent
+	config.OnVerify = func(e hashcash.VerifyEvent) { ev = e }
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	key, err := hashcash.CanonicalKey(stamp)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if ev.CanonicalKey != key {
+		t.Errorf("event key %s want %s\n", ev.CanonicalKey, key)
+	}
+	if stats := hc.MintStats(); len(stats) != 1 || stats[0].CanonicalKey != key {
+		t.Errorf("mint stats %v want key %s\n", stats, key)
+	}
+	// re-encodings of the same solution share a key
+	padded, err := hashcash.CanonicalKey("1:20:240101:foo::AAAAAAAAAAA=:AA==")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if raw, _ := hashcash.CanonicalKey("1:20:240101:foo::AAAAAAAAAAA:AA"); raw != padded {
+		t.Errorf("keys differ %s %s\n", raw, padded)
+	}
+	if _, err := hashcash.CanonicalKey(invalidToken); err != hashcash.ErrInvalidHeader {
+		t.Errorf("%v\n", err)
+	}
+	if sha1Key, _ := hc.SpentKey(stamp); sha1Key != key {
+		t.Errorf("instance key %s want %s\n", sha1Key, key)
+	}
+	// stamps are keyed with the configured hash, not SHA-1
+	storage := hashcash.NewMemoryStorage(nil)
+	config.Storage = storage
+	config.Hasher = sha256.New
+	hc, err = hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if stamp, err = hc.Compute(); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	key, err = hc.SpentKey(stamp)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if sum := sha256.Sum256([]byte(stamp)); key != hex.EncodeToString(sum[:]) {
+		t.Errorf("key %s is not the sha256 digest\n", key)
+	}
+	if ev.CanonicalKey != key || !storage.Spent(key) {
+		t.Errorf("event key %s want %s\n", ev.CanonicalKey, key)
+	}
+	if sha1Key, _ := hashcash.CanonicalKey(stamp); storage.Spent(sha1Key) {
+		t.Errorf("stamp recorded under its sha1 key\n")
+	}
+}
+
+func TestParse(t *testing.T) {
+	stamp, err := hashcash.Parse(noCollisionToken)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	want := hashcash.Stamp{
+		Version:  1,
+		Bits:     20,
+		Date:     "180311205026",
+		Resource: "someone@gmail.com",
+		Rand:     "2M6FmM7eRvw=",
+		Counter:  "MjU5ODg5",
+	}
+	if *stamp != want {
+		t.Errorf("got %+v want %+v\n", *stamp, want)
+	}
+	if created, err := stamp.Created(); err != nil || !created.Equal(time.Date(2018, 3, 11, 20, 50, 26, 0, time.UTC)) {
+		t.Errorf("created %v: %v\n", created, err)
+	}
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{invalidToken, hashcash.ErrInvalidHeader},
+		{"1:x:180311:foo::a:b", hashcash.ErrInvalidHeader},
+		{"1:99:180311:foo::a:b", hashcash.ErrInvalidHeader},
+		{"1:20:181311:foo::a:b", hashcash.ErrInvalidHeader},
+		{"1:20:18031:foo::a:b", hashcash.ErrInvalidHeader},
+		{"9:20:180311:foo::a:b", hashcash.ErrUnsupportedVersion},
+	}
+	for _, test := range tests {
+		if _, err := hashcash.Parse(test.token); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v want %v\n", test.token, err, test.err)
+		}
+	}
+}
+
+func TestComputeStamp(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Expired = time.Time{}
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp := &hashcash.Stamp{
+		Bits:      8,
+		Date:      "240101",
+		Resource:  "someone@gmail.com",
+		Extension: "app=test",
+	}
+	header, err := hc.ComputeStamp(context.Background(), stamp)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if header != stamp.String() {
+		t.Errorf("header %s want %s\n", header, stamp.String())
+	}
+	parsed, err := hashcash.Parse(header)
+	if err != nil || *parsed != *stamp {
+		t.Errorf("parsed %+v want %+v: %v\n", parsed, stamp, err)
+	}
+	if valid, err := hc.Verify(header); !valid {
+		t.Errorf("%v\n", err)
+	}
+	invalid := &hashcash.Stamp{Bits: 8, Resource: "some:one"}
+	if _, err := hc.ComputeStamp(context.Background(), invalid); !errors.Is(err, hashcash.ErrInvalidHeader) {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestPolicyCache(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bits   hashcash.Bits = 8
+		outage error
+	)
+	policy := hashcash.NewPolicyCache(func(ctx context.Context) (hashcash.Bits, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return bits, outage
+	}, &hashcash.PolicyCacheConfig{TTL: 10 * time.Millisecond, Fallback: 12})
+	if b := policy.Bits(); b != 12 {
+		t.Errorf("bits %d before fetch want fallback 12\n", b)
+	}
+	if err := policy.Refresh(context.Background()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	config.Policy = policy
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	// stale bits are served while the source is down
+	mu.Lock()
+	outage = errors.New("policy source down")
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	if b := policy.Bits(); b != 8 {
+		t.Errorf("bits %d during outage want 8\n", b)
+	}
+	mu.Lock()
+	bits, outage = 10, nil
+	mu.Unlock()
+	for deadline := time.Now().Add(time.Second); policy.Bits() != 10; {
+		if time.Now().After(deadline) {
+			t.Fatalf("bits not refreshed\n")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	report, err := hashcash.Benchmark(context.Background(), &hashcash.BenchmarkConfig{
+		Duration: 50 * time.Millisecond,
+		Workers:  2,
+		MinBits:  8,
+		MaxBits:  12,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if report.HashRate <= 0 || report.ParallelHashRate <= 0 || report.VerifyRate <= 0 {
+		t.Errorf("report %+v\n", report)
+	}
+	if len(report.SolveTimes) != 5 || report.SolveTimes[0].Bits != 8 || report.SolveTimes[4].Attempts != 4096 {
+		t.Errorf("solve times %+v\n", report.SolveTimes)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := hashcash.Benchmark(ctx, nil); err != context.Canceled {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	hc, err := hashcash.NewWithOptions("someone@gmail.com",
+		hashcash.WithBits(8),
+		hashcash.WithStorage(&MockStorage{}),
+		hashcash.WithExpiryWindow(28*24*time.Hour),
+		hashcash.WithHasher(sha256.New),
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// the same algorithm selected by Config.Hash verifies the stamp
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.Hash = crypto.SHA256
+	verifier, err := hashcash.New(&hashcash.Resource{Accept: []string{"someone@gmail.com"}}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := verifier.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	other, err := hashcash.NewWithOptions("other@gmail.com",
+		hashcash.WithBits(8),
+		hashcash.WithStorage(&MockStorage{}),
+		hashcash.WithHasher(sha256.New),
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	otherStamp, err := other.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// only stamps minted for the resource are accepted by default
+	if _, err := other.Verify(stamp); err != hashcash.ErrResourceFail {
+		t.Errorf("%v\n", err)
+	}
+	if valid, err := other.Verify(otherStamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestNewDefaultConfig(t *testing.T) {
+	config := hashcash.NewDefaultConfig()
+	if config.Bits != 20 || config.Storage == nil {
+		t.Errorf("config %+v\n", config)
+	}
+	if config.FutureWindow != 48*time.Hour || config.ExpiryWindow != 28*24*time.Hour {
+		t.Errorf("windows %v %v\n", config.FutureWindow, config.ExpiryWindow)
+	}
+	// windows are relative to the time of each check, not fixed
+	if !config.Future.IsZero() || !config.Expired.IsZero() {
+		t.Errorf("fixed window %v %v\n", config.Future, config.Expired)
+	}
+	// each call has its own storage
+	if hashcash.NewDefaultConfig().Storage == config.Storage {
+		t.Errorf("storage shared between configs\n")
+	}
+}
+
+// failingComponent component which fails to start
+type failingComponent struct{}
+
+func (failingComponent) Start(context.Context) error { return errors.New("no start") }
+func (failingComponent) Close() error                { return nil }
+
+func TestRuntime(t *testing.T) {
+	storage := hashcash.NewMemoryStorage(nil)
+	storage.Add("old")
+	var (
+		block   = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	defer close(block)
+	rt := hashcash.NewRuntime(&hashcash.RuntimeConfig{ShutdownTimeout: 50 * time.Millisecond})
+	rt.Add("purge", hashcash.PurgeLoop(storage, 0, 5*time.Millisecond))
+	rt.Add("worker", hashcash.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	}))
+	// ignores its context
+	rt.Add("stuck", hashcash.RunFunc(func(ctx context.Context) error {
+		<-block
+		return nil
+	}))
+	if err := rt.Start(context.Background()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for deadline := time.Now().Add(time.Second); storage.Spent("old"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("entry not purged\n")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err := rt.Close()
+	if !errors.Is(err, hashcash.ErrShutdownTimeout) || !strings.Contains(err.Error(), "stuck") {
+		t.Errorf("%v\n", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("worker not stopped\n")
+	}
+	// components started before a failure are closed
+	stopped = make(chan struct{})
+	rt = hashcash.NewRuntime(nil)
+	rt.Add("worker", hashcash.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	}))
+	rt.Add("failing", failingComponent{})
+	if err := rt.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("%v\n", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("worker not stopped after failed start\n")
+	}
+}
+
+func TestPreVerify(t *testing.T) {
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp := func(bits hashcash.Bits, created time.Time) string {
+		s := &hashcash.Stamp{
+			Version:  1,
+			Bits:     bits,
+			Date:     created.UTC().Format("060102150405"),
+			Resource: "someone@gmail.com",
+			Rand:     "AAAAAAAAAAA=",
+			Counter:  "MA==",
+		}
+		return s.String()
+	}
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", validToken, nil},
+		// no collision is only found by Verify
+		{"no collision", stamp(20, time.Now()), nil},
+		{"malformed", invalidToken, hashcash.ErrInvalidHeader},
+		{"expired", expiredToken, hashcash.ErrExpired},
+		{"future", stamp(20, time.Now().AddDate(0, 0, 7)), hashcash.ErrFutureStamp},
+		{"bits", stamp(8, time.Now()), hashcash.ErrInsufficientBits},
+	}
+	for _, test := range tests {
+		if err := hc.PreVerify(test.token); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v want %v\n", test.name, err, test.err)
+		}
+	}
+	if _, err := hc.Verify(stamp(20, time.Now())); !errors.Is(err, hashcash.ErrNoCollision) {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// stands in for idna.Lookup.ToASCII
+	toASCII := func(domain string) (string, error) {
+		if domain == "bücher.example" {
+			return "xn--bcher-kva.example", nil
+		}
+		if strings.ContainsFunc(domain, func(r rune) bool { return r > 127 }) {
+			return "", errors.New("unsupported domain")
+		}
+		return domain, nil
+	}
+	normalize := hashcash.ChainNormalizers(hashcash.FoldASCII, hashcash.DomainNormalizer(toASCII))
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	minter, err := hashcash.New(&hashcash.Resource{Data: "Someone@Bücher.Example", Normalize: normalize}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	normalized, err := minter.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if stamp, _ := hashcash.Parse(normalized); stamp.Resource != "someone@xn--bcher-kva.example" {
+		t.Errorf("minted resource %s\n", stamp.Resource)
+	}
+	// minted without normalization
+	raw, err := hashcash.New(&hashcash.Resource{Data: "SOMEONE@bücher.example"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	unnormalized, err := raw.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	verifier, err := hashcash.New(
+		&hashcash.Resource{Accept: []string{"someone@bücher.example"}, Normalize: normalize},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for _, stamp := range []string{normalized, unnormalized} {
+		r, err := verifier.VerifyResult(context.Background(), stamp, hashcash.Remote{})
+		if err != nil {
+			t.Errorf("%s: %v\n", stamp, err)
+		} else if r.NormalizedResource != "someone@xn--bcher-kva.example" {
+			t.Errorf("normalized resource %s\n", r.NormalizedResource)
+		}
+	}
+	if s := hashcash.FoldASCII("ÄBc"); s != "Äbc" {
+		t.Errorf("folded %s\n", s)
+	}
+}
+
+func TestDiagnosticErrors(t *testing.T) {
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	_, err = hc.Verify(noCollisionToken)
+	var collision *hashcash.CollisionError
+	if !errors.As(err, &collision) || collision.Required != 20 || collision.Bits >= 20 {
+		t.Errorf("%v\n", err)
+	}
+	_, err = hc.Verify(expiredToken)
+	var timestamp *hashcash.TimestampError
+	if !errors.As(err, &timestamp) || !errors.Is(err, hashcash.ErrTimestamp) {
+		t.Fatalf("%v\n", err)
+	}
+	if !timestamp.Created.Equal(time.Date(2004, 8, 6, 0, 0, 0, 0, time.UTC)) ||
+		!timestamp.Earliest.Equal(config.Expired) || !timestamp.Latest.Equal(config.Future) {
+		t.Errorf("%+v\n", timestamp)
+	}
+}
+
+func TestElected(t *testing.T) {
+	var (
+		storage = hashcash.NewMemoryStorage(nil)
+		mu      sync.Mutex
+		running = make(map[string]bool)
+	)
+	leaders := func() (names []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for name, ok := range running {
+			if ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	elect := func(name string) hashcash.Component {
+		job := hashcash.RunFunc(func(ctx context.Context) error {
+			mu.Lock()
+			running[name] = true
+			mu.Unlock()
+			<-ctx.Done()
+			mu.Lock()
+			running[name] = false
+			mu.Unlock()
+			return ctx.Err()
+		})
+		return hashcash.Elected(storage, &hashcash.LeaseConfig{
+			Name:   "purge",
+			Holder: name,
+			TTL:    30 * time.Millisecond,
+		}, job)
+	}
+	waitFor := func(want string) {
+		for deadline := time.Now().Add(time.Second); ; {
+			if l := leaders(); len(l) == 1 && l[0] == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("leaders %v, want %s\n", leaders(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	a, b := elect("a"), elect("b")
+	a.Start(context.Background())
+	waitFor("a")
+	b.Start(context.Background())
+	defer b.Close()
+	time.Sleep(50 * time.Millisecond)
+	if l := leaders(); len(l) != 1 || l[0] != "a" {
+		t.Errorf("leaders %v after renewals, want a\n", l)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	// released on close, so b takes over at its next renewal
+	waitFor("b")
+}
+
+func TestScope(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	var uses []int
+	config.OnVerify = func(ev hashcash.VerifyEvent) { uses = append(uses, ev.ScopeUse) }
+	minter, err := hashcash.New(&hashcash.Resource{Data: "api.example.com/*"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	token, err := minter.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	verify := func(resource string) error {
+		hc, err := hashcash.New(&hashcash.Resource{
+			Accept: []string{resource},
+			Scopes: []hashcash.Scope{{Pattern: "API.example.com/*", Uses: 3}},
+			// patterns are folded with the resources
+			FoldCase: true,
+		}, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		_, err = hc.Verify(token)
+		return err
+	}
+	if err := verify("other.example.com/v1"); err != hashcash.ErrResourceFail {
+		t.Errorf("uncovered resource: %v\n", err)
+	}
+	for _, resource := range []string{"api.example.com/v1/comments", "api.example.com/v1/users", "api.example.com/v1/comments"} {
+		if err := verify(resource); err != nil {
+			t.Errorf("%s: %v\n", resource, err)
+		}
+	}
+	if err := verify("api.example.com/v2"); err != hashcash.ErrSpent {
+		t.Errorf("uses not exhausted: %v\n", err)
+	}
+	if want := []int{0, 1, 2, 3, 0}; fmt.Sprint(uses) != fmt.Sprint(want) {
+		t.Errorf("uses %v, want %v\n", uses, want)
+	}
+	if key, _ := hashcash.CanonicalKey(token); !config.Storage.Spent(key) {
+		t.Errorf("exhausted stamp not spent\n")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	if bits := hashcash.Calibrate(0); bits != 0 {
+		t.Errorf("got %d bits for no time\n", bits)
+	}
+	bits := hashcash.Calibrate(time.Second)
+	// from 256 to 2^40 headers a second
+	if bits < 8 || bits > 40 {
+		t.Errorf("got %d bits for a second\n", bits)
+	}
+}
+
+// slowHash hash taking at least 10µs per sum
+type slowHash struct{ hash.Hash }
+
+func (s slowHash) Sum(b []byte) []byte {
+	time.Sleep(10 * time.Microsecond)
+	return s.Hash.Sum(b)
+}
+
+func TestHashRate(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	plain, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config.Hasher = func() hash.Hash { return slowHash{sha256.New()} }
+	slow, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	fast, slower := plain.HashRate(50*time.Millisecond), slow.HashRate(50*time.Millisecond)
+	if fast <= 0 || slower <= 0 || slower >= fast {
+		t.Errorf("got %.0f headers a second with SHA-1 and %.0f with a slow hasher\n", fast, slower)
+	}
+}
+
+func TestWithStorageV2(t *testing.T) {
+	hc, err := hashcash.NewWithOptions("someone@gmail.com",
+		hashcash.WithBits(8),
+		hashcash.WithStorageV2(hashcash.AdaptStorage(hashcash.NewMemoryStorage(nil))),
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.Verify(stamp); err != hashcash.ErrSpent {
+		t.Errorf("replayed stamp got %v\n", err)
+	}
+}
+
+func TestPredictedSolveTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet")
+	wallet, err := hashcash.OpenWallet(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, ok := wallet.PredictedSolveTime(20); ok {
+		t.Errorf("solve time predicted without history\n")
+	}
+	// 1<<16 headers a second at 16 bits, 1<<18 at 20 bits
+	if err := wallet.RecordSolve(16, 1<<17, 2*time.Second); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := wallet.RecordSolve(20, 1<<18, time.Second); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	wallet, err = hashcash.OpenWallet(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	tests := []struct {
+		bits hashcash.Bits
+		want time.Duration
+	}{
+		{16, time.Second},
+		{20, 4 * time.Second},
+		// 3<<17 headers in 3 seconds across levels
+		{17, time.Second},
+		{64, math.MaxInt64},
+	}
+	for _, test := range tests {
+		if d, ok := wallet.PredictedSolveTime(test.bits); !ok || d != test.want {
+			t.Errorf("%d bits predicted %v want %v\n", test.bits, d, test.want)
+		}
+	}
+}
+
+func TestOnProgress(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reports []uint64
+		last    time.Duration
+	)
+	config := *testConfig
+	config.Bits = 40
+	config.Storage = &MockStorage{}
+	config.ProgressInterval = 10 * time.Millisecond
+	config.OnProgress = func(attempts uint64, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if elapsed < last {
+			t.Errorf("elapsed went back from %v to %v\n", last, elapsed)
+		}
+		reports, last = append(reports, attempts), elapsed
+	}
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := hc.ComputeContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("%v\n", err)
+	}
+	mu.Lock()
+	if len(reports) < 2 || len(reports) > 11 {
+		t.Errorf("got %d reports in 100ms every 10ms\n", len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] <= reports[i-1] {
+			t.Errorf("attempts went back from %d to %d\n", reports[i-1], reports[i])
+		}
+	}
+	reports, last = nil, 0
+	mu.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := hc.ComputeParallel(ctx, 2); err != context.DeadlineExceeded {
+		t.Fatalf("%v\n", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 2 {
+		t.Errorf("got %d reports from parallel search\n", len(reports))
+	}
+	// OnProgressContext receives the context of the search in place of
+	// OnProgress
+	type key struct{}
+	var got interface{}
+	config.OnProgressContext = func(ctx context.Context, attempts uint64, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = ctx.Value(key{})
+	}
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	reports = nil
+	mu.Unlock()
+	ctx, cancel = context.WithTimeout(context.WithValue(context.Background(), key{}, "req-1"), 50*time.Millisecond)
+	defer cancel()
+	if _, err := hc.ComputeContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("%v\n", err)
+	}
+	mu.Lock()
+	if got != "req-1" || len(reports) != 0 {
+		t.Errorf("context value %v, %d reports to OnProgress\n", got, len(reports))
+	}
+}
+
+func TestComputeResult(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.Audit = true
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	r, err := hc.ComputeResult(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stats := hc.MintStats()
+	if r.Header == "" || r.Bits != 8 || r.Elapsed <= 0 || r.Attempts != stats[0].Attempts {
+		t.Errorf("got %+v, audit %+v\n", r, stats[0])
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config.Bits = 40
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	r, err = hc.ComputeResult(ctx)
+	if err != context.Canceled || r.Header != "" || r.Attempts == 0 {
+		t.Errorf("canceled search got %+v %v\n", r, err)
+	}
+}
+
+func TestPasses(t *testing.T) {
+	passes := hashcash.NewPasses(&hashcash.PassConfig{Requests: 2, TTL: 80 * time.Millisecond})
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.OnVerify = passes.OnVerify
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Accept: []string{"someone@gmail.com"}}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if ok, err := passes.Use("192.0.2.1"); ok || err != nil {
+		t.Errorf("pass used before work was proven: %v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.VerifyRemote(stamp, hashcash.Remote{Key: "192.0.2.1"}); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, err := passes.Use("192.0.2.1"); ok != (i < 2) || err != nil {
+			t.Errorf("use %d got %v %v\n", i+1, ok, err)
+		}
+	}
+	if ok, _ := passes.Use("192.0.2.2"); ok {
+		t.Errorf("pass used by another key\n")
+	}
+	if err := passes.Grant("192.0.2.3"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// passes last up to an eighth longer than TTL
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := passes.Use("192.0.2.3"); ok {
+		t.Errorf("expired pass used\n")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	config := *testConfig
+	config.Bits = 40
+	config.Storage = &MockStorage{}
+	config.Budget = hashcash.Budget{Attempts: 5000}
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	r, err := hc.ComputeResult(context.Background())
+	if err != hashcash.ErrBudgetExceeded || r.Attempts != 5000 {
+		t.Errorf("got %d attempts: %v\n", r.Attempts, err)
+	}
+	// the next search continues from where the budget stopped
+	before := hc.Progress().Counter
+	if _, err := hc.ComputeParallel(context.Background(), 4); err != hashcash.ErrBudgetExceeded {
+		t.Errorf("parallel search got %v\n", err)
+	}
+	if n := hc.Progress().Counter - before; n != 5000 {
+		t.Errorf("parallel search made %d attempts\n", n)
+	}
+	config.Budget = hashcash.Budget{Duration: 20 * time.Millisecond}
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	start := time.Now()
+	if _, err := hc.ComputeContext(context.Background()); err != hashcash.ErrBudgetExceeded {
+		t.Errorf("got %v\n", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search ran for %v\n", elapsed)
+	}
+	// a solution within budget is found
+	config.Bits = 8
+	config.Budget = hashcash.Budget{Attempts: 1 << 20, Duration: time.Minute}
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.ComputeContext(context.Background()); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestCheckHello(t *testing.T) {
+	config := *testConfig
+	config.Bits = 4
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	config.MaxChallengeSize = 64
+	hc, err := hashcash.New(&hashcash.Resource{Data: "hello"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeCompact()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hello := append(stamp, make([]byte, 10)...)
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		hello []byte
+		size  int
+		err   error
+	}{
+		{"larger than request", hello, len(hello) + 1, hashcash.ErrAmplification},
+		{"larger than cap", append(hello, make([]byte, 100)...), 65, hashcash.ErrAmplification},
+		{"short", stamp[:10], 1, hashcash.ErrInvalidHeader},
+		{"within request", hello, len(hello), nil},
+		{"replayed", hello, len(hello), hashcash.ErrSpent},
+	}
+	for _, test := range tests {
+		if err := hc.CheckHello(ctx, test.hello, test.size, hashcash.Remote{}); err != test.err {
+			t.Errorf("%s: got %v want %v\n", test.name, err, test.err)
+		}
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	hc, err := hashcash.New(&hashcash.Resource{ValidatorFunc: func(string) bool { return true }}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx := context.Background()
+	c, err := hc.NewChallenge("player-1", time.Minute)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	parsed, err := hashcash.ParseChallenge(c.String())
+	if err != nil || parsed.Resource != c.Resource || parsed.Bits != c.Bits || parsed.Expires.Unix() != c.Expires.Unix() || parsed.Prefix != c.Prefix {
+		t.Fatalf("parsed %q got %+v %v\n", c, parsed, err)
+	}
+	for _, s := range []string{"", "8:1", "x:1:r", "8:x:r", "8:1:", "8:1:r:", "8:1:r:!", "8:1:r:p:q"} {
+		if _, err := hashcash.ParseChallenge(s); err != hashcash.ErrInvalidChallenge {
+			t.Errorf("parse %q got %v\n", s, err)
+		}
+	}
+	header, err := hashcash.MintChallenge(ctx, c, time.Second, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	c2, err := hc.NewChallenge("player-2", time.Minute)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	other, err := hashcash.MintChallenge(ctx, c2, time.Second, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.VerifyChallenge(ctx, c, other, hashcash.Remote{}); err != hashcash.ErrResourceFail {
+		t.Errorf("answer to another challenge got %v\n", err)
+	}
+	// a colluding client minting for player-2 under the prefix of player-1
+	shared := c2
+	shared.Prefix = c.Prefix
+	if other, err = hashcash.MintChallenge(ctx, shared, time.Second, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.VerifyChallenge(ctx, c2, other, hashcash.Remote{}); err != hashcash.ErrCounterPrefix {
+		t.Errorf("answer under another prefix got %v\n", err)
+	}
+	if ok, err := hc.VerifyChallenge(ctx, c, header, hashcash.Remote{}); !ok || err != nil {
+		t.Errorf("answer got %v %v\n", ok, err)
+	}
+	if _, err := hc.VerifyChallenge(ctx, c, header, hashcash.Remote{}); err != hashcash.ErrSpent {
+		t.Errorf("replayed answer got %v\n", err)
+	}
+	expired := c
+	expired.Expires = time.Now().Add(-time.Second)
+	if _, err := hc.VerifyChallenge(ctx, expired, header, hashcash.Remote{}); !errors.Is(err, hashcash.ErrExpired) {
+		t.Errorf("answer to expired challenge got %v\n", err)
+	}
+	if _, err := hashcash.MintChallenge(ctx, c, 2*time.Minute, nil); err != hashcash.ErrChallengeExpired {
+		t.Errorf("mint past deadline got %v\n", err)
+	}
+	hard := hashcash.Challenge{Resource: "player-1", Bits: 60, Expires: time.Now().Add(50 * time.Millisecond)}
+	if _, err := hashcash.MintChallenge(ctx, hard, 0, nil); err != hashcash.ErrChallengeExpired {
+		t.Errorf("mint beyond deadline got %v\n", err)
+	}
+}
+
+func TestCheckHelloIssueLimit(t *testing.T) {
+	config := *testConfig
+	config.Bits = 4
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	config.MaxChallenges = 2
+	config.MaxChallengeBytes = 100
+	hc, err := hashcash.New(&hashcash.Resource{Data: "hello"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hello := func() []byte {
+		minter, err := hashcash.New(&hashcash.Resource{Data: "hello"}, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		stamp, err := minter.ComputeCompact()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return append(stamp, make([]byte, 50)...)
+	}
+	ctx := context.Background()
+	alice, bob := hashcash.Remote{Key: "alice"}, hashcash.Remote{Key: "bob"}
+	tests := []struct {
+		name   string
+		hello  []byte
+		size   int
+		remote hashcash.Remote
+		err    error
+	}{
+		{"first", hello(), 30, alice, nil},
+		{"invalid stamp not counted", make([]byte, hashcash.CompactSize), 30, alice, hashcash.ErrInvalidHeader},
+		{"over bytes", hello(), 80, alice, hashcash.ErrIssueLimit},
+		{"second", hello(), 30, alice, nil},
+		{"over count", hello(), 1, alice, hashcash.ErrIssueLimit},
+		{"other key", hello(), 80, bob, nil},
+		{"no key unlimited", hello(), 80, hashcash.Remote{}, nil},
+	}
+	for _, test := range tests {
+		if err := hc.CheckHello(ctx, test.hello, test.size, test.remote); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v want %v\n", test.name, err, test.err)
+		}
+	}
+}
+
+func TestStampVersions(t *testing.T) {
+	if !hashcash.SupportsStampVersion(1) {
+		t.Errorf("version 1 stamps not supported\n")
+	}
+	if hashcash.SupportsStampVersion(0) {
+		t.Errorf("version 0 stamps supported\n")
+	}
+	v, ok := hashcash.NegotiateStampVersion([]int{0, 1, 2})
+	if !ok || v != 1 {
+		t.Errorf("negotiated version %d %v\n", v, ok)
+	}
+	if _, ok := hashcash.NegotiateStampVersion([]int{0}); ok {
+		t.Errorf("negotiated unsupported version\n")
+	}
+	if s := hashcash.FormatStampVersions([]int{1, 2}); s != "1,2" {
+		t.Errorf("formatted versions %q\n", s)
+	}
+	if vs := hashcash.ParseStampVersions(" 1, x,2"); len(vs) != 2 || vs[0] != 1 || vs[1] != 2 {
+		t.Errorf("parsed versions %v\n", vs)
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		testConfig,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	_, err = hc.Verify("2" + noCollisionToken[1:])
+	if err != hashcash.ErrUnsupportedVersion {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestPrepayMint(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	p, err := hashcash.NewPrepay(&hashcash.PrepayConfig{
+		Key:    []byte("secret"),
+		Quota:  2,
+		Window: time.Minute,
+		Config: &config,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var header string
+	for i := 0; i < 2; i++ {
+		header, err = p.Mint("client", "someone@gmail.com")
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	if _, err := p.Mint("client", "someone@gmail.com"); err != hashcash.ErrQuotaExceeded {
+		t.Errorf("%v\n", err)
+	}
+	// cancelled mints do not count against the quota
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hard := config
+	hard.Bits = 64
+	slow, err := hashcash.NewPrepay(&hashcash.PrepayConfig{Key: []byte("secret"), Quota: 1, Window: time.Minute, Config: &hard})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := slow.MintContext(ctx, "client", "someone@gmail.com"); err != context.Canceled {
+		t.Errorf("cancelled mint got %v\n", err)
+	}
+	if n := slow.Remaining("client"); n != 1 {
+		t.Errorf("%d remaining after a cancelled mint\n", n)
+	}
+	if err := p.Signed(header); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	// a header minted again under the signature with another counter
+	vals := strings.Split(header, ":")
+	vals[6] = "x" + vals[6]
+	if err := p.Signed(strings.Join(vals, ":")); err != hashcash.ErrSignatureUsed || !errors.Is(err, hashcash.ErrSignature) {
+		t.Errorf("reused signature got %v\n", err)
+	}
+	if _, err := hashcash.NewPrepay(&hashcash.PrepayConfig{Key: []byte("secret"), Quota: 1}); err != hashcash.ErrPrepayWindow {
+		t.Errorf("zero window got %v\n", err)
+	}
+	forged := strings.Replace(header, "someone@gmail.com", "other@gmail.com", 1)
+	if err := p.Signed(forged); err != hashcash.ErrSignature {
+		t.Errorf("%v\n", err)
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(header); !valid {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestDenominations(t *testing.T) {
+	denoms := hashcash.Denominations{
+		{Name: "one", Bits: 4, Credits: 1},
+		{Name: "two", Bits: 5, Credits: 2},
+		{Name: "five", Bits: 7, Credits: 5},
+	}
+	if got := denoms.Value(6); got != 2 {
+		t.Errorf("value of 6 bits got %d want 2\n", got)
+	}
+	res := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	config := *testConfig
+	config.Bits = 4
+	if _, err := denoms.Mint(res, 3, &config); err != hashcash.ErrDenomination {
+		t.Errorf("%v\n", err)
+	}
+	var headers []string
+	for _, credits := range []int{1, 2, 5} {
+		header, err := denoms.Mint(res, credits, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		headers = append(headers, header)
+	}
+	hc, err := hashcash.New(res, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := denoms.VerifyTotal(hc, headers, 9); err != hashcash.ErrInsufficientCredits {
+		t.Errorf("%v\n", err)
+	}
+	// a header given twice is counted once, and rejected
+	if _, err := denoms.VerifyTotal(hc, []string{headers[2], headers[2]}, 10); err != hashcash.ErrSpent {
+		t.Errorf("duplicate header got %v\n", err)
+	}
+	total, err := denoms.VerifyTotal(hc, headers, 8)
+	if err != nil || total != 8 {
+		t.Errorf("total %d: %v\n", total, err)
+	}
+	// headers spent before a failure are removed again
+	store := &failingNthAdd{MemoryStorage: hashcash.NewMemoryStorage(nil), n: 2}
+	config.Storage = store
+	if hc, err = hashcash.New(res, &config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	headers = headers[:0]
+	for _, credits := range []int{1, 2} {
+		header, err := denoms.Mint(res, credits, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		headers = append(headers, header)
+	}
+	if _, err := denoms.VerifyTotal(hc, headers, 3); !errors.Is(err, hashcash.ErrStorage) {
+		t.Errorf("failing storage got %v\n", err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("%d headers left spent\n", store.Len())
+	}
+	if total, err := denoms.VerifyTotal(hc, headers, 3); err != nil || total != 3 {
+		t.Errorf("total %d: %v\n", total, err)
+	}
+}
+
+// failingNthAdd storage failing the nth check and add
+type failingNthAdd struct {
+	*hashcash.MemoryStorage
+	n int
+}
+
+func (f *failingNthAdd) CheckAndAdd(hash string) (bool, error) {
+	if f.n--; f.n == 0 {
+		return false, errors.New("backend down")
+	}
+	return f.MemoryStorage.CheckAndAdd(hash)
+}
+
+func TestMintStatsAudit(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Audit = true
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stats := hc.MintStats()
+	if len(stats) != 1 {
+		t.Fatalf("got %d audit records want 1\n", len(stats))
+	}
+	s := stats[0]
+	if s.Header != solution || s.RandSource == "" || s.CounterStart != 1 || s.Attempts == 0 {
+		t.Errorf("bad audit record: %+v\n", s)
+	}
+	if !strings.Contains(solution, s.Rand) {
+		t.Errorf("audit rand %q not in header %q\n", s.Rand, solution)
+	}
+}
+
+func BenchmarkVerifyNoCollision(b *testing.B) {
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		testConfig,
+	)
+	if err != nil {
+		b.Fatalf("%v\n", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hc.Verify(noCollisionToken)
+	}
+}
+
+func BenchmarkVerifyInvalidHeader(b *testing.B) {
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		testConfig,
+	)
+	if err != nil {
+		b.Fatalf("%v\n", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hc.Verify(invalidToken)
+	}
+}
+
+func TestVerifyRetryWindow(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.RetryWindow = time.Minute
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	client := hashcash.Remote{Key: "10.0.0.1"}
+	for i := 0; i < 2; i++ {
+		if valid, err := hc.VerifyRemote(solution, client); !valid {
+			t.Errorf("attempt %d: %v\n", i, err)
+		}
+	}
+	_, err = hc.VerifyRemote(solution, hashcash.Remote{Key: "10.0.0.2"})
+	if err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+	if _, err = hc.Verify(solution); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestSpentBase64Variants(t *testing.T) {
+	config := *testConfig
+	config.Bits = 0
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !strings.HasSuffix(solution, "=") {
+		t.Fatalf("expected padded counter in %q\n", solution)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	unpadded := strings.Replace(solution, "=", "", -1)
+	if _, err := hc.Verify(unpadded); err != hashcash.ErrSpent {
+		t.Errorf("unpadded variant: %v\n", err)
+	}
+	vals := strings.Split(solution, ":")
+	vals[5] = strings.NewReplacer("+", "-", "/", "_").Replace(vals[5])
+	if _, err := hc.Verify(strings.Join(vals, ":")); err != hashcash.ErrSpent {
+		t.Errorf("url alphabet variant: %v\n", err)
+	}
+}
+
+func TestMaxBits(t *testing.T) {
+	var flagged bool
+	config := *testConfig
+	config.Bits = 0
+	config.MaxBits = 16
+	config.OnVerify = func(ev hashcash.VerifyEvent) { flagged = ev.ExcessBits }
+	res := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	hc, err := hashcash.New(res, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hc.Verify(validToken)
+	if !flagged {
+		t.Errorf("20 bit token not flagged\n")
+	}
+	config.ExcessBits = hashcash.RejectExcessBits
+	hc, err = hashcash.New(res, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(spentToken); err != hashcash.ErrExcessBits {
+		t.Errorf("%v\n", err)
+	}
+}
+
+type ctxKey struct{}
+
+type ContextStorage struct {
+	MockStorage
+	requestIDs []string
+}
+
+func (c *ContextStorage) AddContext(ctx context.Context, hash string) error {
+	c.requestIDs = append(c.requestIDs, ctx.Value(ctxKey{}).(string))
+	return c.Add(hash)
+}
+
+func (c *ContextStorage) SpentContext(ctx context.Context, hash string) bool {
+	c.requestIDs = append(c.requestIDs, ctx.Value(ctxKey{}).(string))
+	return c.Spent(hash)
+}
+
+func TestVerifyContext(t *testing.T) {
+	var (
+		store    = &ContextStorage{}
+		validate string
+		event    string
+	)
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = store
+	config.OnVerify = func(ev hashcash.VerifyEvent) {
+		event = ev.Context.Value(ctxKey{}).(string)
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data: "someone@gmail.com",
+			ValidatorContextFunc: func(ctx context.Context, res string) bool {
+				validate = ctx.Value(ctxKey{}).(string)
+				return true
+			},
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	if valid, err := hc.VerifyContext(ctx, solution, hashcash.Remote{}); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	if validate != "req-1" || event != "req-1" || len(store.requestIDs) != 2 {
+		t.Errorf("context not propagated: %q %q %v\n", validate, event, store.requestIDs)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := hc.VerifyContext(ctx, solution, hashcash.Remote{}); err != context.Canceled {
+		t.Errorf("%v\n", err)
+	}
+}
+
+// ContextCheckAndAddStorage storage checking and adding entries atomically,
+// recording the context and creation date it receives
+type ContextCheckAndAddStorage struct {
+	*hashcash.MemoryStorage
+	requestIDs []string
+	created    []time.Time
+}
+
+func (c *ContextCheckAndAddStorage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	c.requestIDs = append(c.requestIDs, ctx.Value(ctxKey{}).(string))
+	c.created = append(c.created, created)
+	return c.CheckAndAdd(hash)
+}
+
+func TestContextCheckAndAdder(t *testing.T) {
+	store := &ContextCheckAndAddStorage{MemoryStorage: hashcash.NewMemoryStorage(nil)}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = store
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Accept: []string{"someone@gmail.com"}}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	if _, err := hc.VerifyContext(ctx, stamp, hashcash.Remote{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.VerifyContext(ctx, stamp, hashcash.Remote{}); err != hashcash.ErrSpent {
+		t.Errorf("replayed stamp got %v\n", err)
+	}
+	if len(store.requestIDs) != 2 || store.requestIDs[0] != "req-1" {
+		t.Errorf("context not propagated: %v\n", store.requestIDs)
+	}
+	if len(store.created) != 2 || time.Since(store.created[0]) > time.Minute {
+		t.Errorf("creation dates %v\n", store.created)
+	}
+}
+
+func TestMintStep(t *testing.T) {
+	config := *testConfig
+	config.Bits = 16
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var (
+		done  bool
+		token string
+	)
+	for !done {
+		start := time.Now()
+		done, token, err = hc.MintStep(time.Millisecond)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("step exceeded budget: %v\n", elapsed)
+		}
+	}
+	if valid, err := hc.Verify(token); !valid {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestSaveLoadState(t *testing.T) {
+	newHashcash := func(storage hashcash.Storage) *hashcash.Hashcash {
+		config := *testConfig
+		config.Bits = 8
+		config.Storage = storage
+		config.RetryWindow = time.Minute
+		config.Reputation = hashcash.NewReputation(&hashcash.ReputationConfig{
+			Threshold: 2,
+			Window:    time.Minute,
+			BlockFor:  time.Minute,
+		})
+		hc, err := hashcash.New(
+			&hashcash.Resource{
+				Data:          "someone@gmail.com",
+				ValidatorFunc: func(res string) bool { return true },
+			},
+			&config,
+		)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return hc
+	}
+	var (
+		storage = &MockStorage{}
+		hc      = newHashcash(storage)
+		client  = hashcash.Remote{Key: "10.0.0.1"}
+		abuser  = hashcash.Remote{Key: "10.0.0.2"}
+	)
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.VerifyRemote(solution, client); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 2; i++ {
+		hc.VerifyRemote(invalidToken, abuser)
+	}
+	var buf bytes.Buffer
+	if err := hc.SaveState(&buf); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	restored := newHashcash(storage)
+	if err := restored.LoadState(&buf); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := restored.VerifyRemote(solution, client); !valid {
+		t.Errorf("retry not restored: %v\n", err)
+	}
+	if _, err := restored.VerifyRemote(invalidToken, abuser); err != hashcash.ErrBlocked {
+		t.Errorf("reputation not restored: %v\n", err)
+	}
+	err = restored.LoadState(strings.NewReader(`{"version":99}`))
+	if err != hashcash.ErrStateVersion {
+		t.Errorf("%v\n", err)
+	}
+	// spent entries of memory storage and caches are restored too
+	for i, storage := range []func() hashcash.Storage{
+		func() hashcash.Storage { return hashcash.NewMemoryStorage(nil) },
+		func() hashcash.Storage { return hashcash.NewCache(hashcash.NewMemoryStorage(nil), nil) },
+	} {
+		hc := newHashcash(storage())
+		solution, err := hc.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if valid, err := hc.Verify(solution); !valid {
+			t.Fatalf("%v\n", err)
+		}
+		buf.Reset()
+		if err := hc.SaveState(&buf); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		restored := newHashcash(storage())
+		if err := restored.LoadState(&buf); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if _, err := restored.Verify(solution); err != hashcash.ErrSpent {
+			t.Errorf("storage %d: spent entries not restored: %v\n", i, err)
+		}
+	}
+}
+
+func TestVerifyStrict(t *testing.T) {
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	config.Strict = true
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return res == "someone@gmail.com" },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	_, err = hc.Verify(expiredToken)
+	if !errors.Is(err, hashcash.ErrTimestamp) || !errors.Is(err, hashcash.ErrResourceFail) {
+		t.Errorf("%v\n", err)
+	}
+	if errors.Is(err, hashcash.ErrNoCollision) {
+		t.Errorf("%v\n", err)
+	}
+	_, err = hc.Verify(noCollisionToken)
+	if !errors.Is(err, hashcash.ErrNoCollision) || !errors.Is(err, hashcash.ErrTimestamp) {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.Verify(validToken); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestVerifyAcceptResources(t *testing.T) {
+	mint := func(resource string) string {
+		config := *testConfig
+		config.Bits = 8
+		hc, err := hashcash.New(&hashcash.Resource{Data: resource}, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		solution, err := hc.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return solution
+	}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Accept:   []string{"someone@gmail.com", "alias@gmail.com"},
+			FoldCase: true,
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for _, resource := range []string{"alias@gmail.com", "Someone@Gmail.com"} {
+		if valid, err := hc.Verify(mint(resource)); !valid {
+			t.Errorf("%s: %v\n", resource, err)
+		}
+	}
+	if _, err := hc.Verify(mint("other@gmail.com")); err != hashcash.ErrResourceFail {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestFileStorageRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spent.log")
+	fs, err := hashcash.NewFileStorage(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for _, h := range []string{"a", "b", "c"} {
+		if err := fs.Add(h); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	fs.Close()
+	// simulate a torn write left by an unclean shutdown
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	f.Write([]byte{0, 40, 'd', 'e'})
+	f.Close()
+	fs, err = hashcash.NewFileStorage(path, &hashcash.FileConfig{Sync: hashcash.SyncNever})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if fs.Recovered != 4 {
+		t.Errorf("recovered %d bytes\n", fs.Recovered)
+	}
+	if err := fs.Add("d"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	fs.Close()
+	fs, err = hashcash.NewFileStorage(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer fs.Close()
+	for _, h := range []string{"a", "b", "c", "d"} {
+		if !fs.Spent(h) {
+			t.Errorf("%s not spent\n", h)
+		}
+	}
+	if fs.Spent("e") || fs.Recovered != 0 {
+		t.Errorf("unexpected entry or recovery\n")
+	}
+}
+
+func TestFileStorageAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spent.log")
+	fs, err := hashcash.NewFileStorage(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config := *testConfig
+	config.Storage = fs
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(validToken); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	key, err := hashcash.SpentKey(validToken)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var admin hashcash.Admin = fs
+	info, ok, err := admin.Lookup(key)
+	if err != nil || !ok || time.Since(info.Added) > time.Minute {
+		t.Fatalf("lookup %v %v %v\n", info, ok, err)
+	}
+	if err := admin.Remove(key); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	fs.Close()
+	fs, err = hashcash.NewFileStorage(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer fs.Close()
+	if _, ok, _ := fs.Lookup(key); ok {
+		t.Errorf("removed entry restored\n")
+	}
+	if _, err := hashcash.SpentKey(invalidToken); err != hashcash.ErrInvalidHeader {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestVerifyConstantTime(t *testing.T) {
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	validated := 0
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Accept:        []string{"someone@gmail.com", "alias@gmail.com"},
+			ConstantTime:  true,
+			ValidatorFunc: func(string) bool { validated++; return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(validToken); !valid {
+		t.Errorf("%v\n", err)
+	}
+	// expired and resource "foo" not accepted, the first failure is returned
+	if _, err := hc.Verify(expiredToken); !errors.Is(err, hashcash.ErrTimestamp) {
+		t.Errorf("%v\n", err)
+	}
+	if validated != 2 {
+		t.Errorf("resource checked %d times want 2\n", validated)
+	}
+}
+
+func TestFileStorageShared(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "spent.log")
+		config = &hashcash.FileConfig{Shared: true, LockTimeout: time.Second}
+	)
+	a, err := hashcash.NewFileStorage(path, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer a.Close()
+	b, err := hashcash.NewFileStorage(path, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer b.Close()
+	if err := a.Add("a"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := b.Add("b"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !b.Spent("a") || !a.Spent("b") {
+		t.Errorf("entries added by another writer not seen\n")
+	}
+	if err := b.Remove("a"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if a.Spent("a") {
+		t.Errorf("entry removed by another writer still spent\n")
+	}
+	var (
+		wg    sync.WaitGroup
+		added int32
+	)
+	for _, s := range []*hashcash.FileStorage{a, b, a, b} {
+		wg.Add(1)
+		go func(s *hashcash.FileStorage) {
+			defer wg.Done()
+			spent, err := s.CheckAndAddContext(context.Background(), "c", time.Now())
+			if err != nil {
+				t.Errorf("%v\n", err)
+			}
+			if !spent {
+				atomic.AddInt32(&added, 1)
+			}
+		}(s)
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("entry added %d times by writers sharing the log\n", added)
+	}
+}
+
+func TestBitsSchedule(t *testing.T) {
+	var (
+		now   = time.Now()
+		month = 30 * 24 * time.Hour
+	)
+	schedule := &hashcash.BitsSchedule{
+		Start: now.Add(-3*month - time.Hour),
+		Bits:  5,
+		Every: month,
+		Max:   10,
+		Grace: 2 * time.Hour,
+	}
+	if bits := schedule.BitsAt(now); bits != 8 {
+		t.Errorf("bits at now got %d want 8\n", bits)
+	}
+	if bits := schedule.Required(now); bits != 7 {
+		t.Errorf("required within grace got %d want 7\n", bits)
+	}
+	if bits := schedule.BitsAt(now.Add(100 * month)); bits != 10 {
+		t.Errorf("bits past max got %d want 10\n", bits)
+	}
+	changes := schedule.Upcoming(now, 5)
+	if len(changes) != 2 || changes[0].Bits != 9 || changes[1].Bits != 10 {
+		t.Fatalf("upcoming %+v\n", changes)
+	}
+	if !changes[0].At.Equal(schedule.Start.Add(4 * month)) {
+		t.Errorf("next change at %v\n", changes[0].At)
+	}
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	config.Schedule = schedule
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !strings.HasPrefix(solution, "1:8:") {
+		t.Errorf("minted %s\n", solution)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestCachePreload(t *testing.T) {
+	fs, err := hashcash.NewFileStorage(filepath.Join(t.TempDir(), "spent.log"), nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer fs.Close()
+	for _, h := range []string{"a", "b", "c", "d"} {
+		fs.Add(h)
+	}
+	var progress []int
+	cache := hashcash.NewCache(fs, &hashcash.CacheConfig{
+		MaxEntries:    3,
+		OnProgress:    func(n int) { progress = append(progress, n) },
+		ProgressEvery: 2,
+	})
+	n, err := cache.Preload(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil || n != 4 {
+		t.Fatalf("loaded %d %v\n", n, err)
+	}
+	if cache.Len() != 3 {
+		t.Errorf("cache holds %d entries want 3\n", cache.Len())
+	}
+	if len(progress) != 3 || progress[2] != 4 {
+		t.Errorf("progress %v\n", progress)
+	}
+	if !cache.Spent("a") || !cache.Spent("d") || cache.Spent("e") {
+		t.Errorf("unexpected spent result\n")
+	}
+	if _, err := hashcash.NewCache(&MockStorage{}, nil).Preload(context.Background(), time.Time{}); err != hashcash.ErrNotLister {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestCacheForwarding(t *testing.T) {
+	backend := hashcash.NewMemoryStorage(nil)
+	cache := hashcash.NewCache(backend, nil)
+	var _ hashcash.ContextCheckAndAdder = cache
+	var _ hashcash.Admin = cache
+	var _ hashcash.DateSpender = cache
+	var _ hashcash.BatchSpender = cache
+	var claimed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if spent, err := cache.CheckAndAdd("a"); err == nil && !spent {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("claimed %d times want 1\n", claimed)
+	}
+	if !backend.Spent("a") || cache.Len() != 1 {
+		t.Errorf("entry not written through\n")
+	}
+	if _, ok, err := cache.Lookup("a"); !ok || err != nil {
+		t.Errorf("lookup %v %v\n", ok, err)
+	}
+	if err := cache.Remove("a"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if cache.Spent("a") || cache.Len() != 0 {
+		t.Errorf("removed entry still spent\n")
+	}
+	if spent, err := cache.CheckAndAddContext(context.Background(), "a", time.Now()); spent || err != nil {
+		t.Errorf("%v %v\n", spent, err)
+	}
+	isSpent, err := cache.SpentBatch([]string{"a", "b"})
+	if err != nil || !isSpent[0] || isSpent[1] {
+		t.Errorf("%v %v\n", isSpent, err)
+	}
+	// backends without the atomic interfaces are checked and added
+	// separately, and without Admin cannot be corrected
+	mock := hashcash.NewCache(&MockStorage{}, nil)
+	if spent, err := mock.CheckAndAdd("b"); spent || err != nil {
+		t.Errorf("%v %v\n", spent, err)
+	}
+	if spent, _ := mock.CheckAndAdd("b"); !spent {
+		t.Errorf("entry not added\n")
+	}
+	if err := mock.Remove("b"); err != hashcash.ErrNotAdmin {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestParseBits(t *testing.T) {
+	bits, err := hashcash.ParseBits("20")
+	if err != nil || bits != 20 {
+		t.Fatalf("%v %v\n", bits, err)
+	}
+	if bits.String() != "20" || bits.ExpectedAttempts() != 1<<20 {
+		t.Errorf("%s %v\n", bits, bits.ExpectedAttempts())
+	}
+	for _, s := range []string{"65", "-1", "256", "x", ""} {
+		if _, err := hashcash.ParseBits(s); err != hashcash.ErrInvalidBits {
+			t.Errorf("%q: %v\n", s, err)
+		}
+	}
+}
+
+// BatchStorage counts batched lookups
+type BatchStorage struct {
+	MockStorage
+	batches int
+}
+
+func (b *BatchStorage) SpentBatch(hashes []string) ([]bool, error) {
+	b.batches++
+	spent := make([]bool, len(hashes))
+	for i, h := range hashes {
+		spent[i] = b.Spent(h)
+	}
+	return spent, nil
+}
+
+func TestVerifyBatch(t *testing.T) {
+	store := &BatchStorage{}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = store
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var headers []string
+	for i := 0; i < 3; i++ {
+		minter, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		h, err := minter.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		headers = append(headers, h)
+	}
+	if valid, err := hc.Verify(headers[2]); !valid {
+		t.Fatalf("%v\n", err)
+	}
+	headers = append(headers, invalidToken, headers[0])
+	valid, errs := hc.VerifyBatch(context.Background(), headers)
+	want := []error{nil, nil, hashcash.ErrSpent, hashcash.ErrInvalidHeader, hashcash.ErrSpent}
+	for i := range want {
+		if !errors.Is(errs[i], want[i]) || valid[i] != (want[i] == nil) {
+			t.Errorf("header %d: %v %v\n", i, valid[i], errs[i])
+		}
+	}
+	if store.batches != 1 {
+		t.Errorf("got %d batched lookups want 1\n", store.batches)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	config := *testConfig
+	config.Bits = 0
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "foo",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	tests := []struct {
+		header string
+		field  string
+		offset int
+	}{
+		{"x:20:040806:foo::rand:ctr", "version", 0},
+		{"1:20:040806:foo::rand", "counter", 21},
+		{"1:20:040806:foo::rand:ctr:extra", "counter", 25},
+		{"1:2x:040806:foo::rand:ctr", "bits", 3},
+		{"1:20:0408:foo::rand:ctr", "date", 5},
+		{"1:20:041306:foo::rand:ctr", "date", 5},
+	}
+	for _, test := range tests {
+		_, err := hc.Verify(test.header)
+		var perr *hashcash.ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, hashcash.ErrInvalidHeader) {
+			t.Errorf("%s: %v\n", test.header, err)
+			continue
+		}
+		if perr.Field != test.field || perr.Offset != test.offset {
+			t.Errorf("%s: got %s at %d want %s at %d\n", test.header, perr.Field, perr.Offset, test.field, test.offset)
+		}
+	}
+}
+
+func TestHashedResource(t *testing.T) {
+	var (
+		salt     = []byte("policy-salt")
+		resource = &hashcash.Resource{Data: "someone@gmail.com", Salt: salt}
+		config   = *testConfig
+	)
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if strings.Contains(solution, "someone@gmail.com") {
+		t.Errorf("resource leaked in %s\n", solution)
+	}
+	if !strings.Contains(solution, hashcash.HashResource(salt, "someone@gmail.com")) {
+		t.Errorf("hashed resource missing from %s\n", solution)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+	other, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Salt: []byte("other")}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := other.Verify(solution); err != hashcash.ErrResourceFail {
+		t.Errorf("%v\n", err)
+	}
+}
+
+// mintAt mints an 8-bit header for resource created at t.
+func mintAt(resource string, t time.Time) string {
+	date := t.UTC().Format("060102150405")
+	for counter := 0; ; counter++ {
+		header := fmt.Sprintf("1:8:%s:%s::c2FsdA==:%x", date, resource, counter)
+		if sum := sha1.Sum([]byte(header)); sum[0] == 0 {
+			return header
+		}
+	}
+}
+
+func TestFutureStamps(t *testing.T) {
+	var (
+		ahead   = mintAt("someone@gmail.com", time.Now().Add(time.Hour))
+		current = mintAt("someone@gmail.com", time.Now())
+	)
+	tests := []struct {
+		action hashcash.FutureStampAction
+		header string
+		valid  bool
+		flag   bool
+	}{
+		{hashcash.AcceptFutureStamps, ahead, true, true},
+		{hashcash.FlagFutureStamps, ahead, true, true},
+		{hashcash.RejectFutureStamps, ahead, false, true},
+		{hashcash.RejectFutureStamps, current, true, false},
+	}
+	for _, test := range tests {
+		var ev hashcash.VerifyEvent
+		config := *testConfig
+		config.Bits = 8
+		config.Storage = &MockStorage{}
+		config.Skew = 5 * time.Minute
+		config.FutureStamps = test.action
+		config.OnVerify = func(e hashcash.VerifyEvent) { ev = e }
+		hc, err := hashcash.New(
+			&hashcash.Resource{
+				Data:          "someone@gmail.com",
+				ValidatorFunc: func(res string) bool { return true },
+			},
+			&config,
+		)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		valid, err := hc.Verify(test.header)
+		if valid != test.valid || ev.FutureStamp != test.flag {
+			t.Errorf("action %d: valid %v flagged %v: %v\n", test.action, valid, ev.FutureStamp, err)
+		}
+		if !test.valid && !errors.Is(err, hashcash.ErrFutureStamp) {
+			t.Errorf("action %d: %v\n", test.action, err)
+		}
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "foo",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		testConfig,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(expiredToken); !errors.Is(err, hashcash.ErrExpired) {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestWallet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet")
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	resource := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	wallet, err := hashcash.OpenWallet(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hc.MintStep(0)
+	if err := wallet.SaveProgress(hc.Progress()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// restart, resuming the saved mint
+	wallet, err = hashcash.OpenWallet(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	progress, ok := wallet.Progress("someone@gmail.com")
+	if !ok {
+		t.Fatalf("mint progress lost\n")
+	}
+	resumed, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := resumed.Resume(progress); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if resumed.Progress() != progress {
+		t.Errorf("resumed at %+v want %+v\n", resumed.Progress(), progress)
+	}
+	solution, err := resumed.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := wallet.Put(solution); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, ok := wallet.Progress("someone@gmail.com"); ok {
+		t.Errorf("mint progress kept after stamp was added\n")
+	}
+	if err := wallet.Put(expiredToken); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// corrupt the file by appending a torn record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	f.WriteString("0badc0de {\"stamp\":")
+	f.Close()
+	wallet, err = hashcash.OpenWallet(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if wallet.Dropped != 1 {
+		t.Errorf("dropped %d records want 1\n", wallet.Dropped)
+	}
+	if wallet.Len("foo") != 0 {
+		t.Errorf("expired stamp not evicted\n")
+	}
+	header, ok, err := wallet.Take("someone@gmail.com")
+	if err != nil || !ok || header != solution {
+		t.Errorf("took %q %v want %q: %v\n", header, ok, solution, err)
+	}
+	if valid, err := resumed.Verify(header); !valid {
+		t.Errorf("%v\n", err)
+	}
+	other, err := hashcash.New(&hashcash.Resource{Data: "other"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := other.Resume(progress); err != hashcash.ErrProgressMismatch {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	filter := hashcash.NewReplayFilter(&hashcash.ReplayFilterConfig{
+		Window:   time.Hour,
+		Capacity: 10000,
+	})
+	for i := 0; i < 10000; i++ {
+		if err := filter.Add(fmt.Sprintf("spent-%d", i)); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		if !filter.Spent(fmt.Sprintf("spent-%d", i)) {
+			t.Fatalf("spent-%d not spent\n", i)
+		}
+	}
+	var falsePositives int
+	for i := 0; i < 100000; i++ {
+		if filter.Spent(fmt.Sprintf("fresh-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 100 {
+		t.Errorf("%d false positives in 100000\n", falsePositives)
+	}
+	// fail closed once full, until the window rotates
+	filter = hashcash.NewReplayFilter(&hashcash.ReplayFilterConfig{
+		Window:     50 * time.Millisecond,
+		Capacity:   8,
+		FailClosed: true,
+	})
+	var err error
+	for i := 0; err == nil; i++ {
+		err = filter.Add(fmt.Sprintf("spent-%d", i))
+	}
+	if err != hashcash.ErrReplayFilterFull {
+		t.Fatalf("%v\n", err)
+	}
+	if !filter.Spent("fresh") {
+		t.Errorf("full filter accepted a fresh entry\n")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if filter.Spent("fresh") || filter.Spent("spent-0") {
+		t.Errorf("filter did not rotate\n")
+	}
+}
+
+func TestCompactStamp(t *testing.T) {
+	config := *testConfig
+	config.Bits = 12
+	config.Storage = &MockStorage{}
+	resource := &hashcash.Resource{
+		Data:          "203.0.113.7:27015",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeCompact()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if len(stamp) != hashcash.CompactSize {
+		t.Errorf("stamp is %d bytes want %d\n", len(stamp), hashcash.CompactSize)
+	}
+	other, err := hashcash.New(&hashcash.Resource{Data: "198.51.100.1:27015"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := other.VerifyCompact(stamp); err != hashcash.ErrResourceFail {
+		t.Errorf("%v\n", err)
+	}
+	if valid, err := hc.VerifyCompact(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.VerifyCompact(stamp); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.VerifyCompact(stamp[1:]); err != hashcash.ErrInvalidHeader {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	var events []hashcash.VerifyEvent
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.ParseCacheTTL = time.Minute
+	config.OnVerify = func(ev hashcash.VerifyEvent) { events = append(events, ev) }
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+	// cached parse, spent status is still checked
+	if _, err := hc.Verify(solution); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+	if events[0].Hash != events[1].Hash || !events[0].Created.Equal(events[1].Created) {
+		t.Errorf("cached fields differ %+v %+v\n", events[0], events[1])
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := hc.Verify(expiredToken); !errors.Is(err, hashcash.ErrExpired) {
+			t.Errorf("%v\n", err)
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	var got map[string]string
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.OnVerify = func(ev hashcash.VerifyEvent) { got = ev.Extensions }
+	config.Extensions = &hashcash.ExtensionPolicy{
+		Require: []string{"app"},
+		Validators: map[string]func(string) bool{
+			"app": func(v string) bool { return v == "checkout" },
+		},
+	}
+	resource := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	mint := func(ext map[string]string) string {
+		hc, err := hashcash.New(resource, &config)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if err := hc.SetExtensions(ext); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		solution, err := hc.Compute()
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return solution
+	}
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution := mint(map[string]string{"app": "checkout", "uid": "123"})
+	if !strings.Contains(solution, ":app=checkout;uid=123:") {
+		t.Errorf("extensions missing from %s\n", solution)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if got["app"] != "checkout" || got["uid"] != "123" {
+		t.Errorf("verified extensions %v\n", got)
+	}
+	if ext, err := hashcash.HeaderExtensions(solution); err != nil || ext["uid"] != "123" {
+		t.Errorf("header extensions %v: %v\n", ext, err)
+	}
+	for _, ext := range []map[string]string{{"uid": "123"}, {"app": "login"}} {
+		if _, err := hc.Verify(mint(ext)); err != hashcash.ErrExtension {
+			t.Errorf("%v: %v\n", ext, err)
+		}
+	}
+	if _, err := hashcash.FormatExtensions(map[string]string{"app": "a:b"}); err != hashcash.ErrInvalidExtension {
+		t.Errorf("%v\n", err)
+	}
+	// context validators receive the context of the verification and take
+	// precedence over validators of the same name
+	type tenant struct{}
+	config.Extensions = &hashcash.ExtensionPolicy{
+		Validators: map[string]func(string) bool{
+			"uid": func(string) bool { return false },
+		},
+		ContextValidators: map[string]func(context.Context, string) bool{
+			"uid": func(ctx context.Context, v string) bool { return ctx.Value(tenant{}) == v },
+		},
+	}
+	hc, err = hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution = mint(map[string]string{"uid": "123"})
+	if valid, err := hc.VerifyContext(context.WithValue(context.Background(), tenant{}, "123"), solution, hashcash.Remote{}); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.VerifyContext(context.WithValue(context.Background(), tenant{}, "456"), mint(map[string]string{"uid": "123"}), hashcash.Remote{}); err != hashcash.ErrExtension {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var statuses []hashcash.Status
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	config.OnVerify = func(ev hashcash.VerifyEvent) { statuses = append(statuses, ev.Status) }
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx := context.Background()
+	if status, err := hc.Check(ctx, solution); status != hashcash.StatusVerified {
+		t.Errorf("checked %v: %v\n", status, err)
+	}
+	hc.Verify(solution)
+	hc.Verify(solution)
+	hc.Verify(expiredToken)
+	hc.Verify(invalidToken)
+	want := []hashcash.Status{
+		hashcash.StatusSpent,
+		hashcash.StatusSpent,
+		hashcash.StatusExpired,
+		hashcash.StatusPresented,
+	}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("statuses %v want %v\n", statuses, want)
+	}
+	if status, err := hc.Check(ctx, solution); status != hashcash.StatusSpent || err != hashcash.ErrSpent {
+		t.Errorf("checked %v: %v\n", status, err)
+	}
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	config := *testConfig
+	config.Bits = 16
+	config.Storage = &MockStorage{}
+	config.Hash = crypto.SHA256
+	resource := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.Compute()
+	for err == hashcash.ErrSolutionFail {
+		solution, err = hc.Compute()
+	}
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if sum := sha256.Sum256([]byte(solution)); sum[0] != 0 || sum[1] != 0 {
+		t.Errorf("%s has no sha256 collision\n", solution)
+	}
+	sha1Config := config
+	sha1Config.Hash = 0
+	sha1Verifier, err := hashcash.New(resource, &sha1Config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := sha1Verifier.Verify(solution); !errors.Is(err, hashcash.ErrNoCollision) {
+		t.Errorf("%v\n", err)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+	config.Hash = crypto.BLAKE2b_256
+	if _, err := hashcash.New(resource, &config); err != hashcash.ErrHashUnavailable {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestComputeContext(t *testing.T) {
+	config := *testConfig
+	config.Bits = 64
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := hc.ComputeContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("%v\n", err)
+	}
+	config.Bits = 8
+	hc, err = hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+}
+
+// powerMonitor reports a fixed power state
+type powerMonitor struct {
+	mu    sync.Mutex
+	state hashcash.PowerState
+}
+
+func (m *powerMonitor) set(state hashcash.PowerState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+}
+
+func (m *powerMonitor) PowerState() (hashcash.PowerState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, nil
+}
+
+func TestPreMine(t *testing.T) {
+	wallet, err := hashcash.OpenWallet(filepath.Join(t.TempDir(), "wallet"), nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	newMinter := func() (*hashcash.Hashcash, error) {
+		return hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	}
+	monitor := &powerMonitor{state: hashcash.PowerState{OnBattery: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- wallet.PreMine(ctx, newMinter, &hashcash.PreMineConfig{
+			Target: 3,
+			Power:  monitor,
+			Slice:  time.Millisecond,
+			Poll:   time.Millisecond,
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := wallet.Len("someone@gmail.com"); n != 0 {
+		t.Errorf("mined %d stamps on battery\n", n)
+	}
+	monitor.set(hashcash.PowerState{})
+	for deadline := time.Now().Add(5 * time.Second); wallet.Len("someone@gmail.com") < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("wallet not filled\n")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := wallet.Len("someone@gmail.com"); n != 3 {
+		t.Errorf("wallet holds %d stamps want 3\n", n)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("%v\n", err)
+	}
+	if d, ok := wallet.PredictedSolveTime(8); !ok || d <= 0 {
+		t.Errorf("no solve time predicted from mined stamps\n")
+	}
+	if _, err := hashcash.SystemPowerMonitor().PowerState(); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestComputeParallel(t *testing.T) {
+	config := *testConfig
+	config.Bits = 14
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := hc.ComputeParallel(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(solution); !valid {
+		t.Errorf("%v\n", err)
+	}
+	config.Bits = 64
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com"}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := hc.ComputeParallel(ctx, 0); err != context.DeadlineExceeded {
+		t.Errorf("%v\n", err)
+	}
+	if hc.Progress().Counter <= 1 {
+		t.Errorf("progress not recorded\n")
+	}
+}
+
+func TestSHA1Sunset(t *testing.T) {
+	var ev hashcash.VerifyEvent
+	config := *testConfig
+	config.Bits = 16
+	config.Storage = &MockStorage{}
+	resource := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	minter, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	solution, err := minter.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config.Hash = crypto.SHA256
+	config.OnVerify = func(e hashcash.VerifyEvent) { ev = e }
+	config.SHA1Sunset = time.Now().Add(-time.Hour)
+	hc, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(solution); err != hashcash.ErrSHA1Sunset {
+		t.Errorf("%v\n", err)
+	}
+	config.SHA1Sunset = time.Now().Add(time.Hour)
+	hc, err = hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(solution); !valid || !ev.SHA1 {
+		t.Errorf("sha1 %v: %v\n", ev.SHA1, err)
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	newInstance := func(resource string) *hashcash.Hashcash {
+		hc, err := hashcash.New(
+			&hashcash.Resource{
+				Data:          resource,
+				ValidatorFunc: func(res string) bool { return res == resource },
+			},
+			&config,
+		)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return hc
+	}
+	var (
+		ctx    = context.Background()
+		sender = newInstance("list@example.com")
+		list   = newInstance("reader@example.com")
+	)
+	original, err := sender.ComputeContext(ctx)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	relay, err := list.ComputeRelay(ctx, original)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	other, err := newInstance("reader@example.com").ComputeRelay(ctx, validToken)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	verifiers := []hashcash.Verifier{newInstance("list@example.com"), newInstance("reader@example.com")}
+	if err := hashcash.VerifyChain(ctx, []string{original, other}, verifiers); err != hashcash.ErrRelayChain {
+		t.Errorf("%v\n", err)
+	}
+	if err := hashcash.VerifyChain(ctx, []string{original, relay}, verifiers); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	if err := hashcash.VerifyChain(ctx, []string{original, relay}, verifiers); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	m := hashcash.NewMemoryStorage(&hashcash.MemoryConfig{
+		TTL:           50 * time.Millisecond,
+		MaxEntries:    4,
+		EvictInterval: time.Millisecond,
+	})
+	for i := 0; i < 6; i++ {
+		m.Add(fmt.Sprintf("spent-%d", i))
+	}
+	if m.Len() != 4 {
+		t.Errorf("%d entries, want 4\n", m.Len())
+	}
+	if m.Spent("spent-0") || m.Spent("spent-1") || !m.Spent("spent-5") {
+		t.Errorf("oldest entries not evicted when full\n")
+	}
+	m.Remove("spent-2")
+	if _, ok, _ := m.Lookup("spent-2"); ok {
+		t.Errorf("removed entry found\n")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if m.Spent("spent-5") {
+		t.Errorf("expired entry spent\n")
+	}
+	m.Add("fresh")
+	if m.Len() != 1 || !m.Spent("fresh") {
+		t.Errorf("%d entries after sweep, want 1\n", m.Len())
+	}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.Verify(stamp); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := hashcash.NewBloomFilter(&hashcash.BloomFilterConfig{
+		Window:            time.Hour,
+		Capacity:          10000,
+		FalsePositiveRate: 0.001,
+	})
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("spent-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !filter.Spent(fmt.Sprintf("spent-%d", i)) {
+			t.Fatalf("spent-%d not spent\n", i)
+		}
+	}
+	var falsePositives int
+	for i := 0; i < 100000; i++ {
+		if filter.Spent(fmt.Sprintf("fresh-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("%d false positives in 100000\n", falsePositives)
+	}
+	// entries are forgotten after two windows
+	filter = hashcash.NewBloomFilter(&hashcash.BloomFilterConfig{
+		Window:   50 * time.Millisecond,
+		Capacity: 100,
+	})
+	filter.Add("spent")
+	time.Sleep(60 * time.Millisecond)
+	if !filter.Spent("spent") {
+		t.Errorf("entry forgotten after one window\n")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if filter.Spent("spent") {
+		t.Errorf("entry remembered after two windows\n")
+	}
+}
+
+func TestVerifyResult(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:     "Someone@Gmail.com",
+			Accept:   []string{"someone@gmail.com"},
+			FoldCase: true,
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := hc.SetExtensions(map[string]string{"app": "checkout"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	r, err := hc.VerifyResult(context.Background(), stamp, hashcash.Remote{})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !r.Valid || r.Status != hashcash.StatusSpent || r.Bits != 8 || r.ZeroBits < 8 || len(r.Digest) != 40 {
+		t.Errorf("%+v\n", r)
+	}
+	if r.Resource != "Someone@Gmail.com" || r.NormalizedResource != "someone@gmail.com" {
+		t.Errorf("resource %q normalized %q\n", r.Resource, r.NormalizedResource)
+	}
+	if r.Age < 0 || r.Age > time.Minute {
+		t.Errorf("age %v\n", r.Age)
+	}
+	m := r.Map()
+	if m["ext.app"] != "checkout" || m["valid"] != true || m["error"] != "" || m["bits"] != 8 {
+		t.Errorf("%v\n", m)
+	}
+	r, err = hc.VerifyResult(context.Background(), stamp, hashcash.Remote{})
+	if err != hashcash.ErrSpent || r.Valid || r.Map()["error"] != hashcash.ErrSpent.Error() {
+		t.Errorf("%v %+v\n", err, r)
+	}
+}
+
+func TestVerifyDetailed(t *testing.T) {
+	config := *testConfig
+	config.Storage = &MockStorage{}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	tests := []struct {
+		name   string
+		token  string
+		reason hashcash.Reason
+		stamp  bool
+	}{
+		{"valid", validToken, hashcash.ReasonNone, true},
+		{"spent", validToken, hashcash.ReasonSpent, true},
+		{"malformed", invalidToken, hashcash.ReasonInvalid, false},
+		{"no collision", noCollisionToken, hashcash.ReasonNoCollision, true},
+		{"expired", expiredToken, hashcash.ReasonExpired, true},
+	}
+	for _, test := range tests {
+		r, err := hc.VerifyDetailed(test.token)
+		if r.Reason != test.reason || r.Reason != hashcash.ReasonOf(err) || (r.Stamp != nil) != test.stamp {
+			t.Errorf("%s: reason %v stamp %+v: %v\n", test.name, r.Reason, r.Stamp, err)
+		}
+	}
+	r, _ := hc.VerifyDetailed(noCollisionToken)
+	// measured although the collision check failed
+	if r.ZeroBits >= 20 || r.Stamp.Bits != 20 || r.Age < 365*24*time.Hour {
+		t.Errorf("%+v\n", r)
+	}
+	if r.Map()["reason"] != "collision" {
+		t.Errorf("%v\n", r.Map())
+	}
+}
+
+// storageV2 StorageV2 failing every operation once failing is set
+type storageV2 struct {
+	entries map[string]time.Time
+	failing bool
+}
+
+func (s *storageV2) Add(ctx context.Context, hash string, expires time.Time) error {
+	if s.failing {
+		return errors.New("backend down")
+	}
+	s.entries[hash] = expires
+	return nil
+}
+
+func (s *storageV2) Spent(ctx context.Context, hash string) (bool, error) {
+	if s.failing {
+		return false, errors.New("backend down")
+	}
+	_, ok := s.entries[hash]
+	return ok, nil
+}
+
+func TestStorageV2(t *testing.T) {
+	store := &storageV2{entries: make(map[string]time.Time)}
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = nil
+	config.StorageV2 = store
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	key, _ := hashcash.SpentKey(stamp)
+	// expires once stamps created with it are rejected, about 30 days on
+	if expires := store.entries[key]; time.Until(expires) < 29*24*time.Hour || time.Until(expires) > 31*24*time.Hour {
+		t.Errorf("expires %v\n", expires)
+	}
+	if _, err := hc.Verify(stamp); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+	store.failing = true
+	fresh, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(fresh); !errors.Is(err, hashcash.ErrStorage) {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := hc.Check(context.Background(), fresh); !errors.Is(err, hashcash.ErrStorage) {
+		t.Errorf("%v\n", err)
+	}
+	// adapted Storage never fails to check entries
+	adapted := hashcash.AdaptStorage(&MockStorage{})
+	if err := adapted.Add(context.Background(), "spent", time.Time{}); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	if spent, err := adapted.Spent(context.Background(), "spent"); !spent || err != nil {
+		t.Errorf("%v %v\n", spent, err)
+	}
+	// failures of Storage to add entries are reported too
+	config.StorageV2 = nil
+	config.Storage = failingAdd{}
+	hc, err = hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Accept: []string{"someone@gmail.com"}}, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if stamp, err = hc.ComputeContext(context.Background()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(stamp); !errors.Is(err, hashcash.ErrStorage) {
+		t.Errorf("failed add got %v\n", err)
+	}
+}
+
+// failingAdd Storage failing to add entries
+type failingAdd struct{}
+
+func (failingAdd) Add(string) error  { return errors.New("disk full") }
+func (failingAdd) Spent(string) bool { return false }
+
+func TestCheckAndAdd(t *testing.T) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = hashcash.NewMemoryStorage(nil)
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return true },
+		},
+		&config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		valid int
+	)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := hc.Verify(stamp); ok {
+				mu.Lock()
+				valid++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if valid != 1 {
+		t.Errorf("stamp verified %d times concurrently\n", valid)
+	}
+}
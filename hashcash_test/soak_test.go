@@ -0,0 +1,174 @@
+//go:build soak
+
+package hashcash_test
+
+import (
+	"context"
+	"crypto"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/chaos"
+)
+
+// Soak tests mint and verify continuously against each storage adapter,
+// failing if the heap grows by more than the adapter is expected to retain.
+// They are excluded from normal runs:
+//
+//	go test -tags soak -run TestSoak -timeout 0 ./hashcash_test -soak.duration 1h
+var (
+	soakDuration = flag.Duration("soak.duration", time.Minute, "duration of each soak test")
+	soakProfiles = flag.String("soak.profiles", "", "directory heap profiles are written to")
+)
+
+// soakSlack heap growth tolerated regardless of the number of operations
+const soakSlack = 4 << 20
+
+func TestSoak(t *testing.T) {
+	dir := t.TempDir()
+	adapters := []struct {
+		name    string
+		storage func() (hashcash.Storage, error)
+		hash    crypto.Hash
+		// perOp bytes each verification may retain, entries of unbounded
+		// storage.
+		perOp uint64
+	}{
+		{
+			name:    "memory",
+			storage: func() (hashcash.Storage, error) { return &MockStorage{}, nil },
+			perOp:   256,
+		},
+		{
+			name: "file",
+			storage: func() (hashcash.Storage, error) {
+				return hashcash.NewFileStorage(filepath.Join(dir, "spent.log"), &hashcash.FileConfig{Sync: hashcash.SyncNever})
+			},
+			perOp: 256,
+		},
+		{
+			name:    "replay-filter",
+			storage: soakFilter,
+		},
+		{
+			name:    "replay-filter-sha256",
+			storage: soakFilter,
+			hash:    crypto.SHA256,
+		},
+		{
+			name: "cache",
+			storage: func() (hashcash.Storage, error) {
+				backend, err := soakFilter()
+				return hashcash.NewCache(backend, &hashcash.CacheConfig{MaxEntries: 10000}), err
+			},
+		},
+		{
+			name: "chaos",
+			storage: func() (hashcash.Storage, error) {
+				backend, err := soakFilter()
+				return chaos.NewStorage(backend, &chaos.Config{AddErrorRate: 0.01, SpentMissRate: 0.01}), err
+			},
+		},
+	}
+	for _, adapter := range adapters {
+		t.Run(adapter.name, func(t *testing.T) {
+			storage, err := adapter.storage()
+			if err != nil {
+				t.Fatalf("%v\n", err)
+			}
+			soak(t, storage, adapter.hash, adapter.perOp)
+		})
+	}
+}
+
+// soakFilter bounded storage, retaining a fixed amount of memory.
+func soakFilter() (hashcash.Storage, error) {
+	return hashcash.NewReplayFilter(&hashcash.ReplayFilterConfig{
+		Window:   10 * time.Second,
+		Capacity: 1 << 20,
+	}), nil
+}
+
+// soak mints and verifies headers against storage for the soak duration,
+// checking the heap grew by at most perOp bytes per verification.
+func soak(t *testing.T, storage hashcash.Storage, hash crypto.Hash, perOp uint64) {
+	config := *testConfig
+	config.Bits = 8
+	config.Storage = storage
+	config.Hash = hash
+	config.ParseCacheTTL = time.Second
+	config.RetryWindow = time.Second
+	config.Reputation = hashcash.NewReputation(nil)
+	config.Expired = time.Now().Add(-time.Hour)
+	config.Future = time.Now().Add(*soakDuration + time.Hour)
+	resource := &hashcash.Resource{
+		Data:          "someone@gmail.com",
+		ValidatorFunc: func(res string) bool { return true },
+	}
+	verifier, err := hashcash.New(resource, &config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	run := func(d time.Duration) uint64 {
+		var ops uint64
+		for deadline := time.Now().Add(d); time.Now().Before(deadline); ops++ {
+			minter, err := hashcash.New(resource, &config)
+			if err != nil {
+				t.Fatalf("%v\n", err)
+			}
+			header, err := minter.ComputeContext(context.Background())
+			if err != nil {
+				t.Fatalf("%v\n", err)
+			}
+			remote := hashcash.Remote{Key: fmt.Sprintf("client-%d", ops%100)}
+			verifier.VerifyRemote(header, remote)
+			verifier.VerifyRemote(header, remote)
+			verifier.Verify(invalidToken)
+		}
+		return ops
+	}
+	// warm up pools, caches and storage before the baseline is taken
+	run(*soakDuration / 10)
+	before := heapAlloc()
+	ops := run(*soakDuration)
+	after := heapAlloc()
+	runtime.KeepAlive(verifier)
+	if *soakProfiles != "" {
+		writeHeapProfile(t, filepath.Join(*soakProfiles, t.Name()+".heap"))
+	}
+	limit := soakSlack + perOp*ops
+	t.Logf("%d verifications, heap %d -> %d bytes\n", ops, before, after)
+	if after > before && after-before > limit {
+		t.Errorf("heap grew %d bytes over %d verifications, limit %d\n", after-before, ops, limit)
+	}
+}
+
+// heapAlloc returns the bytes allocated on the heap after garbage collection.
+func heapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// writeHeapProfile writes a heap profile to path.
+func writeHeapProfile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer f.Close()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
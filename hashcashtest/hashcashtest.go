@@ -0,0 +1,175 @@
+/*
+Package hashcashtest builds hashcash stamps with specific defects on purpose,
+e.g. to drive negative tests of code verifying stamps, without hand crafting
+header strings.
+
+A StampBuilder describes the stamp declaratively. Unset fields take valid
+values, and the counter is searched for so the stamp has Bits leading zero
+bits, whatever bits it claims:
+
+	// claims 20 bits but only 8 were computed
+	stamp, err := hashcashtest.StampBuilder{
+		Resource:  "someone@gmail.com",
+		Bits:      8,
+		ClaimBits: "20",
+	}.Build()
+
+	// expired two months ago
+	stamp, err := hashcashtest.StampBuilder{
+		Resource: "someone@gmail.com",
+		Created:  time.Now().AddDate(0, -2, 0),
+	}.Build()
+
+	// date in the wrong format, oversized resource
+	stamp, err := hashcashtest.StampBuilder{
+		Resource: hashcashtest.Oversized(64 << 10),
+		Date:     "2024-01-01",
+	}.Build()
+*/
+package hashcashtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	// SHA-1, the default hash, is always available to Build.
+	_ "crypto/sha1"
+)
+
+const (
+	timeFormat    = "060102150405" // YYMMDDhhmmss
+	maxIterations = 1 << 24        // Counters tried before Build gives up
+)
+
+var (
+	// ErrSearch error no counter giving the requested bits was found
+	ErrSearch = errors.New("hashcashtest: no counter found for bits")
+
+	// ErrHashUnavailable error hash algorithm is not linked into the binary
+	ErrHashUnavailable = errors.New("hashcashtest: hash algorithm unavailable")
+)
+
+// StampBuilder describes a stamp to build. Fields left empty take values of
+// a valid version 1 stamp.
+type StampBuilder struct {
+	// Version version field, "1" when empty.
+	Version string
+	// Bits leading zero bits the digest of the stamp actually has, found by
+	// searching for a counter. Keep it small, e.g. 8, so Build is fast.
+	Bits int
+	// ClaimBits bits field, Bits when empty. Claiming more bits than Bits
+	// gives a stamp which fails the collision check.
+	ClaimBits string
+	// Created creation date, now when zero.
+	Created time.Time
+	// Date raw date field, in place of Created, e.g. "2024-01-01" for a date
+	// in the wrong format.
+	Date string
+	// Resource resource field.
+	Resource string
+	// Extension extension field.
+	Extension string
+	// Rand random field, random base-64 characters when empty.
+	Rand string
+	// Counter raw counter field. When set no counter is searched for, so
+	// the digest has whatever bits it happens to have, e.g. "!!bogus!!".
+	Counter string
+	// Extra fields appended after the counter, giving a stamp with too many
+	// fields.
+	Extra []string
+	// Hash algorithm the counter is searched for with, SHA-1 when zero.
+	Hash crypto.Hash
+}
+
+// Build builds the stamp. It fails with ErrSearch error if no counter giving
+// Bits leading zero bits is found.
+func (b StampBuilder) Build() (string, error) {
+	hash := b.Hash
+	if hash == 0 {
+		hash = crypto.SHA1
+	}
+	if !hash.Available() {
+		return "", ErrHashUnavailable
+	}
+	version := b.Version
+	if version == "" {
+		version = "1"
+	}
+	claim := b.ClaimBits
+	if claim == "" {
+		claim = strconv.Itoa(b.Bits)
+	}
+	date := b.Date
+	if date == "" {
+		created := b.Created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		date = created.UTC().Format(timeFormat)
+	}
+	rnd := b.Rand
+	if rnd == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		rnd = base64.StdEncoding.EncodeToString(buf)
+	}
+	prefix := strings.Join([]string{version, claim, date, b.Resource, b.Extension, rnd}, ":") + ":"
+	if b.Counter != "" {
+		return b.join(prefix + b.Counter), nil
+	}
+	h := hash.New()
+	for i := uint64(0); i < maxIterations; i++ {
+		stamp := prefix + base64.StdEncoding.EncodeToString([]byte(strconv.FormatUint(i, 10)))
+		h.Reset()
+		h.Write([]byte(stamp))
+		if leadingZeroBits(h.Sum(nil)) >= b.Bits {
+			return b.join(stamp), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %d", ErrSearch, b.Bits)
+}
+
+// MustBuild is like Build but panics if the stamp cannot be built. It
+// simplifies initialising test fixtures.
+func (b StampBuilder) MustBuild() string {
+	stamp, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return stamp
+}
+
+// join appends the extra fields to stamp.
+func (b StampBuilder) join(stamp string) string {
+	for _, field := range b.Extra {
+		stamp += ":" + field
+	}
+	return stamp
+}
+
+// Oversized returns a field value of n bytes, e.g. for a resource larger
+// than verifiers accept.
+func Oversized(n int) string {
+	return strings.Repeat("x", n)
+}
+
+// leadingZeroBits counts the number of leading zero bits in b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
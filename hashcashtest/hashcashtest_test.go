@@ -0,0 +1,83 @@
+package hashcashtest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/hashcashtest"
+)
+
+// mapStorage in memory storage
+type mapStorage map[string]bool
+
+func (m mapStorage) Add(hash string) error  { m[hash] = true; return nil }
+func (m mapStorage) Spent(hash string) bool { return m[hash] }
+
+// newInstance creates an instance requiring bits for someone@gmail.com,
+// accepting stamps created after expired.
+func newInstance(t *testing.T, bits hashcash.Bits, expired time.Time) *hashcash.Hashcash {
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return res == "someone@gmail.com" },
+		},
+		&hashcash.Config{
+			Bits:    bits,
+			Future:  time.Now().AddDate(0, 0, 2),
+			Expired: expired,
+			Storage: mapStorage{},
+		},
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return hc
+}
+
+func TestNoCollision(t *testing.T) {
+	// fixed fields, so the digests cannot have more bits by chance
+	hc := newInstance(t, 20, time.Time{})
+	tests := []struct {
+		name    string
+		builder hashcashtest.StampBuilder
+	}{
+		{"claimed bits", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8, ClaimBits: "20"}},
+		{"bogus counter", hashcashtest.StampBuilder{Resource: "someone@gmail.com", ClaimBits: "20", Counter: "!!bogus!!"}},
+	}
+	for _, test := range tests {
+		test.builder.Date = "240101"
+		test.builder.Rand = "AAAAAAAAAAA="
+		stamp := test.builder.MustBuild()
+		if _, err := hc.Verify(stamp); !errors.Is(err, hashcash.ErrNoCollision) {
+			t.Errorf("%s: %s: %v\n", test.name, stamp, err)
+		}
+	}
+}
+
+func TestStampBuilder(t *testing.T) {
+	hc := newInstance(t, 8, time.Now().AddDate(0, 0, -30))
+	tests := []struct {
+		name    string
+		builder hashcashtest.StampBuilder
+		err     error
+	}{
+		{"valid", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8}, nil},
+		{"date format", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8, Date: "2024-01-01"}, hashcash.ErrInvalidHeader},
+		{"expired", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8, Created: time.Now().AddDate(0, -2, 0)}, hashcash.ErrExpired},
+		{"future", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8, Created: time.Now().AddDate(0, 0, 7)}, hashcash.ErrFutureStamp},
+		{"resource", hashcashtest.StampBuilder{Resource: hashcashtest.Oversized(4096), Bits: 8}, hashcash.ErrResourceFail},
+		{"version", hashcashtest.StampBuilder{Version: "9", Resource: "someone@gmail.com", Bits: 8}, hashcash.ErrUnsupportedVersion},
+		{"extra fields", hashcashtest.StampBuilder{Resource: "someone@gmail.com", Bits: 8, Extra: []string{"x"}}, hashcash.ErrInvalidHeader},
+	}
+	for _, test := range tests {
+		stamp, err := test.builder.Build()
+		if err != nil {
+			t.Fatalf("%s: %v\n", test.name, err)
+		}
+		if _, err := hc.Verify(stamp); !errors.Is(err, test.err) {
+			t.Errorf("%s: %s: got %v want %v\n", test.name, stamp, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package httpmw
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrAmbiguous error request carries several distinct stamps
+	ErrAmbiguous = errors.New("httpmw: several distinct " + HeaderName + " stamps")
+
+	// ErrChecksum error stamp does not match its checksum, it was altered in
+	// transit
+	ErrChecksum = errors.New("httpmw: " + HeaderName + " checksum mismatch")
+)
+
+// checksumParam separates a stamp from its checksum
+const checksumParam = ";crc32="
+
+// WithChecksum returns stamp with a short checksum appended, e.g.
+// "1:20:...:ctr;crc32=1a2b3c4d", so Stamp can tell stamps altered in transit
+// from invalid ones, and undo whitespace inserted by proxies folding long
+// header values. Servers not using Stamp reject such stamps.
+func WithChecksum(stamp string) string {
+	return stamp + checksumParam + checksum(stamp)
+}
+
+// checksum returns the checksum of stamp.
+func checksum(stamp string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(stamp)))
+}
+
+// Stamp returns the stamp carried in the X-Hashcash header of h, undoing
+// common proxy transformations: header names in any case, values padded or
+// quoted, and the header duplicated or merged into one comma separated
+// value. Duplicates of the same stamp are collapsed, distinct stamps fail
+// with ErrAmbiguous. A checksum appended with WithChecksum is verified and
+// removed, failing with ErrChecksum on a mismatch. ErrMissing is returned
+// if h carries no stamp.
+func Stamp(h http.Header) (string, error) {
+	var stamp string
+	for name, values := range h {
+		if !strings.EqualFold(name, HeaderName) {
+			continue
+		}
+		for _, v := range values {
+			for _, part := range splitStamps(v) {
+				s, err := canonicalStamp(part)
+				if err != nil {
+					return "", err
+				}
+				if s == "" {
+					continue
+				}
+				if stamp != "" && s != stamp {
+					return "", ErrAmbiguous
+				}
+				stamp = s
+			}
+		}
+	}
+	if stamp == "" {
+		return "", ErrMissing
+	}
+	return stamp, nil
+}
+
+// splitStamps splits a header value merged by a proxy into its stamps. Only
+// commas followed by a version, e.g. "1:", separate stamps, as extensions
+// may contain commas.
+func splitStamps(v string) []string {
+	var parts []string
+	for _, p := range strings.Split(v, ",") {
+		if len(parts) > 0 && !startsStamp(p) {
+			parts[len(parts)-1] += "," + p
+			continue
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// startsStamp reports whether s, once trimmed, starts with a version field.
+func startsStamp(s string) bool {
+	s = strings.TrimLeft(s, " \t\"")
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i > 0 && i < len(s) && s[i] == ':'
+}
+
+// canonicalStamp trims s and checks its checksum if it carries one.
+func canonicalStamp(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	i := strings.LastIndex(s, checksumParam)
+	if i < 0 || i < strings.LastIndexByte(s, ':') {
+		return s, nil
+	}
+	stamp, sum := s[:i], strings.Join(strings.Fields(s[i+len(checksumParam):]), "")
+	if strings.EqualFold(checksum(stamp), sum) {
+		return stamp, nil
+	}
+	// whitespace inserted by proxies folding long values
+	if stripped := strings.Join(strings.Fields(stamp), ""); strings.EqualFold(checksum(stripped), sum) {
+		return stripped, nil
+	}
+	return "", ErrChecksum
+}
@@ -0,0 +1,156 @@
+/*
+Package httpmw requires hashcash stamps on HTTP requests, sent in the
+X-Hashcash header and minted for a resource derived from the request, by
+default its host and path:
+
+	handler := httpmw.RequireHashcash(mux, &httpmw.Config{
+		Hashcash: &hashcash.Config{Bits: 20, Storage: storage, ...},
+	})
+
+Clients mint a stamp for Resource(host, path) of the request they send, or
+send requests through a Transport which mints them.
+*/
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/umahmood/hashcash"
+)
+
+// HeaderName header carrying the stamp
+const HeaderName = "X-Hashcash"
+
+// VersionsHeaderName header of rejections advertising the stamp format
+// versions accepted, see hashcash.FormatStampVersions.
+const VersionsHeaderName = "X-Hashcash-Versions"
+
+var (
+	// ErrMissing error request does not carry a stamp
+	ErrMissing = errors.New("httpmw: missing " + HeaderName + " header")
+	// ErrNoStorage error configuration sets no spent storage
+	ErrNoStorage = errors.New("httpmw: Config.Hashcash sets no storage")
+)
+
+// Config for the middleware
+type Config struct {
+	// Hashcash configuration stamps are verified with. Storage or StorageV2
+	// must be set. A single instance verifies every request, so windows,
+	// caches and reputation are shared by all of them.
+	Hashcash *hashcash.Config
+	// Resource optional function returning the resource stamps for r must
+	// be minted for, Resource(r.Host, r.URL.Path) when nil.
+	Resource func(r *http.Request) string
+	// Remote optional function identifying the client of r, for
+	// reputation and accounting, its IP address when nil.
+	Remote func(r *http.Request) hashcash.Remote
+	// OnReject optional callback invoked when a request is rejected.
+	OnReject func(r *http.Request, err error)
+}
+
+// Resource returns the resource a stamp for a request to host and path must
+// be minted for: the lower cased host name without its port, followed by the
+// path. Colons are escaped, so IPv6 hosts and paths do not break the stamp
+// format.
+func Resource(host, path string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ReplaceAll(strings.ToLower(host)+path, ":", "%3A")
+}
+
+// RequireHashcash rejects requests which do not carry a valid stamp for
+// their resource in the X-Hashcash header, passing the others to next.
+// The header is read with Stamp, undoing common proxy transformations.
+// Requests are rejected with a plain text body describing the failure and
+// status 400 Bad Request if the header was altered in transit or carries
+// several stamps, 402 Payment Required if the stamp has too few bits, 429
+// Too Many Requests if it has already been spent or the client is blocked,
+// 503 Service Unavailable if spent storage failed, and 401 Unauthorized
+// otherwise. Transport retries with more bits on 402 and 429.
+//
+// It panics if cfg.Hashcash sets no storage or is invalid, as
+// http.Handle does for a nil handler.
+func RequireHashcash(next http.Handler, cfg *Config) http.Handler {
+	if cfg.Hashcash == nil || cfg.Hashcash.Storage == nil && cfg.Hashcash.StorageV2 == nil {
+		panic(ErrNoStorage)
+	}
+	hc, err := hashcash.New(&hashcash.Resource{
+		ValidatorContextFunc: func(ctx context.Context, resource string) bool {
+			want, ok := ctx.Value(resourceKey{}).(string)
+			return ok && resource == want
+		},
+	}, cfg.Hashcash)
+	if err != nil {
+		panic("httpmw: " + err.Error())
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := resourceOf(cfg, r)
+		if err := verify(hc, cfg, r, resource); err != nil {
+			if cfg.OnReject != nil {
+				cfg.OnReject(r, err)
+			}
+			reject(w, resource, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resourceKey context key of the resource of the request being verified
+type resourceKey struct{}
+
+// resourceOf returns the resource of r.
+func resourceOf(cfg *Config, r *http.Request) string {
+	if cfg.Resource != nil {
+		return cfg.Resource(r)
+	}
+	return Resource(r.Host, r.URL.Path)
+}
+
+// verify checks the stamp of r against resource with hc.
+func verify(hc *hashcash.Hashcash, cfg *Config, r *http.Request, resource string) error {
+	stamp, err := Stamp(r.Header)
+	if err != nil {
+		return err
+	}
+	remote := hashcash.Remote{Key: remoteKey(r)}
+	if cfg.Remote != nil {
+		remote = cfg.Remote(r)
+	}
+	ctx := context.WithValue(r.Context(), resourceKey{}, resource)
+	_, err = hc.VerifyContext(ctx, stamp, remote)
+	return err
+}
+
+// remoteKey returns the IP address of the client of r.
+func remoteKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// reject writes an error response for a request rejected with err.
+func reject(w http.ResponseWriter, resource string, err error) {
+	status := http.StatusUnauthorized
+	switch {
+	case errors.Is(err, ErrChecksum), errors.Is(err, ErrAmbiguous):
+		status = http.StatusBadRequest
+	case errors.Is(err, hashcash.ErrNoCollision), errors.Is(err, hashcash.ErrInsufficientBits):
+		status = http.StatusPaymentRequired
+	case errors.Is(err, hashcash.ErrSpent), errors.Is(err, hashcash.ErrBlocked):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, hashcash.ErrStorage):
+		status = http.StatusServiceUnavailable
+	}
+	msg := fmt.Sprintf("hashcash stamp for resource %q required in the %s header: %v", resource, HeaderName, err)
+	w.Header().Set(VersionsHeaderName, hashcash.FormatStampVersions(hashcash.StampVersions()))
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,196 @@
+package httpmw_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/httpmw"
+)
+
+var config = &hashcash.Config{
+	Bits:    8,
+	Future:  time.Now().AddDate(0, 0, 2),
+	Expired: time.Now().AddDate(0, 0, -30),
+	Storage: hashcash.NewMemoryStorage(nil),
+}
+
+// mint computes a stamp for resource.
+func mint(t *testing.T, resource string) string {
+	hc, err := hashcash.New(&hashcash.Resource{Data: resource}, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return stamp
+}
+
+func TestRequireHashcash(t *testing.T) {
+	var rejected error
+	handler := httpmw.RequireHashcash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}), &httpmw.Config{
+		Hashcash: config,
+		OnReject: func(r *http.Request, err error) { rejected = err },
+	})
+	request := func(url, stamp string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, url, nil)
+		if stamp != "" {
+			r.Header.Set(httpmw.HeaderName, stamp)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	w := request("http://example.com/comments", "")
+	if w.Code != http.StatusUnauthorized || !errors.Is(rejected, httpmw.ErrMissing) {
+		t.Errorf("missing stamp got %d: %v\n", w.Code, rejected)
+	}
+	if !strings.Contains(w.Body.String(), `"example.com/comments"`) {
+		t.Errorf("body %q does not name the resource\n", w.Body.String())
+	}
+	stamp := mint(t, httpmw.Resource("Example.com:8080", "/comments"))
+	if w := request("http://example.com/other", stamp); w.Code != http.StatusUnauthorized {
+		t.Errorf("stamp for another path got %d\n", w.Code)
+	}
+	if w := request("http://example.com/comments", stamp); w.Code != http.StatusCreated {
+		t.Errorf("valid stamp got %d: %s\n", w.Code, w.Body.String())
+	}
+	if w := request("http://example.com/comments", stamp); w.Code != http.StatusTooManyRequests {
+		t.Errorf("replayed stamp got %d\n", w.Code)
+	}
+	if r := httpmw.Resource("[::1]:443", "/a:b"); r != "%3A%3A1/a%3Ab" {
+		t.Errorf("resource %q\n", r)
+	}
+}
+
+func TestRequireHashcashNoStorage(t *testing.T) {
+	defer func() {
+		if err := recover(); err != httpmw.ErrNoStorage {
+			t.Errorf("got %v\n", err)
+		}
+	}()
+	httpmw.RequireHashcash(http.NotFoundHandler(), &httpmw.Config{
+		Hashcash: &hashcash.Config{Bits: 8},
+	})
+}
+
+func TestTransport(t *testing.T) {
+	server := *config
+	server.Bits = 16
+	srv := httptest.NewServer(httpmw.RequireHashcash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}), &httpmw.Config{Hashcash: &server}))
+	defer srv.Close()
+	post := func(transport http.RoundTripper) (int, string) {
+		client := &http.Client{Transport: transport}
+		resp, err := client.Post(srv.URL+"/comments", "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	// too few bits to meet 16 by chance
+	client := *config
+	client.Bits = 0
+	if code, _ := post(httpmw.NewTransport(nil, &httpmw.TransportConfig{Hashcash: &client})); code != http.StatusPaymentRequired {
+		t.Errorf("insufficient bits got %d\n", code)
+	}
+	client.Bits = 8
+	code, body := post(httpmw.NewTransport(nil, &httpmw.TransportConfig{
+		Hashcash:  &client,
+		Retries:   2,
+		RetryBits: 4,
+		Checksum:  true,
+	}))
+	if code != http.StatusOK || body != "hello" {
+		t.Errorf("retried request got %d %q\n", code, body)
+	}
+	// requests without a body are retried too
+	get := &http.Client{Transport: httpmw.NewTransport(nil, &httpmw.TransportConfig{
+		Hashcash:  &client,
+		Retries:   2,
+		RetryBits: 4,
+	})}
+	resp, err := get.Get(srv.URL + "/comments")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("retried GET got %d\n", resp.StatusCode)
+	}
+	// rejections advertise the versions accepted, servers sharing none with
+	// the client are not retried
+	resp, err = http.Get(srv.URL + "/comments")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	resp.Body.Close()
+	if v := resp.Header.Get(httpmw.VersionsHeaderName); v != "1" {
+		t.Errorf("advertised versions %q\n", v)
+	}
+	sent := 0
+	future := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Header().Set(httpmw.VersionsHeaderName, "2,3")
+		w.WriteHeader(http.StatusPaymentRequired)
+	}))
+	defer future.Close()
+	resp, err = httpmw.NewTransport(nil, &httpmw.TransportConfig{Hashcash: &client, Retries: 2}).RoundTrip(httptest.NewRequest(http.MethodGet, future.URL, nil))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	resp.Body.Close()
+	if sent != 1 {
+		t.Errorf("sent %d requests to a server sharing no version\n", sent)
+	}
+}
+
+func TestStamp(t *testing.T) {
+	const (
+		stamp = "1:20:231231:someone@gmail.com:a;b=c,d:Uv38ByGCZU8=:1RBNx2cN"
+		other = "1:20:231231:someone@gmail.com::XYIGWLSA8qw=:4o5ofpVX"
+	)
+	sum := httpmw.WithChecksum(stamp)
+	folded := sum[:20] + "\r\n " + sum[20:]
+	// header as forwarded by a proxy
+	tests := []struct {
+		name   string
+		header http.Header
+		stamp  string
+		err    error
+	}{
+		{"verbatim", http.Header{"X-Hashcash": {stamp}}, stamp, nil},
+		{"lower cased name", http.Header{"x-hashcash": {stamp}}, stamp, nil},
+		{"padded", http.Header{"X-Hashcash": {" \t" + stamp + " "}}, stamp, nil},
+		{"quoted", http.Header{"X-Hashcash": {`"` + stamp + `"`}}, stamp, nil},
+		{"duplicated", http.Header{"X-Hashcash": {stamp, stamp}}, stamp, nil},
+		{"merged", http.Header{"X-Hashcash": {stamp + ", " + stamp}}, stamp, nil},
+		{"checksum", http.Header{"X-Hashcash": {sum}}, stamp, nil},
+		{"checksum merged", http.Header{"X-Hashcash": {sum + "," + stamp}}, stamp, nil},
+		{"folded", http.Header{"X-Hashcash": {folded}}, stamp, nil},
+		{"folded without checksum", http.Header{"X-Hashcash": {stamp[:20] + " " + stamp[20:]}}, stamp[:20] + " " + stamp[20:], nil},
+		{"truncated", http.Header{"X-Hashcash": {sum[:30] + sum[31:]}}, "", httpmw.ErrChecksum},
+		{"distinct", http.Header{"X-Hashcash": {stamp + ", " + other}}, "", httpmw.ErrAmbiguous},
+		{"distinct names", http.Header{"X-Hashcash": {stamp}, "x-hashcash": {other}}, "", httpmw.ErrAmbiguous},
+		{"missing", http.Header{"X-Other": {stamp}}, "", httpmw.ErrMissing},
+		{"empty", http.Header{"X-Hashcash": {" "}}, "", httpmw.ErrMissing},
+	}
+	for _, test := range tests {
+		s, err := httpmw.Stamp(test.header)
+		if s != test.stamp || err != test.err {
+			t.Errorf("%s: got %q %v, want %q %v\n", test.name, s, err, test.stamp, test.err)
+		}
+	}
+}
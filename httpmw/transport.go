@@ -0,0 +1,154 @@
+package httpmw
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/umahmood/hashcash"
+)
+
+// TransportConfig for a transport
+type TransportConfig struct {
+	// Hashcash configuration stamps are minted with, NewDefaultConfig when
+	// nil. Stamps are minted with its Bits and Hash.
+	Hashcash *hashcash.Config
+	// Resource optional function returning the resource stamps for r are
+	// minted for, Resource of the host and path of r when nil.
+	Resource func(r *http.Request) string
+	// Retries how many times a request rejected with 429 Too Many Requests
+	// or 402 Payment Required is sent again with a stamp of RetryBits more
+	// bits. Zero never retries.
+	Retries int
+	// RetryBits bits added on each retry, 2 when zero.
+	RetryBits hashcash.Bits
+	// Checksum append a checksum to stamps with WithChecksum, for servers
+	// reading them with Stamp.
+	Checksum bool
+}
+
+// Transport http.RoundTripper minting a stamp for each request and sending
+// it in the X-Hashcash header, so servers behind RequireHashcash accept it:
+//
+//	client := &http.Client{
+//		Transport: httpmw.NewTransport(nil, &httpmw.TransportConfig{Retries: 2}),
+//	}
+//
+// Requests with a body are only retried if their GetBody is set, as by
+// http.NewRequest. It is safe for concurrent use.
+type Transport struct {
+	base   http.RoundTripper
+	config TransportConfig
+	mint   hashcash.Config
+}
+
+// NewTransport creates a transport sending requests with base,
+// http.DefaultTransport when nil. If config is nil the defaults are used.
+func NewTransport(base http.RoundTripper, config *TransportConfig) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if config == nil {
+		config = &TransportConfig{}
+	}
+	t := &Transport{base: base, config: *config}
+	if config.Hashcash != nil {
+		t.mint = *config.Hashcash
+	} else {
+		t.mint = *hashcash.NewDefaultConfig()
+	}
+	// minting never touches storage, this avoids opening the default one
+	if t.mint.Storage == nil && t.mint.StorageV2 == nil {
+		t.mint.Storage = hashcash.NewMemoryStorage(nil)
+	}
+	if t.config.RetryBits == 0 {
+		t.config.RetryBits = 2
+	}
+	return t
+}
+
+// RoundTrip sends req with a freshly minted stamp, retrying rejected
+// requests with more bits up to Retries times. Rejections advertising only
+// stamp format versions which cannot be minted in VersionsHeaderName are not
+// retried.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := t.resourceOf(req)
+	bits := t.mint.Bits
+	for retry := 0; ; retry++ {
+		r := req.Clone(req.Context())
+		if retry > 0 && hasBody(req) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		stamp, err := t.stamp(req.Context(), resource, bits)
+		if err != nil {
+			if r.Body != nil {
+				r.Body.Close()
+			}
+			return nil, err
+		}
+		if t.config.Checksum {
+			stamp = WithChecksum(stamp)
+		}
+		r.Header.Set(HeaderName, stamp)
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || retry >= t.config.Retries || !rejected(resp) || !rewindable(req) || !negotiable(resp.Header) {
+			return resp, err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		bits += t.config.RetryBits
+	}
+}
+
+// resourceOf returns the resource of r.
+func (t *Transport) resourceOf(r *http.Request) string {
+	if t.config.Resource != nil {
+		return t.config.Resource(r)
+	}
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	return Resource(host, r.URL.Path)
+}
+
+// stamp mints a stamp of bits for resource.
+func (t *Transport) stamp(ctx context.Context, resource string, bits hashcash.Bits) (string, error) {
+	config := t.mint
+	config.Bits = bits
+	hc, err := hashcash.New(&hashcash.Resource{Data: resource}, &config)
+	if err != nil {
+		return "", err
+	}
+	return hc.ComputeContext(ctx)
+}
+
+// rejected reports whether resp asks for more work.
+func rejected(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusPaymentRequired
+}
+
+// negotiable reports whether a stamp format version advertised in h, if any,
+// can be minted, so a retry may be accepted.
+func negotiable(h http.Header) bool {
+	v := h.Get(VersionsHeaderName)
+	if v == "" {
+		return true
+	}
+	_, ok := hashcash.NegotiateStampVersion(hashcash.ParseStampVersions(v))
+	return ok
+}
+
+// rewindable reports whether the body of req can be sent again.
+func rewindable(req *http.Request) bool {
+	return !hasBody(req) || req.GetBody != nil
+}
+
+// hasBody reports whether req has a body to send.
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
@@ -0,0 +1,62 @@
+package hashcash
+
+import (
+	"sync"
+	"time"
+)
+
+// verified a header verified by a remote key
+type verified struct {
+	hash string
+	key  string
+	at   time.Time
+}
+
+// retryCache remembers which remote key verified a header, so the same remote
+// retrying within window is not rejected as a double spend. It is safe for
+// concurrent use.
+type retryCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	byHash map[string]verified
+	// order entries ordered by verification time, used to expire entries.
+	order []verified
+}
+
+// newRetryCache creates a new retry cache.
+func newRetryCache(window time.Duration) *retryCache {
+	return &retryCache{
+		window: window,
+		byHash: make(map[string]verified),
+	}
+}
+
+// add records that key verified hash.
+func (r *retryCache) add(hash, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.expire(now)
+	v := verified{hash: hash, key: key, at: now}
+	r.byHash[hash] = v
+	r.order = append(r.order, v)
+}
+
+// retry reports whether key verified hash within the window.
+func (r *retryCache) retry(hash, key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.byHash[hash]
+	return ok && v.key == key && time.Since(v.at) <= r.window
+}
+
+// expire removes entries older than the window.
+func (r *retryCache) expire(now time.Time) {
+	i := 0
+	for ; i < len(r.order) && now.Sub(r.order[i].at) > r.window; i++ {
+		if v := r.byHash[r.order[i].hash]; v.at.Equal(r.order[i].at) {
+			delete(r.byHash, r.order[i].hash)
+		}
+	}
+	r.order = r.order[i:]
+}
@@ -0,0 +1,75 @@
+/*
+Package jwt carries hashcash stamps as JWT claims, so JWT based auth pipelines
+can carry proof-of-work without new headers or handshakes.
+
+The helpers operate on claims as a map, so they work with any JWT library
+whose claims are a map[string]interface{}, e.g. jwt.MapClaims:
+
+	claims := jwt.MapClaims{"sub": "someone@gmail.com"}
+	hcjwt.SetStamp(claims, stamp)
+	...
+	valid, err := hcjwt.VerifyStamp(hc, token.Claims.(jwt.MapClaims), true)
+
+The token signature must be checked by the JWT library before VerifyStamp.
+*/
+package jwt
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/umahmood/hashcash"
+)
+
+// ClaimName name of the claim carrying the stamp.
+const ClaimName = "hashcash"
+
+var (
+	// ErrNoClaim error claims do not carry a hashcash stamp
+	ErrNoClaim = errors.New("no hashcash claim")
+
+	// ErrSubject error stamp was not minted for the token subject
+	ErrSubject = errors.New("hashcash claim resource does not match subject")
+)
+
+// SetStamp adds stamp to claims.
+func SetStamp(claims map[string]interface{}, stamp string) {
+	claims[ClaimName] = stamp
+}
+
+// Stamp returns the stamp carried by claims.
+func Stamp(claims map[string]interface{}) (string, error) {
+	stamp, ok := claims[ClaimName].(string)
+	if !ok || stamp == "" {
+		return "", ErrNoClaim
+	}
+	return stamp, nil
+}
+
+// VerifyStamp verifies the stamp carried by claims with hc, e.g. a
+// *hashcash.Hashcash. If bindSubject is set, the stamp must have been minted
+// for the token's "sub" claim, so a stamp cannot be moved between tokens of
+// different subjects.
+func VerifyStamp(hc hashcash.Verifier, claims map[string]interface{}, bindSubject bool) (bool, error) {
+	stamp, err := Stamp(claims)
+	if err != nil {
+		return false, err
+	}
+	if bindSubject {
+		sub, _ := claims["sub"].(string)
+		if sub == "" || resource(stamp) != sub {
+			return false, ErrSubject
+		}
+	}
+	return hc.Verify(stamp)
+}
+
+// resource returns the resource field of stamp.
+func resource(stamp string) string {
+	// vals: [version bits date resource extension random counter]
+	vals := strings.Split(stamp, ":")
+	if len(vals) < 4 {
+		return ""
+	}
+	return vals[3]
+}
@@ -0,0 +1,81 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/jwt"
+)
+
+// mapStorage in memory storage
+type mapStorage map[string]bool
+
+func (m mapStorage) Add(hash string) error  { m[hash] = true; return nil }
+func (m mapStorage) Spent(hash string) bool { return m[hash] }
+
+// mockVerifier verifier accepting every stamp, recording the last one
+type mockVerifier struct{ stamp string }
+
+func (m *mockVerifier) Verify(stamp string) (bool, error) {
+	m.stamp = stamp
+	return true, nil
+}
+
+func (m *mockVerifier) VerifyContext(_ context.Context, stamp string, _ hashcash.Remote) (bool, error) {
+	return m.Verify(stamp)
+}
+
+func TestVerifyStampMock(t *testing.T) {
+	var (
+		mock   = &mockVerifier{}
+		claims = map[string]interface{}{}
+	)
+	jwt.SetStamp(claims, "1:20:040806:foo::65f460d0726f420d:13a6b8")
+	if valid, err := jwt.VerifyStamp(mock, claims, false); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if mock.stamp != "1:20:040806:foo::65f460d0726f420d:13a6b8" {
+		t.Errorf("verified %q\n", mock.stamp)
+	}
+}
+
+func TestVerifyStamp(t *testing.T) {
+	config := &hashcash.Config{
+		Bits:    8,
+		Future:  time.Now().AddDate(0, 0, 2),
+		Expired: time.Now().AddDate(0, 0, -30),
+		Storage: mapStorage{},
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(string) bool { return true },
+		},
+		config,
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := jwt.VerifyStamp(hc, map[string]interface{}{}, false); err != jwt.ErrNoClaim {
+		t.Errorf("%v\n", err)
+	}
+	other := map[string]interface{}{"sub": "other@gmail.com"}
+	jwt.SetStamp(other, stamp)
+	if _, err := jwt.VerifyStamp(hc, other, true); err != jwt.ErrSubject {
+		t.Errorf("%v\n", err)
+	}
+	claims := map[string]interface{}{"sub": "someone@gmail.com"}
+	jwt.SetStamp(claims, stamp)
+	if valid, err := jwt.VerifyStamp(hc, claims, true); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := jwt.VerifyStamp(hc, claims, true); err != hashcash.ErrSpent {
+		t.Errorf("%v\n", err)
+	}
+}
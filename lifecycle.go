@@ -0,0 +1,189 @@
+package hashcash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Component background component of the library, e.g. a pre-miner or purge
+// loop. Start starts its goroutines, which run until Close is called or ctx
+// is done. Close stops them and waits for them to exit.
+type Component interface {
+	Start(ctx context.Context) error
+	Close() error
+}
+
+// runner Component running a blocking function in a goroutine
+type runner struct {
+	run    func(ctx context.Context) error
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// RunFunc returns a Component running run in a goroutine from Start until
+// Close, e.g. Wallet.PreMine or clockcheck.Checker.Run. run must return once
+// its context is done. Errors other than the context's are returned by Close.
+func RunFunc(run func(ctx context.Context) error) Component {
+	return &runner{run: run}
+}
+
+// Start starts run, unless it is running.
+func (r *runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done != nil {
+		return nil
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		err := r.run(ctx)
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			err = nil
+		}
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+	}(r.done)
+	return nil
+}
+
+// Close cancels run and waits for it to return.
+func (r *runner) Close() error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = nil
+	return r.err
+}
+
+// PurgeLoop returns a Component purging entries of storage older than window
+// every interval, for storage which does not expire entries itself.
+func PurgeLoop(storage Purger, window, interval time.Duration) Component {
+	return RunFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				if err := storage.PurgeExpired(time.Now().Add(-window)); err != nil {
+					return err
+				}
+			}
+		}
+	})
+}
+
+// RuntimeConfig for a runtime
+type RuntimeConfig struct {
+	// ShutdownTimeout bound on the time Close waits for each component.
+	ShutdownTimeout time.Duration
+}
+
+// DefaultRuntimeConfig default runtime configuration
+var DefaultRuntimeConfig = &RuntimeConfig{
+	ShutdownTimeout: 10 * time.Second,
+}
+
+// namedComponent component added to a runtime
+type namedComponent struct {
+	name string
+	c    Component
+}
+
+// Runtime manages the lifecycle of background components, so services
+// embedding the library can start and stop its goroutines together. It is
+// safe for concurrent use.
+type Runtime struct {
+	mu         sync.Mutex
+	config     RuntimeConfig
+	components []namedComponent
+	// started number of components started, in order.
+	started int
+}
+
+// NewRuntime creates a runtime. If config is nil DefaultRuntimeConfig is
+// used.
+func NewRuntime(config *RuntimeConfig) *Runtime {
+	if config == nil {
+		config = DefaultRuntimeConfig
+	}
+	return &Runtime{config: *config}
+}
+
+// Add adds component c under name, used in errors. Components added after
+// Start are started by the next call to Start.
+func (r *Runtime) Add(name string, c Component) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components = append(r.components, namedComponent{name: name, c: c})
+}
+
+// Start starts components in the order they were added. If a component fails
+// to start, those already started are closed and its error is returned.
+func (r *Runtime) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ; r.started < len(r.components); r.started++ {
+		nc := r.components[r.started]
+		if err := nc.c.Start(ctx); err != nil {
+			r.close()
+			return fmt.Errorf("%s: %w", nc.name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes started components in reverse order, waiting at most
+// ShutdownTimeout for each. Components which do not stop in time fail with
+// ErrShutdownTimeout and are left running. Errors are joined with
+// errors.Join.
+func (r *Runtime) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+// close closes started components. r.mu must be held.
+func (r *Runtime) close() error {
+	var errs []error
+	for ; r.started > 0; r.started-- {
+		nc := r.components[r.started-1]
+		if err := r.closeComponent(nc.c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", nc.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeComponent closes c, waiting at most ShutdownTimeout.
+func (r *Runtime) closeComponent(c Component) error {
+	if r.config.ShutdownTimeout <= 0 {
+		return c.Close()
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Close() }()
+	timer := time.NewTimer(r.config.ShutdownTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrShutdownTimeout
+	}
+}
@@ -0,0 +1,15 @@
+//go:build (!unix && !windows) || tinygo
+
+package hashcash
+
+import "os"
+
+// tryLockFile file locking is not supported, shared file storage fails.
+func tryLockFile(f *os.File) (bool, error) {
+	return false, ErrLockUnsupported
+}
+
+// unlockFile file locking is not supported.
+func unlockFile(f *os.File) error {
+	return ErrLockUnsupported
+}
@@ -0,0 +1,23 @@
+//go:build unix && !tinygo
+
+package hashcash
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an exclusive advisory lock on f without blocking,
+// reporting whether it was taken.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,81 @@
+/*
+Package mail reads and writes hashcash headers in email messages.
+
+Stamps are carried in X-Hashcash header fields. Long stamps are folded to fit
+the RFC 5322 line length limit when written, and unfolded when read, since
+whitespace is not part of a hashcash stamp. A message may carry several
+stamps, e.g. one per recipient, which are kept in the order they appear.
+
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		// handle error
+	}
+	for _, stamp := range hcmail.Stamps(msg.Header) {
+		valid, err := hc.Verify(stamp)
+		...
+	}
+*/
+package mail
+
+import (
+	"io"
+	netmail "net/mail"
+	"strings"
+)
+
+const (
+	// HeaderName header field carrying hashcash stamps.
+	HeaderName = "X-Hashcash"
+	// lineLimit recommended maximum line length, excluding CRLF.
+	lineLimit = 78
+)
+
+// Stamps returns the hashcash stamps in header, unfolded, in the order they
+// appear in the message.
+func Stamps(header netmail.Header) []string {
+	var stamps []string
+	for _, v := range header[HeaderName] {
+		if s := Unfold(v); s != "" {
+			stamps = append(stamps, s)
+		}
+	}
+	return stamps
+}
+
+// Unfold removes folding whitespace from a header value.
+func Unfold(value string) string {
+	return strings.Join(strings.Fields(value), "")
+}
+
+// Fold formats stamp as a complete X-Hashcash header field, including the
+// trailing CRLF. Lines longer than the RFC 5322 limit are folded by
+// inserting CRLF followed by a space.
+func Fold(stamp string) string {
+	var (
+		b    strings.Builder
+		line = HeaderName + ": "
+	)
+	for len(line)+len(stamp) > lineLimit {
+		n := lineLimit - len(line)
+		b.WriteString(line)
+		b.WriteString(stamp[:n])
+		b.WriteString("\r\n")
+		stamp = stamp[n:]
+		line = " "
+	}
+	b.WriteString(line)
+	b.WriteString(stamp)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// WriteStamps writes stamps to w as folded X-Hashcash header fields, in
+// order.
+func WriteStamps(w io.Writer, stamps []string) error {
+	for _, s := range stamps {
+		if _, err := io.WriteString(w, Fold(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package mail_test
+
+import (
+	"bytes"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/umahmood/hashcash/mail"
+)
+
+// message with stamps for two recipients, the second folded by its MTA.
+const message = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com, carol@example.org\r\n" +
+	"Subject: lunch\r\n" +
+	"X-Hashcash: 1:20:040806:bob@example.com::65f460d0726f420d:13a6b8\r\n" +
+	"Message-ID: <1234@example.com>\r\n" +
+	"X-Hashcash: 1:20:040806:carol@example.org::\r\n" +
+	"\t2M6FmM7eRvw=:MjU5ODg5\r\n" +
+	"\r\n" +
+	"See you at noon.\r\n"
+
+func TestStamps(t *testing.T) {
+	msg, err := netmail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamps := mail.Stamps(msg.Header)
+	want := []string{
+		"1:20:040806:bob@example.com::65f460d0726f420d:13a6b8",
+		"1:20:040806:carol@example.org::2M6FmM7eRvw=:MjU5ODg5",
+	}
+	if len(stamps) != len(want) {
+		t.Fatalf("got %q\n", stamps)
+	}
+	for i := range want {
+		if stamps[i] != want[i] {
+			t.Errorf("stamp %d got %q want %q\n", i, stamps[i], want[i])
+		}
+	}
+}
+
+func TestFoldRoundTrip(t *testing.T) {
+	stamps := []string{
+		"1:20:040806:" + strings.Repeat("a", 120) + "@example.com::65f460d0726f420d:13a6b8",
+		"1:20:040806:bob@example.com::65f460d0726f420d:13a6b8",
+	}
+	var buf bytes.Buffer
+	if err := mail.WriteStamps(&buf, stamps); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line too long %d: %q\n", len(line), line)
+		}
+	}
+	buf.WriteString("\r\nbody\r\n")
+	msg, err := netmail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	got := mail.Stamps(msg.Header)
+	if len(got) != 2 || got[0] != stamps[0] || got[1] != stamps[1] {
+		t.Errorf("got %q\n", got)
+	}
+}
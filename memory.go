@@ -0,0 +1,269 @@
+package hashcash
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryConfig for in-memory storage
+type MemoryConfig struct {
+	// TTL how long entries are kept, at least the window in which headers
+	// are accepted. Defaults to 30 days, longer than the default
+	// expiry window.
+	TTL time.Duration
+	// MaxEntries bound on entries held, the oldest entries are evicted first
+	// when full, so headers they recorded could be spent again. Defaults to
+	// 1<<20 entries, about 100MB.
+	MaxEntries int
+	// EvictInterval minimum time between sweeps of expired entries, which
+	// are run by Add. Defaults to a minute.
+	EvictInterval time.Duration
+}
+
+// DefaultMemoryConfig default in-memory storage configuration
+var DefaultMemoryConfig = &MemoryConfig{
+	TTL:           30 * 24 * time.Hour,
+	MaxEntries:    1 << 20,
+	EvictInterval: time.Minute,
+}
+
+// memoryEntry entry in insertion order
+type memoryEntry struct {
+	hash  string
+	added time.Time
+}
+
+// MemoryStorage spent storage in memory, with per entry TTL and bounded size.
+// Expired entries are treated as absent when looked up, and swept in
+// insertion order by Add at most every EvictInterval, so no goroutine is
+// needed. Entries are lost when the process exits. It is safe for concurrent
+// use.
+type MemoryStorage struct {
+	config  MemoryConfig
+	mu      sync.Mutex
+	entries map[string]time.Time
+	// order entries in insertion order from head, used for eviction.
+	order []memoryEntry
+	head  int
+	swept time.Time
+	now   func() time.Time
+	// leases held, see AcquireLease.
+	leases map[string]memoryLease
+}
+
+// memoryLease lease held in memory
+type memoryLease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewMemoryStorage creates in-memory storage. If config is nil
+// DefaultMemoryConfig is used, zero fields take their defaults.
+func NewMemoryStorage(config *MemoryConfig) *MemoryStorage {
+	if config == nil {
+		config = DefaultMemoryConfig
+	}
+	m := &MemoryStorage{
+		config:  *config,
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+	}
+	if m.config.TTL <= 0 {
+		m.config.TTL = DefaultMemoryConfig.TTL
+	}
+	if m.config.MaxEntries <= 0 {
+		m.config.MaxEntries = DefaultMemoryConfig.MaxEntries
+	}
+	if m.config.EvictInterval <= 0 {
+		m.config.EvictInterval = DefaultMemoryConfig.EvictInterval
+	}
+	return m
+}
+
+// Add adds a hashcash entry
+func (m *MemoryStorage) Add(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(hash, m.now())
+	return nil
+}
+
+// add adds hash at now, sweeping expired entries every EvictInterval. m.mu
+// must be held.
+func (m *MemoryStorage) add(hash string, now time.Time) {
+	if now.Sub(m.swept) >= m.config.EvictInterval {
+		m.purge(now.Add(-m.config.TTL))
+		m.swept = now
+	}
+	if _, ok := m.entries[hash]; !ok && len(m.entries) >= m.config.MaxEntries {
+		m.evict()
+	}
+	m.entries[hash] = now
+	m.order = append(m.order, memoryEntry{hash: hash, added: now})
+	m.compact()
+}
+
+// CheckAndAdd adds a hashcash entry unless an unexpired entry exists,
+// reporting whether it did.
+func (m *MemoryStorage) CheckAndAdd(hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if added, ok := m.entries[hash]; ok && now.Sub(added) < m.config.TTL {
+		return true, nil
+	}
+	m.add(hash, now)
+	return false, nil
+}
+
+// Spent checks if an unexpired hashcash entry exists
+func (m *MemoryStorage) Spent(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added, ok := m.entries[hash]
+	return ok && m.now().Sub(added) < m.config.TTL
+}
+
+// Len returns the number of entries held, including expired entries not yet
+// swept.
+func (m *MemoryStorage) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Lookup returns when an unexpired hashcash entry was added
+func (m *MemoryStorage) Lookup(hash string) (SpentInfo, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added, ok := m.entries[hash]
+	if !ok || m.now().Sub(added) >= m.config.TTL {
+		return SpentInfo{}, false, nil
+	}
+	return SpentInfo{Key: hash, Added: added}, true, nil
+}
+
+// Remove removes a hashcash entry
+func (m *MemoryStorage) Remove(hash string) error {
+	return m.PurgeSingle(hash)
+}
+
+// Recent calls fn with each unexpired entry added since since, oldest first.
+func (m *MemoryStorage) Recent(since time.Time, fn func(SpentInfo) error) error {
+	m.mu.Lock()
+	var (
+		cutoff = m.now().Add(-m.config.TTL)
+		recent []SpentInfo
+	)
+	for _, e := range m.order[m.head:] {
+		if e.added.Before(since) || !e.added.After(cutoff) || !m.entries[e.hash].Equal(e.added) {
+			continue
+		}
+		recent = append(recent, SpentInfo{Key: e.hash, Added: e.added})
+	}
+	m.mu.Unlock()
+	for _, info := range recent {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpired removes entries added before t
+func (m *MemoryStorage) PurgeExpired(t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purge(t)
+	return nil
+}
+
+// PurgeSingle removes a hashcash entry
+func (m *MemoryStorage) PurgeSingle(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, hash)
+	return nil
+}
+
+// PurgeAll removes every entry
+func (m *MemoryStorage) PurgeAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]time.Time)
+	m.order, m.head = nil, 0
+	return nil
+}
+
+// purge removes entries added before t. m.mu must be held.
+func (m *MemoryStorage) purge(t time.Time) {
+	for m.head < len(m.order) && m.order[m.head].added.Before(t) {
+		m.drop()
+	}
+	m.compact()
+}
+
+// evict removes the oldest entry. m.mu must be held.
+func (m *MemoryStorage) evict() {
+	for m.head < len(m.order) && !m.drop() {
+	}
+}
+
+// drop removes the head of order and its entry, reporting whether the entry
+// was removed. Entries removed or added again since are kept. m.mu must be
+// held.
+func (m *MemoryStorage) drop() bool {
+	e := m.order[m.head]
+	m.order[m.head] = memoryEntry{}
+	m.head++
+	if added, ok := m.entries[e.hash]; ok && added.Equal(e.added) {
+		delete(m.entries, e.hash)
+		return true
+	}
+	return false
+}
+
+// compact releases the space of evicted entries once they are the majority
+// of order, and of entries removed or added again once they outnumber live
+// entries. m.mu must be held.
+func (m *MemoryStorage) compact() {
+	switch {
+	case len(m.order)-m.head > 2*len(m.entries)+1:
+		order := make([]memoryEntry, 0, len(m.entries))
+		for _, e := range m.order[m.head:] {
+			if added, ok := m.entries[e.hash]; ok && added.Equal(e.added) {
+				order = append(order, e)
+			}
+		}
+		m.order, m.head = order, 0
+	case m.head > 0 && m.head >= len(m.order)/2:
+		m.order = append([]memoryEntry(nil), m.order[m.head:]...)
+		m.head = 0
+	}
+}
+
+// AcquireLease acquires lease name for holder for ttl, or renews it, e.g.
+// for instances sharing the storage within a process.
+func (m *MemoryStorage) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if l, ok := m.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	if m.leases == nil {
+		m.leases = make(map[string]memoryLease)
+	}
+	m.leases[name] = memoryLease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease releases lease name if holder holds it.
+func (m *MemoryStorage) ReleaseLease(name, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leases[name]; ok && l.holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package hashcash
+
+import "strings"
+
+// Normalizer maps equivalent spellings of a resource to one form, e.g.
+// norm.NFC.String from golang.org/x/text/unicode/norm, so internationalized
+// resources match however the minter spelled them.
+type Normalizer func(string) string
+
+// ChainNormalizers returns a normalizer applying normalizers in order.
+func ChainNormalizers(normalizers ...Normalizer) Normalizer {
+	return func(s string) string {
+		for _, n := range normalizers {
+			s = n(s)
+		}
+		return s
+	}
+}
+
+// FoldASCII lower cases the ASCII letters of s, leaving other characters
+// untouched. Unlike Resource.FoldCase it does not depend on Unicode case
+// tables, so minters in other languages fold resources the same way.
+func FoldASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 'A' && c <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if b[j] >= 'A' && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// DomainNormalizer returns a normalizer converting the domain of resources
+// to ASCII with toASCII, e.g. idna.Lookup.ToASCII from golang.org/x/net/idna.
+// The domain of an email address is the part after the last '@', otherwise
+// the whole resource is taken as a domain. Resources whose domain toASCII
+// rejects are left unchanged, and fail to match.
+func DomainNormalizer(toASCII func(string) (string, error)) Normalizer {
+	return func(s string) string {
+		local, domain := "", s
+		if i := strings.LastIndexByte(s, '@'); i >= 0 {
+			local, domain = s[:i+1], s[i+1:]
+		}
+		ascii, err := toASCII(domain)
+		if err != nil {
+			return s
+		}
+		return local + ascii
+	}
+}
+
+// normalizeResource returns resource as compared by the verifier.
+func (h *Hashcash) normalizeResource(resource string) string {
+	if h.normalize != nil {
+		resource = h.normalize(resource)
+	}
+	return foldCase(resource, h.foldCase)
+}
@@ -0,0 +1,140 @@
+/*
+Package oauth requires hashcash stamps at OAuth token endpoints, throttling
+anonymous clients (device flow, public clients) grinding for tokens without
+pre-registered secrets.
+
+Stamps are bound to the client_id and grant type of the token request, so
+work done for one client or grant cannot be spent on another. Clients mint a
+stamp for Resource(clientID, grantType) and send it in the X-Hashcash header:
+
+	handler := oauth.Middleware(&oauth.Config{
+		Hashcash: &hashcash.Config{Bits: 20, Storage: storage, ...},
+		Grants:   []string{oauth.GrantDeviceCode, oauth.GrantClientCredentials},
+	}, tokenHandler)
+*/
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/umahmood/hashcash"
+)
+
+// Grant types commonly issued to anonymous clients
+const (
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantClientCredentials = "client_credentials"
+	GrantPassword          = "password"
+)
+
+// HeaderName header carrying the stamp
+const HeaderName = "X-Hashcash"
+
+// ErrNoStorage error configuration sets no spent storage
+var ErrNoStorage = errors.New("oauth: Config.Hashcash sets no storage")
+
+// Config for the middleware
+type Config struct {
+	// Hashcash configuration stamps are verified with. Storage or StorageV2
+	// must be set. A single instance verifies every token request, so
+	// windows, caches and reputation are shared by all of them.
+	Hashcash *hashcash.Config
+	// Grants grant types which require a stamp, all grant types when empty.
+	Grants []string
+	// OnReject optional callback invoked when a token request is rejected.
+	OnReject func(r *http.Request, err error)
+}
+
+// Resource returns the resource a stamp for a token request by clientID
+// using grantType must be minted for. The values are escaped, so colons in
+// URN grant types do not break the stamp format.
+func Resource(clientID, grantType string) string {
+	return url.Values{
+		"client_id":  {clientID},
+		"grant_type": {grantType},
+	}.Encode()
+}
+
+// Middleware rejects token requests for the configured grant types which do
+// not carry a valid stamp bound to their client_id and grant type, with the
+// OAuth error "invalid_request" and status 401.
+//
+// It panics if config.Hashcash sets no storage or is invalid, as
+// http.Handle does for a nil handler.
+func Middleware(config *Config, next http.Handler) http.Handler {
+	if config.Hashcash == nil || config.Hashcash.Storage == nil && config.Hashcash.StorageV2 == nil {
+		panic(ErrNoStorage)
+	}
+	hc, err := hashcash.New(&hashcash.Resource{
+		ValidatorContextFunc: func(ctx context.Context, resource string) bool {
+			want, ok := ctx.Value(resourceKey{}).(string)
+			return ok && resource == want
+		},
+	}, config.Hashcash)
+	if err != nil {
+		panic("oauth: " + err.Error())
+	}
+	grants := make(map[string]bool, len(config.Grants))
+	for _, g := range config.Grants {
+		grants[g] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grant := r.PostFormValue("grant_type")
+		if len(grants) > 0 && !grants[grant] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := verify(hc, r, grant); err != nil {
+			if config.OnReject != nil {
+				config.OnReject(r, err)
+			}
+			reject(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resourceKey context key of the resource of the token request being
+// verified
+type resourceKey struct{}
+
+// verify checks the stamp of token request r with hc.
+func verify(hc *hashcash.Hashcash, r *http.Request, grant string) error {
+	stamp := r.Header.Get(HeaderName)
+	if stamp == "" {
+		return hashcash.ErrInvalidHeader
+	}
+	clientID := r.PostFormValue("client_id")
+	if clientID == "" {
+		clientID, _, _ = r.BasicAuth()
+	}
+	ctx := context.WithValue(r.Context(), resourceKey{}, Resource(clientID, grant))
+	_, err := hc.VerifyContext(ctx, stamp, hashcash.Remote{Key: remoteKey(r)})
+	return err
+}
+
+// remoteKey returns the IP address of the client of r.
+func remoteKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// reject writes an OAuth error response.
+func reject(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             "invalid_request",
+		"error_description": "hashcash stamp required: " + err.Error(),
+	})
+}
@@ -0,0 +1,106 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/oauth"
+)
+
+// mapStorage storage safe for concurrent use
+type mapStorage struct {
+	mu    sync.Mutex
+	spent map[string]bool
+}
+
+func (m *mapStorage) Add(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spent[hash] = true
+	return nil
+}
+
+func (m *mapStorage) Spent(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.spent[hash]
+}
+
+var config = &hashcash.Config{
+	Bits:    8,
+	Future:  time.Now().AddDate(0, 0, 2),
+	Expired: time.Now().AddDate(0, 0, -30),
+	Storage: &mapStorage{spent: make(map[string]bool)},
+}
+
+// mint computes a stamp for resource.
+func mint(t *testing.T, resource string) string {
+	hc, err := hashcash.New(&hashcash.Resource{Data: resource}, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return stamp
+}
+
+func TestMiddleware(t *testing.T) {
+	token := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"t"}`))
+	})
+	handler := oauth.Middleware(&oauth.Config{
+		Hashcash: config,
+		Grants:   []string{oauth.GrantDeviceCode},
+	}, token)
+	request := func(grant, stamp string) int {
+		form := url.Values{"client_id": {"tv-app"}, "grant_type": {grant}}
+		r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if stamp != "" {
+			r.Header.Set(oauth.HeaderName, stamp)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := request("authorization_code", ""); code != http.StatusOK {
+		t.Errorf("unprotected grant got %d\n", code)
+	}
+	if code := request(oauth.GrantDeviceCode, ""); code != http.StatusUnauthorized {
+		t.Errorf("missing stamp got %d\n", code)
+	}
+	wrong := mint(t, oauth.Resource("other-app", oauth.GrantDeviceCode))
+	if code := request(oauth.GrantDeviceCode, wrong); code != http.StatusUnauthorized {
+		t.Errorf("stamp for another client got %d\n", code)
+	}
+	stamp := mint(t, oauth.Resource("tv-app", oauth.GrantDeviceCode))
+	if strings.Count(stamp, ":") != 6 {
+		t.Fatalf("resource broke stamp format: %s\n", stamp)
+	}
+	if code := request(oauth.GrantDeviceCode, stamp); code != http.StatusOK {
+		t.Errorf("valid stamp got %d\n", code)
+	}
+	if code := request(oauth.GrantDeviceCode, stamp); code != http.StatusUnauthorized {
+		t.Errorf("spent stamp got %d\n", code)
+	}
+}
+
+func TestMiddlewareNoStorage(t *testing.T) {
+	defer func() {
+		if err := recover(); err != oauth.ErrNoStorage {
+			t.Errorf("got %v\n", err)
+		}
+	}()
+	oauth.Middleware(&oauth.Config{
+		Hashcash: &hashcash.Config{Bits: 8},
+	}, http.NotFoundHandler())
+}
@@ -0,0 +1,83 @@
+package hashcash
+
+import (
+	"hash"
+	"time"
+)
+
+// Option configures an instance created with NewWithOptions.
+type Option func(*options)
+
+// options resource and configuration built by Option functions
+type options struct {
+	res    Resource
+	config Config
+}
+
+// WithBits sets the bits headers are minted with and required to have.
+func WithBits(bits Bits) Option {
+	return func(o *options) { o.config.Bits = bits }
+}
+
+// WithStorage sets the spent storage.
+func WithStorage(s Storage) Option {
+	return func(o *options) { o.config.Storage = s }
+}
+
+// WithStorageV2 sets the spent storage reporting failures, used in place of
+// storage set with WithStorage. Existing Storage implementations can be
+// adapted with AdaptStorage.
+func WithStorageV2(s StorageV2) Option {
+	return func(o *options) { o.config.StorageV2 = s }
+}
+
+// WithExpiryWindow sets how long after they are created headers are
+// accepted, e.g. 28 days.
+func WithExpiryWindow(d time.Duration) Option {
+	return func(o *options) { o.config.ExpiryWindow = d }
+}
+
+// WithFutureWindow sets how far ahead of the verifier's clock headers may be
+// created, e.g. 48 hours.
+func WithFutureWindow(d time.Duration) Option {
+	return func(o *options) { o.config.FutureWindow = d }
+}
+
+// WithHasher sets the hash algorithm headers are minted and verified with,
+// e.g. sha256.New.
+func WithHasher(fn func() hash.Hash) Option {
+	return func(o *options) { o.config.Hasher = fn }
+}
+
+// WithValidator sets the function resources are validated with.
+func WithValidator(fn func(string) bool) Option {
+	return func(o *options) { o.res.ValidatorFunc = fn }
+}
+
+// WithAccept sets the resources accepted at verification.
+func WithAccept(resources ...string) Option {
+	return func(o *options) { o.res.Accept = resources }
+}
+
+// WithConfig applies fn to the configuration, for fields without an option.
+func WithConfig(fn func(*Config)) Option {
+	return func(o *options) { fn(&o.config) }
+}
+
+// NewWithOptions creates a new Hashcash instance minting headers for
+// resource. Options are applied in order over NewDefaultConfig. Unless
+// WithValidator or WithAccept is given, only headers minted for resource are
+// accepted.
+func NewWithOptions(resource string, opts ...Option) (*Hashcash, error) {
+	o := &options{
+		res:    Resource{Data: resource},
+		config: *NewDefaultConfig(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.res.ValidatorFunc == nil && len(o.res.Accept) == 0 {
+		o.res.Accept = []string{resource}
+	}
+	return New(&o.res, &o.config)
+}
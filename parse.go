@@ -0,0 +1,89 @@
+package hashcash
+
+import "fmt"
+
+// fieldNames names of the fields of a version 1 hashcash header
+var fieldNames = [hashcashV1Length]string{
+	"version", "bits", "date", "resource", "extension", "rand", "counter",
+}
+
+// ParseError describes which field of a hashcash header is invalid and
+// where, so client developers can fix their minters. It wraps
+// ErrInvalidHeader, errors.Is(err, ErrInvalidHeader) reports true.
+type ParseError struct {
+	// Field name of the invalid field, e.g. "date".
+	Field string
+	// Offset byte offset into the header at which the problem was found.
+	Offset int
+	// Reason the field is invalid.
+	Reason string
+}
+
+// Error returns a description of the parse error.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid hashcash header: %s field at offset %d: %s", e.Field, e.Offset, e.Reason)
+}
+
+// Unwrap returns ErrInvalidHeader.
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidHeader
+}
+
+// scanHeader checks header has the fields of a version 1 header and a
+// numeric version, returning the version. It does not allocate unless the
+// header is invalid.
+func scanHeader(header string) (int, error) {
+	var (
+		field   = 0
+		version = 0
+	)
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		if c == ':' {
+			if field == 0 && i == 0 {
+				return 0, &ParseError{Field: fieldNames[0], Offset: 0, Reason: "empty"}
+			}
+			field++
+			if field == hashcashV1Length {
+				return 0, &ParseError{Field: fieldNames[field-1], Offset: i, Reason: "unexpected ':', too many fields"}
+			}
+			continue
+		}
+		if field == 0 {
+			if c < '0' || c > '9' {
+				return 0, &ParseError{Field: fieldNames[0], Offset: i, Reason: fmt.Sprintf("unexpected %q, want digit", c)}
+			}
+			version = version*10 + int(c-'0')
+		}
+	}
+	if field < hashcashV1Length-1 {
+		return 0, &ParseError{Field: fieldNames[field+1], Offset: len(header), Reason: "missing field"}
+	}
+	return version, nil
+}
+
+// checkDigits checks field i of vals, starting at offset, is made of digits
+// and one of lengths bytes long.
+func checkDigits(vals []string, i, offset int, lengths ...int) error {
+	v := vals[i]
+	for j := 0; j < len(v); j++ {
+		if v[j] < '0' || v[j] > '9' {
+			return &ParseError{Field: fieldNames[i], Offset: offset + j, Reason: fmt.Sprintf("unexpected %q, want digit", v[j])}
+		}
+	}
+	for _, n := range lengths {
+		if len(v) == n {
+			return nil
+		}
+	}
+	return &ParseError{Field: fieldNames[i], Offset: offset, Reason: fmt.Sprintf("length %d, want one of %v", len(v), lengths)}
+}
+
+// fieldOffset returns the byte offset of field i of vals in the header.
+func fieldOffset(vals []string, i int) int {
+	offset := 0
+	for _, v := range vals[:i] {
+		offset += len(v) + 1
+	}
+	return offset
+}
@@ -0,0 +1,116 @@
+package hashcash
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxParseCacheEntries bound on headers held by a parse cache
+const maxParseCacheEntries = 4096
+
+// parsedHeader fields of a header which do not depend on when or by which
+// instance it is verified.
+type parsedHeader struct {
+	digest []byte
+	// sha1Digest SHA-1 digest of a header which failed the collision check
+	// with Config.Hash, when Config.SHA1Sunset is set.
+	sha1Digest []byte
+	vals       []string
+	key        string
+	bits       Bits
+	bitsErr    error
+	created    time.Time
+	dateErr    error
+	ext        map[string]string
+	extErr     error
+}
+
+// parse parses the fields of header, whose digest has been computed, keying
+// it with the digest sum.
+func (p *parsedHeader) parse(header string, sum func(string) []byte) {
+	p.vals = strings.Split(header, ":")
+	p.key = spentKey(p.vals, sum)
+	// vals: [version bits date resource extension random counter]
+	p.bitsErr = checkDigits(p.vals, 1, fieldOffset(p.vals, 1), 1, 2)
+	var err error
+	if p.bits, err = ParseBits(p.vals[1]); err != nil && p.bitsErr == nil {
+		p.bitsErr = &ParseError{Field: "bits", Offset: fieldOffset(p.vals, 1), Reason: err.Error()}
+	}
+	p.ext, p.extErr = ParseExtensions(p.vals[4])
+	p.dateErr = checkDigits(p.vals, 2, fieldOffset(p.vals, 2), 6, 10, 12)
+	if p.dateErr == nil {
+		p.created, err = parseHashcashTime(p.vals[2])
+		if err != nil {
+			p.dateErr = &ParseError{Field: "date", Offset: fieldOffset(p.vals, 2), Reason: err.Error()}
+		}
+	}
+}
+
+// cachedHeader parsed header held by a parse cache
+type cachedHeader struct {
+	header string
+	parsed *parsedHeader
+	at     time.Time
+}
+
+// parseCache remembers parsed headers for ttl, so a header verified
+// repeatedly in a burst, e.g. by retries or fan-out services, is hashed and
+// parsed once. It is safe for concurrent use.
+type parseCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	byHeader map[string]cachedHeader
+	// order entries ordered by insertion time, used to expire entries.
+	order []cachedHeader
+}
+
+// newParseCache creates a new parse cache.
+func newParseCache(ttl time.Duration) *parseCache {
+	return &parseCache{
+		ttl:      ttl,
+		byHeader: make(map[string]cachedHeader),
+	}
+}
+
+// get returns the parsed header cached within ttl.
+func (c *parseCache) get(header string) (*parsedHeader, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.byHeader[header]
+	if !ok || time.Since(e.at) > c.ttl {
+		return nil, false
+	}
+	return e.parsed, true
+}
+
+// put caches parsed, unless the cache is full.
+func (c *parseCache) put(header string, parsed *parsedHeader) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.expire(now)
+	if len(c.order) >= maxParseCacheEntries {
+		return
+	}
+	e := cachedHeader{header: header, parsed: parsed, at: now}
+	c.byHeader[header] = e
+	c.order = append(c.order, e)
+}
+
+// expire removes entries older than ttl.
+func (c *parseCache) expire(now time.Time) {
+	i := 0
+	for ; i < len(c.order) && now.Sub(c.order[i].at) > c.ttl; i++ {
+		if e := c.byHeader[c.order[i].header]; e.at.Equal(c.order[i].at) {
+			delete(c.byHeader, c.order[i].header)
+		}
+	}
+	c.order = c.order[i:]
+}
@@ -0,0 +1,116 @@
+package hashcash
+
+import (
+	"fmt"
+	"time"
+)
+
+// passSlots number of slots a pass lifetime is divided into, a pass lasts up
+// to a slot longer than PassConfig.TTL.
+const passSlots = 8
+
+// PassConfig for free passes
+type PassConfig struct {
+	// Storage where passes and their uses are recorded, e.g. shared by
+	// instances behind a load balancer to honour passes granted by any of
+	// them. In-memory storage when nil. It must keep entries for at least
+	// TTL.
+	Storage Storage
+	// Requests number of follow-up requests a pass admits without a stamp.
+	Requests int
+	// TTL time a pass lasts from when it is granted.
+	TTL time.Duration
+}
+
+// DefaultPassConfig default free pass configuration
+var DefaultPassConfig = &PassConfig{
+	Requests: 10,
+	TTL:      10 * time.Minute,
+}
+
+// Passes grants remote keys which proved work a number of follow-up requests
+// without a stamp, for a limited time, i.e. "prove work once per N minutes".
+// Passes are tracked in storage like sessions, so the verifier itself stays
+// stateless about them: set OnVerify as Config.OnVerify to grant a pass for
+// each valid stamp, and call Use before asking a remote key for a stamp. A
+// newer pass replaces an older one. It is safe for concurrent use.
+type Passes struct {
+	config  PassConfig
+	storage Storage
+	now     func() time.Time
+}
+
+// NewPasses creates free passes. If config is nil DefaultPassConfig is used.
+func NewPasses(config *PassConfig) *Passes {
+	if config == nil {
+		config = DefaultPassConfig
+	}
+	p := &Passes{config: *config, storage: config.Storage, now: time.Now}
+	if p.storage == nil {
+		p.storage = NewMemoryStorage(nil)
+	}
+	if p.config.TTL < passSlots {
+		p.config.TTL = passSlots
+	}
+	return p
+}
+
+// Grant grants key a pass.
+func (p *Passes) Grant(key string) error {
+	return p.storage.Add(p.passKey(key, p.slot(p.now())))
+}
+
+// OnVerify grants the remote key of ev a pass if its stamp is valid, to be
+// set as Config.OnVerify. Errors of storage are dropped.
+func (p *Passes) OnVerify(ev VerifyEvent) {
+	if ev.Valid && ev.Remote.Key != "" {
+		p.Grant(ev.Remote.Key)
+	}
+}
+
+// Use claims a request of the pass of key, reporting whether key holds a
+// pass with requests left, in which case the request is admitted without a
+// stamp.
+func (p *Passes) Use(key string) (bool, error) {
+	now := p.slot(p.now())
+	for slot := now; slot >= now-passSlots; slot-- {
+		pass := p.passKey(key, slot)
+		if !p.storage.Spent(pass) {
+			continue
+		}
+		// only the newest pass is used
+		for i := 1; i <= p.config.Requests; i++ {
+			spent, err := p.take(fmt.Sprintf("%s#%d", pass, i))
+			if err != nil {
+				return false, err
+			}
+			if !spent {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// slot returns the slot of the pass lifetime t falls in.
+func (p *Passes) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(p.config.TTL/passSlots)
+}
+
+// passKey returns the storage key of a pass of key granted in slot.
+func (p *Passes) passKey(key string, slot int64) string {
+	return fmt.Sprintf("pass:%s:%d", key, slot)
+}
+
+// take records key as spent unless storage already holds it, reporting
+// whether it did, atomically when storage implements CheckAndAdder.
+func (p *Passes) take(key string) (bool, error) {
+	if ca, ok := p.storage.(CheckAndAdder); ok {
+		return ca.CheckAndAdd(key)
+	}
+	if p.storage.Spent(key) {
+		return true, nil
+	}
+	return false, p.storage.Add(key)
+}
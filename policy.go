@@ -0,0 +1,159 @@
+package hashcash
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PolicyFunc fetches the bits currently required by a policy source, e.g.
+// DNS TXT records or a signed policy document.
+type PolicyFunc func(ctx context.Context) (Bits, error)
+
+// PolicyCacheConfig for a policy cache
+type PolicyCacheConfig struct {
+	// TTL how long fetched bits are fresh, after which they are refreshed in
+	// the background.
+	TTL time.Duration
+	// MaxStale how long past TTL stale bits are still used while refreshes
+	// fail, after which Fallback is used. Zero means stale bits are used
+	// until a refresh succeeds.
+	MaxStale time.Duration
+	// Timeout bound on each fetch.
+	Timeout time.Duration
+	// Fallback bits used until bits have been fetched.
+	Fallback Bits
+	// OnError optional callback invoked when a fetch fails.
+	OnError func(error)
+}
+
+// DefaultPolicyCacheConfig default policy cache configuration
+var DefaultPolicyCacheConfig = &PolicyCacheConfig{
+	TTL:      5 * time.Minute,
+	Timeout:  10 * time.Second,
+	Fallback: 20,
+}
+
+// PolicyCache caches the bits fetched from a policy source, shared by the
+// minting and verifying paths of an instance through Config.Policy. Once
+// fetched bits are older than TTL they are still served while being
+// refreshed in the background, so an outage of the policy source never
+// stalls minting or verification. It is safe for concurrent use.
+type PolicyCache struct {
+	fetch  PolicyFunc
+	config PolicyCacheConfig
+	mu     sync.Mutex
+	bits   Bits
+	// fetched time bits were fetched, zero until a fetch succeeds.
+	fetched    time.Time
+	refreshing bool
+	// loop refreshes bits every TTL once started
+	loop Component
+}
+
+// NewPolicyCache creates a policy cache fetching bits with fetch. If config is
+// nil DefaultPolicyCacheConfig is used. Bits are not fetched until they are
+// first needed, call Refresh to fetch them up front.
+func NewPolicyCache(fetch PolicyFunc, config *PolicyCacheConfig) *PolicyCache {
+	if config == nil {
+		config = DefaultPolicyCacheConfig
+	}
+	c := &PolicyCache{fetch: fetch, config: *config}
+	if c.config.Timeout <= 0 {
+		c.config.Timeout = DefaultPolicyCacheConfig.Timeout
+	}
+	c.loop = RunFunc(c.refreshLoop)
+	return c
+}
+
+// Start refreshes the bits immediately and then every TTL in the background,
+// until Close is called or ctx is done, so fresh bits are at hand when
+// needed. Failed refreshes are reported to OnError.
+func (c *PolicyCache) Start(ctx context.Context) error {
+	return c.loop.Start(ctx)
+}
+
+// Close stops refreshes started by Start.
+func (c *PolicyCache) Close() error {
+	return c.loop.Close()
+}
+
+// refreshLoop refreshes the bits every TTL until ctx is done.
+func (c *PolicyCache) refreshLoop(ctx context.Context) error {
+	interval := c.config.TTL
+	if interval <= 0 {
+		interval = DefaultPolicyCacheConfig.TTL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		refresh, cancel := context.WithTimeout(ctx, c.config.Timeout)
+		c.Refresh(refresh)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Bits returns the cached bits without blocking, Fallback if none have been
+// fetched or they are more than MaxStale past TTL. A background refresh is
+// started if the cached bits are not fresh.
+func (c *PolicyCache) Bits() Bits {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	age := time.Since(c.fetched)
+	if c.fetched.IsZero() || age >= c.config.TTL {
+		c.revalidate()
+	}
+	switch {
+	case c.fetched.IsZero():
+		return c.config.Fallback
+	case c.config.MaxStale > 0 && age >= c.config.TTL+c.config.MaxStale:
+		return c.config.Fallback
+	}
+	return c.bits
+}
+
+// revalidate starts a background refresh, unless one is running. c.mu must be
+// held.
+func (c *PolicyCache) revalidate() {
+	if c.refreshing {
+		return
+	}
+	c.refreshing = true
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		defer cancel()
+		c.Refresh(ctx)
+	}()
+}
+
+// Refresh fetches the bits, blocking until the fetch completes, e.g. at start
+// up. On failure the cached bits are kept and the error is returned.
+func (c *PolicyCache) Refresh(ctx context.Context) error {
+	bits, err := c.fetch(ctx)
+	if err == nil {
+		err = bits.Validate()
+	}
+	c.mu.Lock()
+	c.refreshing = false
+	if err == nil {
+		c.bits, c.fetched = bits, time.Now()
+	}
+	c.mu.Unlock()
+	if err != nil && c.config.OnError != nil {
+		c.config.OnError(err)
+	}
+	return err
+}
+
+// Fetched returns the time bits were last fetched, zero if no fetch has
+// succeeded.
+func (c *PolicyCache) Fetched() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetched
+}
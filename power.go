@@ -0,0 +1,25 @@
+package hashcash
+
+// PowerState power conditions of the host
+type PowerState struct {
+	// OnBattery whether the host is running on battery power.
+	OnBattery bool
+	// Throttled whether the CPU has been thermally throttled since the
+	// state was last read.
+	Throttled bool
+}
+
+// PowerMonitor reports the power conditions of the host, so background work
+// such as Wallet.PreMine can pause rather than drain batteries or heat
+// throttled CPUs.
+type PowerMonitor interface {
+	PowerState() (PowerState, error)
+}
+
+// NopPowerMonitor reports the host on mains power and never throttled.
+type NopPowerMonitor struct{}
+
+// PowerState returns the zero state.
+func (NopPowerMonitor) PowerState() (PowerState, error) {
+	return PowerState{}, nil
+}
@@ -0,0 +1,40 @@
+package hashcash
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cpuSpeedLimit matches the CPU speed limit reported by pmset -g therm
+var cpuSpeedLimit = regexp.MustCompile(`CPU_Speed_Limit\s*=\s*(\d+)`)
+
+// pmsetPowerMonitor reads power conditions with pmset.
+type pmsetPowerMonitor struct{}
+
+// SystemPowerMonitor returns a monitor of the host's power conditions. On
+// macOS they are read with pmset.
+func SystemPowerMonitor() PowerMonitor {
+	return pmsetPowerMonitor{}
+}
+
+// PowerState reports the host on battery if it is drawing from battery
+// power, and throttled if the CPU speed is limited.
+func (pmsetPowerMonitor) PowerState() (PowerState, error) {
+	var state PowerState
+	batt, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return state, err
+	}
+	state.OnBattery = strings.Contains(string(batt), "'Battery Power'")
+	therm, err := exec.Command("pmset", "-g", "therm").Output()
+	if err != nil {
+		return state, err
+	}
+	if m := cpuSpeedLimit.FindSubmatch(therm); m != nil {
+		limit, _ := strconv.Atoi(string(m[1]))
+		state.Throttled = limit < 100
+	}
+	return state, nil
+}
@@ -0,0 +1,67 @@
+package hashcash
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sysfsPowerMonitor reads power conditions from sysfs.
+type sysfsPowerMonitor struct {
+	mu        sync.Mutex
+	throttles uint64
+}
+
+// SystemPowerMonitor returns a monitor of the host's power conditions. On
+// Linux batteries and thermal throttle counts are read from sysfs.
+func SystemPowerMonitor() PowerMonitor {
+	m := &sysfsPowerMonitor{}
+	m.throttles = throttleCount()
+	return m
+}
+
+// PowerState reports the host on battery if any battery is discharging, and
+// throttled if any CPU package was throttled since the last call.
+func (m *sysfsPowerMonitor) PowerState() (PowerState, error) {
+	var state PowerState
+	supplies, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return state, err
+	}
+	for _, dir := range supplies {
+		if readSysfs(filepath.Join(dir, "type")) == "Battery" &&
+			readSysfs(filepath.Join(dir, "status")) == "Discharging" {
+			state.OnBattery = true
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := throttleCount()
+	state.Throttled = n > m.throttles
+	m.throttles = n
+	return state, nil
+}
+
+// throttleCount returns the total number of thermal throttling events of
+// CPU packages.
+func throttleCount() uint64 {
+	counts, _ := filepath.Glob("/sys/devices/system/cpu/cpu*/thermal_throttle/package_throttle_count")
+	var total uint64
+	for _, path := range counts {
+		n, _ := strconv.ParseUint(readSysfs(path), 10, 64)
+		total += n
+	}
+	return total
+}
+
+// readSysfs returns the trimmed contents of a sysfs attribute, empty if it
+// cannot be read.
+func readSysfs(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package hashcash
+
+// SystemPowerMonitor returns a monitor of the host's power conditions. Power
+// conditions cannot be read on this platform, so the host is reported on
+// mains power and never throttled.
+func SystemPowerMonitor() PowerMonitor {
+	return NopPowerMonitor{}
+}
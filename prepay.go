@@ -0,0 +1,190 @@
+package hashcash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signatureExt name of the extension carrying a prepay signature
+const signatureExt = "sig="
+
+// PrepayConfig for a prepay minter
+type PrepayConfig struct {
+	// Key secret used to sign minted headers.
+	Key []byte
+	// Quota maximum number of headers minted for a single client within
+	// Window.
+	Quota int
+	// Window period over which Quota applies, it must be positive. Quotas
+	// of clients are forgotten once their window has passed.
+	Window time.Duration
+	// Config hashcash configuration used when minting, NewDefaultConfig is
+	// used when nil.
+	Config *Config
+}
+
+// quota minted headers for a single client
+type quota struct {
+	minted int
+	reset  time.Time
+}
+
+// Prepay mints headers on behalf of clients, i.e. the server pays for the
+// proof-of-work. Minted headers are signed so they can later be presented as
+// work certificates and checked offline by any holder of the key. Each client
+// is subject to a strict quota. It is safe for concurrent use.
+//
+// The signature cannot cover the counter, which is found after the signed
+// extension is fixed, so a holder could mint further headers under it with
+// their own work. Each signature is therefore accepted once by Signed.
+type Prepay struct {
+	mu     sync.Mutex
+	config PrepayConfig
+	quotas map[string]*quota
+	// used signatures accepted by Signed, kept for the expiry window
+	used *MemoryStorage
+	// swept time quotas of past windows were last removed
+	swept time.Time
+}
+
+// NewPrepay creates a new prepay minter.
+func NewPrepay(config *PrepayConfig) (*Prepay, error) {
+	if config == nil || len(config.Key) == 0 {
+		return nil, ErrPrepayKey
+	}
+	if config.Window <= 0 {
+		return nil, ErrPrepayWindow
+	}
+	window := defaultExpiryWindow
+	if config.Config != nil && config.Config.ExpiryWindow > 0 {
+		window = config.Config.ExpiryWindow
+	}
+	return &Prepay{
+		config: *config,
+		quotas: make(map[string]*quota),
+		used:   NewMemoryStorage(&MemoryConfig{TTL: window}),
+	}, nil
+}
+
+// Mint computes a signed hashcash header for resource on behalf of the
+// client identified by key, see MintContext.
+func (p *Prepay) Mint(key, resource string) (string, error) {
+	return p.MintContext(context.Background(), key, resource)
+}
+
+// MintContext computes a signed hashcash header for resource on behalf of
+// the client identified by key, until ctx is done. If the client has
+// exhausted its quota ErrQuotaExceeded error is returned. Headers which
+// could not be minted do not count against the quota.
+func (p *Prepay) MintContext(ctx context.Context, key, resource string) (string, error) {
+	if err := p.take(key); err != nil {
+		return "", err
+	}
+	header, err := p.mint(ctx, resource)
+	if err != nil {
+		p.refund(key)
+	}
+	return header, err
+}
+
+// mint computes a signed header for resource.
+func (p *Prepay) mint(ctx context.Context, resource string) (string, error) {
+	h, err := newMinter(&Resource{Data: resource}, p.config.Config)
+	if err != nil {
+		return "", err
+	}
+	h.extension = signatureExt + p.sign(h.createHeader())
+	return h.ComputeContext(ctx)
+}
+
+// Signed checks that header was minted by a prepay minter holding the same
+// key. It does not verify the header itself, see Verify. If the signature is
+// missing or invalid ErrSignature error is returned. Each signature is
+// accepted once within the expiry window, later headers carrying it, e.g.
+// minted again with another counter, are rejected with ErrSignatureUsed.
+func (p *Prepay) Signed(header string) error {
+	vals := strings.Split(header, ":")
+	if len(vals) != hashcashV1Length {
+		return ErrInvalidHeader
+	}
+	// vals: [version bits date resource extension random counter]
+	if !strings.HasPrefix(vals[4], signatureExt) {
+		return ErrSignature
+	}
+	sig := strings.TrimPrefix(vals[4], signatureExt)
+	if !hmac.Equal([]byte(sig), []byte(p.sign(header))) {
+		return ErrSignature
+	}
+	used, err := p.used.CheckAndAdd(sig)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrSignatureUsed
+	}
+	return nil
+}
+
+// Remaining returns the number of headers which can still be minted for the
+// client identified by key in the current window.
+func (p *Prepay) Remaining(key string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q, ok := p.quotas[key]
+	if !ok || time.Now().After(q.reset) {
+		return p.config.Quota
+	}
+	return p.config.Quota - q.minted
+}
+
+// take consumes one unit of the quota of key.
+func (p *Prepay) take(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if now.Sub(p.swept) >= p.config.Window {
+		for k, q := range p.quotas {
+			if now.After(q.reset) {
+				delete(p.quotas, k)
+			}
+		}
+		p.swept = now
+	}
+	q, ok := p.quotas[key]
+	if !ok || now.After(q.reset) {
+		q = &quota{reset: now.Add(p.config.Window)}
+		p.quotas[key] = q
+	}
+	if q.minted >= p.config.Quota {
+		return ErrQuotaExceeded
+	}
+	q.minted++
+	return nil
+}
+
+// refund returns a unit of the quota of key taken by take.
+func (p *Prepay) refund(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if q, ok := p.quotas[key]; ok && q.minted > 0 {
+		q.minted--
+	}
+}
+
+// sign computes the signature of header covering every field except the
+// extension and counter.
+func (p *Prepay) sign(header string) string {
+	vals := strings.Split(header, ":")
+	if len(vals) != hashcashV1Length {
+		return ""
+	}
+	mac := hmac.New(sha256.New, p.config.Key)
+	fmt.Fprintf(mac, "%s:%s:%s:%s:%s", vals[0], vals[1], vals[2], vals[3], vals[5])
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,32 @@
+package hashcash
+
+// PreVerify runs only the cheap, stateless checks of Verify against token,
+// so front-line load balancers can drop obvious garbage before forwarding it
+// to the verifier tier. It neither hashes token nor consults the resource
+// validator or spent storage.
+//
+// PreVerify can return:
+//   - ErrInvalidHeader, as a *ParseError, for malformed tokens
+//   - ErrUnsupportedVersion for tokens of an unsupported version
+//   - ErrInsufficientBits for tokens claiming fewer bits than required
+//   - ErrExpired and ErrFutureStamp, both matching ErrTimestamp, for tokens
+//     created outside the accepted window
+//
+// It cannot return ErrNoCollision, ErrResourceFail, ErrExtension or ErrSpent,
+// so a token passing PreVerify may still fail Verify. Verify does not check
+// claimed bits, only the bits of the digest, so a token claiming too few bits
+// may still pass Verify if its digest happens to have enough.
+func (h *Hashcash) PreVerify(token string) error {
+	stamp, err := Parse(token)
+	if err != nil {
+		return err
+	}
+	if stamp.Bits < h.requiredBits() {
+		return ErrInsufficientBits
+	}
+	created, err := stamp.Created()
+	if err != nil {
+		return err
+	}
+	return h.checkTime(created, &VerifyEvent{})
+}
@@ -0,0 +1,103 @@
+package hashcash
+
+import (
+	"context"
+	"errors"
+)
+
+// Reason why a stamp was rejected, so rejections can be counted without
+// matching error strings.
+type Reason int
+
+const (
+	// ReasonNone the stamp is valid.
+	ReasonNone Reason = iota
+	// ReasonInvalid the stamp is malformed, ErrInvalidHeader.
+	ReasonInvalid
+	// ReasonVersion the stamp version is not supported,
+	// ErrUnsupportedVersion.
+	ReasonVersion
+	// ReasonNoCollision the digest has too few leading zero bits,
+	// ErrNoCollision.
+	ReasonNoCollision
+	// ReasonInsufficientBits the stamp claims too few bits,
+	// ErrInsufficientBits.
+	ReasonInsufficientBits
+	// ReasonExcessBits the digest exceeds Config.MaxBits, ErrExcessBits.
+	ReasonExcessBits
+	// ReasonExpired the stamp was created before Config.Expired, ErrExpired.
+	ReasonExpired
+	// ReasonFuture the stamp was created too far ahead, ErrFutureStamp.
+	ReasonFuture
+	// ReasonResource the resource failed validation, ErrResourceFail.
+	ReasonResource
+	// ReasonExtension the extensions failed the policy, ErrExtension.
+	ReasonExtension
+	// ReasonSHA1Sunset the stamp was minted with SHA-1 after
+	// Config.SHA1Sunset, ErrSHA1Sunset.
+	ReasonSHA1Sunset
+	// ReasonSpent the stamp has already been spent, ErrSpent.
+	ReasonSpent
+	// ReasonBlocked the remote is blocked, ErrBlocked.
+	ReasonBlocked
+	// ReasonStorage spent storage failed, ErrStorage.
+	ReasonStorage
+	// ReasonCanceled the context was done before verification completed.
+	ReasonCanceled
+	// ReasonOther any other error.
+	ReasonOther
+)
+
+// reasonNames names of reasons, indexed by reason
+var reasonNames = []string{
+	"none", "invalid", "version", "collision", "bits", "excess", "expired",
+	"future", "resource", "extension", "sunset", "spent", "blocked", "storage",
+	"canceled", "other",
+}
+
+// String returns the name of r, e.g. for metric labels.
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return "unknown"
+	}
+	return reasonNames[r]
+}
+
+// reasons reasons of verification errors, errors wrapping others are listed
+// first.
+var reasons = []struct {
+	reason Reason
+	err    error
+}{
+	{ReasonInvalid, ErrInvalidHeader},
+	{ReasonVersion, ErrUnsupportedVersion},
+	{ReasonNoCollision, ErrNoCollision},
+	{ReasonInsufficientBits, ErrInsufficientBits},
+	{ReasonExcessBits, ErrExcessBits},
+	{ReasonExpired, ErrExpired},
+	{ReasonFuture, ErrFutureStamp},
+	{ReasonExpired, ErrTimestamp},
+	{ReasonResource, ErrResourceFail},
+	{ReasonExtension, ErrExtension},
+	{ReasonSHA1Sunset, ErrSHA1Sunset},
+	{ReasonSpent, ErrSpent},
+	{ReasonBlocked, ErrBlocked},
+	{ReasonStorage, ErrStorage},
+	{ReasonCanceled, context.Canceled},
+	{ReasonCanceled, context.DeadlineExceeded},
+}
+
+// ReasonOf returns the reason a verification failed with err, ReasonNone if
+// err is nil. Errors joined in Config.Strict mode report a single reason,
+// the first of the Reason constants any of them matches.
+func ReasonOf(err error) Reason {
+	if err == nil {
+		return ReasonNone
+	}
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return ReasonOther
+}
@@ -0,0 +1,58 @@
+package hashcash
+
+import (
+	"context"
+	"crypto/subtle"
+)
+
+// relayExt name of the extension referencing the stamp a relay stamp was
+// minted for
+const relayExt = "relay"
+
+// ComputeRelay computes a relay stamp as ComputeContext does, referencing
+// original by its spent key in the relay extension. Intermediaries, such as
+// mailing list exploders, mint relay stamps for their own resource so
+// forwarded messages carry layered proof-of-work. It replaces extensions set
+// on the instance. If original is not in a valid format, ErrInvalidHeader
+// error is returned.
+func (h *Hashcash) ComputeRelay(ctx context.Context, original string) (string, error) {
+	key, err := SpentKey(original)
+	if err != nil {
+		return "", err
+	}
+	if err := h.SetExtensions(map[string]string{relayExt: key}); err != nil {
+		return "", err
+	}
+	return h.ComputeContext(ctx)
+}
+
+// VerifyChain verifies a chain of stamps, an original stamp followed by the
+// relay stamps minted for it, each referencing the stamp before it. Each
+// stamp is verified with the verifier at the same position, e.g. instances
+// validating the resource of each hop. Links are checked before any stamp is
+// verified, so no stamp is spent when the chain is broken and ErrRelayChain
+// error is returned.
+func VerifyChain(ctx context.Context, chain []string, verifiers []Verifier) error {
+	if len(chain) == 0 || len(chain) != len(verifiers) {
+		return ErrRelayChain
+	}
+	for i := 1; i < len(chain); i++ {
+		key, err := SpentKey(chain[i-1])
+		if err != nil {
+			return err
+		}
+		ext, err := HeaderExtensions(chain[i])
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(ext[relayExt]), []byte(key)) != 1 {
+			return ErrRelayChain
+		}
+	}
+	for i, header := range chain {
+		if _, err := verifiers[i].VerifyContext(ctx, header, Remote{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package hashcash
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	cuckooBucketSize = 4   // Fingerprints per cuckoo filter bucket
+	cuckooMaxKicks   = 500 // Relocations tried before a cuckoo filter is full
+	cuckooLoadFactor = 0.9 // Occupancy a cuckoo filter is sized for
+)
+
+// cuckooFilter set membership filter of 16-bit fingerprints, without false
+// negatives. With four entry buckets the false positive rate is at most
+// 2*4/2^16, about 0.012%.
+type cuckooFilter struct {
+	buckets [][cuckooBucketSize]uint16
+	mask    uint64
+	count   int
+	created time.Time
+	// victim fingerprint displaced when the filter filled, kept so it is
+	// not lost.
+	victim      uint16
+	victimIndex uint64
+}
+
+// newCuckooFilter creates a filter sized for capacity entries.
+func newCuckooFilter(capacity int, created time.Time) *cuckooFilter {
+	n := uint64(1)
+	for float64(n*cuckooBucketSize)*cuckooLoadFactor < float64(capacity) {
+		n <<= 1
+	}
+	return &cuckooFilter{
+		buckets: make([][cuckooBucketSize]uint16, n),
+		mask:    n - 1,
+		created: created,
+	}
+}
+
+// indexes returns the fingerprint of key and its two candidate buckets.
+func (c *cuckooFilter) indexes(key string) (fp uint16, i1, i2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	fp = uint16(sum >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 = sum & c.mask
+	return fp, i1, c.alt(i1, fp)
+}
+
+// alt returns the other candidate bucket of fingerprint fp stored in bucket i.
+func (c *cuckooFilter) alt(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & c.mask
+}
+
+// has reports whether bucket i holds fingerprint fp.
+func (c *cuckooFilter) has(i uint64, fp uint16) bool {
+	for _, f := range c.buckets[i] {
+		if f == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// put stores fingerprint fp in a free slot of bucket i.
+func (c *cuckooFilter) put(i uint64, fp uint16) bool {
+	for j, f := range c.buckets[i] {
+		if f == 0 {
+			c.buckets[i][j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether key may have been inserted.
+func (c *cuckooFilter) contains(key string) bool {
+	fp, i1, i2 := c.indexes(key)
+	if c.victim == fp && (c.victimIndex == i1 || c.victimIndex == i2) {
+		return true
+	}
+	return c.has(i1, fp) || c.has(i2, fp)
+}
+
+// insert adds key, relocating fingerprints to make room. false is returned
+// if the filter is full.
+func (c *cuckooFilter) insert(key string) bool {
+	if c.victim != 0 {
+		return false
+	}
+	fp, i1, i2 := c.indexes(key)
+	if c.put(i1, fp) || c.put(i2, fp) {
+		c.count++
+		return true
+	}
+	i := i1
+	if rand.Intn(2) == 0 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		j := rand.Intn(cuckooBucketSize)
+		fp, c.buckets[i][j] = c.buckets[i][j], fp
+		i = c.alt(i, fp)
+		if c.put(i, fp) {
+			c.count++
+			return true
+		}
+	}
+	c.victim, c.victimIndex = fp, i
+	c.count++
+	return true
+}
+
+// ReplayFilterConfig for a replay filter
+type ReplayFilterConfig struct {
+	// Window how long entries are remembered, at least the age at which
+	// verified headers expire, e.g. 28 days.
+	Window time.Duration
+	// Capacity expected number of entries added within Window.
+	Capacity int
+	// FailClosed when set and the filter fills before Window has elapsed,
+	// every entry not already added is reported as spent until the next
+	// rotation. Otherwise the filter rotates early, forgetting entries added
+	// more than one rotation ago, so replays of them are accepted.
+	FailClosed bool
+}
+
+// ReplayFilter probabilistic spent storage for deployments which cannot run
+// a storage backend. Entries are kept in two rotating cuckoo filters, each
+// covering Window, so an entry is remembered for between one and two
+// windows. There are no false negatives within Window, but an entry never
+// added is reported as spent with probability of at most 0.024%, i.e. about
+// one in 4000 fresh headers is rejected with ErrSpent and must be minted
+// again. Each filter uses between 2.2 and 4.4 bytes per entry of Capacity,
+// as its table is sized to a power of two.
+// It is safe for concurrent use.
+type ReplayFilter struct {
+	mu       sync.Mutex
+	config   ReplayFilterConfig
+	current  *cuckooFilter
+	previous *cuckooFilter
+	full     bool
+}
+
+// NewReplayFilter creates a replay filter.
+func NewReplayFilter(config *ReplayFilterConfig) *ReplayFilter {
+	now := time.Now()
+	return &ReplayFilter{
+		config:   *config,
+		current:  newCuckooFilter(config.Capacity, now),
+		previous: newCuckooFilter(0, now),
+	}
+}
+
+// rotate starts a new filter once the current one covers Window.
+func (r *ReplayFilter) rotate(now time.Time) {
+	age := now.Sub(r.current.created)
+	if age < r.config.Window {
+		return
+	}
+	r.previous = r.current
+	if age >= 2*r.config.Window {
+		r.previous = newCuckooFilter(0, now)
+	}
+	r.current = newCuckooFilter(r.config.Capacity, now)
+	r.full = false
+}
+
+// Add adds a hashcash entry to the filter. If the filter is full with
+// FailClosed set ErrReplayFilterFull error is returned.
+func (r *ReplayFilter) Add(hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.rotate(now)
+	if r.current.insert(hash) {
+		return nil
+	}
+	if r.config.FailClosed {
+		r.full = true
+		return ErrReplayFilterFull
+	}
+	r.previous = r.current
+	r.current = newCuckooFilter(r.config.Capacity, now)
+	r.current.insert(hash)
+	return nil
+}
+
+// Spent checks if a hashcash entry may have been added to the filter.
+func (r *ReplayFilter) Spent(hash string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rotate(time.Now())
+	return r.full || r.current.contains(hash) || r.previous.contains(hash)
+}
+
+// Len returns the number of entries held by the filter.
+func (r *ReplayFilter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current.count + r.previous.count
+}
@@ -0,0 +1,211 @@
+package hashcash
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultReputationWeights default score added to a remote key for each
+// rejection reason. Failures which suggest abuse, such as replaying spent
+// headers, weigh more than those likely caused by a misconfigured client.
+var DefaultReputationWeights = map[error]int{
+	ErrInvalidHeader: 1,
+	ErrTimestamp:     1,
+	ErrResourceFail:  2,
+	ErrNoCollision:   3,
+	ErrSpent:         5,
+}
+
+// ReputationConfig for a reputation tracker
+type ReputationConfig struct {
+	// Weights score added for each rejection reason, reasons missing from
+	// the map add 1. Defaults to DefaultReputationWeights when nil.
+	Weights map[error]int
+	// Threshold score at which a remote key is blocked.
+	Threshold int
+	// Window scores are reset when a key has not failed verification within
+	// this duration.
+	Window time.Duration
+	// BlockFor how long a remote key is blocked once it reaches Threshold.
+	BlockFor time.Duration
+	// MaxKeys bound on keys tracked, the key which failed least recently is
+	// forgotten when full, with its score and any block. Defaults to 1<<16
+	// keys.
+	MaxKeys int
+}
+
+// DefaultReputationConfig default reputation tracker configuration
+var DefaultReputationConfig = &ReputationConfig{
+	Threshold: 20,
+	Window:    10 * time.Minute,
+	BlockFor:  15 * time.Minute,
+	MaxKeys:   1 << 16,
+}
+
+// reputation score of a single remote key
+type reputation struct {
+	key     string
+	score   int
+	last    time.Time
+	blocked time.Time
+}
+
+// Reputation tracks weighted verification failures per remote key (IP
+// address, account, etc...) and temporarily blocks keys which repeatedly
+// present invalid headers. Keys whose scores and blocks have expired are
+// swept as failures are recorded, and at most MaxKeys keys are tracked, so
+// memory stays bounded however many keys fail. It is safe for concurrent use.
+type Reputation struct {
+	mu     sync.Mutex
+	config ReputationConfig
+	keys   map[string]*list.Element
+	// lru reputations of keys, the most recently failed first.
+	lru *list.List
+}
+
+// NewReputation creates a new reputation tracker. If config is nil
+// DefaultReputationConfig is used.
+func NewReputation(config *ReputationConfig) *Reputation {
+	if config == nil {
+		config = DefaultReputationConfig
+	}
+	r := &Reputation{
+		config: *config,
+		keys:   make(map[string]*list.Element),
+		lru:    list.New(),
+	}
+	if r.config.Weights == nil {
+		r.config.Weights = DefaultReputationWeights
+	}
+	if r.config.MaxKeys <= 0 {
+		r.config.MaxKeys = DefaultReputationConfig.MaxKeys
+	}
+	return r
+}
+
+// Record adds the weight of err to the score of key. Nil errors are ignored,
+// the weights of errors joined by strict verification are summed.
+func (r *Reputation) Record(key string, err error) {
+	if err == nil {
+		return
+	}
+	weight := r.weight(err)
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep(now)
+	rep := r.get(key)
+	switch {
+	case rep == nil:
+		if len(r.keys) >= r.config.MaxKeys {
+			r.remove(r.lru.Back())
+		}
+		rep = &reputation{key: key}
+		r.keys[key] = r.lru.PushFront(rep)
+	case now.Sub(rep.last) > r.config.Window:
+		rep.score = 0
+		fallthrough
+	default:
+		r.lru.MoveToFront(r.keys[key])
+	}
+	rep.score += weight
+	rep.last = now
+	if rep.score >= r.config.Threshold {
+		rep.score = 0
+		rep.blocked = now.Add(r.config.BlockFor)
+	}
+}
+
+// weight returns the weight of err, summing the weights of joined errors.
+func (r *Reputation) weight(err error) int {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		weight := 0
+		for _, e := range joined.Unwrap() {
+			weight += r.weight(e)
+		}
+		return weight
+	}
+	weight, ok := r.config.Weights[err]
+	if !ok {
+		if inner := errors.Unwrap(err); inner != nil {
+			return r.weight(inner)
+		}
+		weight = 1
+	}
+	return weight
+}
+
+// ShouldBlock reports whether key is currently blocked and its headers should
+// be rejected without verification.
+func (r *Reputation) ShouldBlock(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := r.get(key)
+	if rep == nil {
+		return false
+	}
+	now := time.Now()
+	if now.Before(rep.blocked) {
+		return true
+	}
+	if now.Sub(rep.last) > r.config.Window {
+		r.remove(r.keys[key])
+	}
+	return false
+}
+
+// Score returns the current score of key.
+func (r *Reputation) Score(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := r.get(key)
+	if rep == nil || time.Since(rep.last) > r.config.Window {
+		return 0
+	}
+	return rep.score
+}
+
+// Reset forgets the score and any block held against key.
+func (r *Reputation) Reset(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.keys[key]; ok {
+		r.remove(el)
+	}
+}
+
+// Len returns the number of keys tracked.
+func (r *Reputation) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.keys)
+}
+
+// get returns the reputation of key, nil if it is not tracked. r.mu must be
+// held.
+func (r *Reputation) get(key string) *reputation {
+	el, ok := r.keys[key]
+	if !ok {
+		return nil
+	}
+	return el.Value.(*reputation)
+}
+
+// remove forgets the reputation held in el. r.mu must be held.
+func (r *Reputation) remove(el *list.Element) {
+	delete(r.keys, r.lru.Remove(el).(*reputation).key)
+}
+
+// sweep forgets the least recently failed keys whose scores and blocks have
+// expired at now. r.mu must be held.
+func (r *Reputation) sweep(now time.Time) {
+	for el := r.lru.Back(); el != nil; el = r.lru.Back() {
+		rep := el.Value.(*reputation)
+		if now.Sub(rep.last) <= r.config.Window || now.Before(rep.blocked) {
+			return
+		}
+		r.remove(el)
+	}
+}
@@ -0,0 +1,151 @@
+package hashcash
+
+import (
+	"context"
+	"time"
+)
+
+// VerifyResult structured outcome of a verification, e.g. the input of an
+// external policy engine deciding what a valid stamp is worth.
+type VerifyResult struct {
+	// Valid whether the header passed verification.
+	Valid bool
+	// Status state of the header after verification.
+	Status Status
+	// Err reason the header failed verification, nil if it is valid.
+	Err error
+	// Reason Err as an enumeration, ReasonNone if the header is valid.
+	Reason Reason
+	// Stamp parsed fields of the header, nil if it is malformed.
+	Stamp *Stamp
+	// Digest hex encoded digest of the header, empty if it failed the
+	// collision check.
+	Digest string
+	// CanonicalKey stable identifier of the header, see Hashcash.SpentKey. Empty
+	// if it failed the collision check.
+	CanonicalKey string
+	// Bits number of bits claimed by the header.
+	Bits Bits
+	// ZeroBits number of leading zero bits the digest actually has, also
+	// measured for well formed headers which failed the collision check.
+	ZeroBits int
+	// Resource resource as it appears in the header.
+	Resource string
+	// NormalizedResource resource as compared by the verifier, after
+	// Resource.Normalize and Resource.FoldCase.
+	NormalizedResource string
+	// Extensions extensions carried by the header. It must not be modified.
+	Extensions map[string]string
+	// Created date the header was created, zero if it could not be parsed.
+	Created time.Time
+	// Age time between Created and verification, negative for stamps
+	// created ahead of the verifier's clock.
+	Age time.Duration
+}
+
+// VerifyResult verifies a hashcash header as VerifyContext does, returning
+// the parsed fields of the header along with the outcome. Fields are set as
+// far as the header could be parsed, e.g. Resource is empty for a header
+// which failed the collision check.
+func (h *Hashcash) VerifyResult(ctx context.Context, header string, remote Remote) (*VerifyResult, error) {
+	ev := &VerifyEvent{Context: ctx, Instance: h.name, Header: header, Remote: remote}
+	now := time.Now()
+	_, err := h.run(ev, func() error { return h.verify(header, ev) })
+	r := &VerifyResult{
+		Valid:              ev.Valid,
+		Status:             ev.Status,
+		Err:                ev.Err,
+		Reason:             ReasonOf(ev.Err),
+		Digest:             ev.Hash,
+		CanonicalKey:       ev.CanonicalKey,
+		Bits:               ev.Bits,
+		ZeroBits:           ev.ZeroBits,
+		Resource:           ev.Resource,
+		NormalizedResource: h.normalizeResource(ev.Resource),
+		Extensions:         ev.Extensions,
+		Created:            ev.Created,
+	}
+	if stamp, err := Parse(header); err == nil {
+		r.Stamp = stamp
+		if r.Digest == "" {
+			r.ZeroBits = leadingZeroBits(h.digest(header))
+		}
+		if r.Created.IsZero() {
+			r.Created, _ = stamp.Created()
+		}
+	}
+	if !r.Created.IsZero() {
+		r.Age = now.Sub(r.Created)
+	}
+	return r, err
+}
+
+// VerifyDetailed verifies token as Verify does, returning a structured
+// result with the parsed stamp, measured bits, age and the reason it was
+// rejected, see VerifyResult.
+func (h *Hashcash) VerifyDetailed(token string) (*VerifyResult, error) {
+	return h.VerifyResult(context.Background(), token, Remote{})
+}
+
+// ComputeResult outcome of a search for a solution, e.g. to tune bits or
+// report minting cost in metrics.
+type ComputeResult struct {
+	// Header computed hashcash header, empty if no solution was found.
+	Header string
+	// Bits number of bits the header was minted with.
+	Bits Bits
+	// Attempts number of headers hashed by the call.
+	Attempts uint64
+	// Elapsed wall clock time spent by the call.
+	Elapsed time.Duration
+}
+
+// ComputeResult computes a new hashcash header as ComputeContext does,
+// returning the headers hashed and time spent along with it. If ctx is done
+// first, the work done so far is returned with ctx's error.
+func (h *Hashcash) ComputeResult(ctx context.Context) (*ComputeResult, error) {
+	counter, start := h.counter, time.Now()
+	header, err := h.ComputeContext(ctx)
+	r := &ComputeResult{
+		Header:   header,
+		Bits:     h.bits,
+		Attempts: h.counter - counter,
+		Elapsed:  time.Since(start),
+	}
+	if err == nil {
+		// the counter is left at the solution
+		r.Attempts++
+	}
+	return r, err
+}
+
+// Map renders r as a flat map, e.g. the input document of rules. Keys are
+// valid, status, error, reason, digest, canonical_key, bits, zero_bits,
+// resource, normalized_resource, created (Unix seconds), age_seconds and
+// ext.<name> for each extension. error is empty when the header is valid.
+func (r *VerifyResult) Map() map[string]interface{} {
+	m := map[string]interface{}{
+		"valid":               r.Valid,
+		"status":              r.Status.String(),
+		"error":               "",
+		"reason":              r.Reason.String(),
+		"digest":              r.Digest,
+		"canonical_key":       r.CanonicalKey,
+		"bits":                int(r.Bits),
+		"zero_bits":           r.ZeroBits,
+		"resource":            r.Resource,
+		"normalized_resource": r.NormalizedResource,
+		"created":             int64(0),
+		"age_seconds":         r.Age.Seconds(),
+	}
+	if r.Err != nil {
+		m["error"] = r.Err.Error()
+	}
+	if !r.Created.IsZero() {
+		m["created"] = r.Created.Unix()
+	}
+	for name, value := range r.Extensions {
+		m["ext."+name] = value
+	}
+	return m
+}
@@ -0,0 +1,29 @@
+package hashcash
+
+import (
+	"context"
+	"time"
+)
+
+// Miner computes hashcash headers. It is implemented by Hashcash, and lets
+// services depend on the minting side alone, e.g. to substitute a mock or a
+// remote miner. Compute is kept for existing implementations, callers use
+// ComputeContext or MintStep.
+type Miner interface {
+	Compute() (string, error)
+	ComputeContext(context.Context) (string, error)
+	MintStep(time.Duration) (bool, string, error)
+}
+
+// Verifier verifies hashcash headers. It is implemented by Hashcash, and lets
+// services depend on the verifying side alone, e.g. to substitute a mock or a
+// client of a remote verifier.
+type Verifier interface {
+	Verify(string) (bool, error)
+	VerifyContext(context.Context, string, Remote) (bool, error)
+}
+
+var (
+	_ Miner    = (*Hashcash)(nil)
+	_ Verifier = (*Hashcash)(nil)
+)
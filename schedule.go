@@ -0,0 +1,78 @@
+package hashcash
+
+import "time"
+
+// BitsSchedule raises the bits required of headers on a calendar, e.g. one
+// bit every 18 months, so the real world cost of minting stays constant as
+// hardware improves.
+type BitsSchedule struct {
+	// Start time Bits applies from.
+	Start time.Time
+	// Bits required at Start.
+	Bits Bits
+	// Every interval after which one more bit is required, e.g.
+	// 18 * 30 * 24 * time.Hour.
+	Every time.Duration
+	// Max bits after which the schedule stops increasing, at most 64.
+	Max Bits
+	// Grace period after a step during which headers with the previous
+	// number of bits are still accepted, so headers minted just before a
+	// step are not rejected.
+	Grace time.Duration
+}
+
+// BitsChange a scheduled change of required bits
+type BitsChange struct {
+	At   time.Time
+	Bits Bits
+}
+
+// BitsAt returns the bits minted at t.
+func (s *BitsSchedule) BitsAt(t time.Time) Bits {
+	bits := int(s.Bits)
+	if s.Every > 0 && t.After(s.Start) {
+		bits += int(t.Sub(s.Start) / s.Every)
+	}
+	return s.clamp(bits)
+}
+
+// Required returns the bits required of headers verified at t, allowing for
+// the grace period.
+func (s *BitsSchedule) Required(t time.Time) Bits {
+	return s.BitsAt(t.Add(-s.Grace))
+}
+
+// Upcoming returns up to n changes of minted bits after t.
+func (s *BitsSchedule) Upcoming(t time.Time, n int) []BitsChange {
+	var changes []BitsChange
+	if s.Every <= 0 {
+		return changes
+	}
+	bits := s.BitsAt(t)
+	at := s.Start
+	if t.After(s.Start) {
+		at = s.Start.Add(t.Sub(s.Start) / s.Every * s.Every)
+	}
+	for len(changes) < n && bits < s.max() {
+		at = at.Add(s.Every)
+		bits++
+		changes = append(changes, BitsChange{At: at, Bits: bits})
+	}
+	return changes
+}
+
+// clamp limits bits to the schedule maximum.
+func (s *BitsSchedule) clamp(bits int) Bits {
+	if bits > int(s.max()) {
+		return s.max()
+	}
+	return Bits(bits)
+}
+
+// max returns the schedule maximum, at most maxBits.
+func (s *BitsSchedule) max() Bits {
+	if s.Max == 0 || s.Max.Validate() != nil {
+		return Bits(maxBits)
+	}
+	return s.Max
+}
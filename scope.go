@@ -0,0 +1,96 @@
+package hashcash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scope resource a stamp can be minted for once and spent on any resource it
+// covers, e.g. once per session for all endpoints of an API.
+type Scope struct {
+	// Pattern resource stamps for the scope are minted for. A trailing '*'
+	// matches any suffix, e.g. "api.example.com/*" covers
+	// "api.example.com/v1/comments".
+	Pattern string
+	// Uses number of verifications a stamp for the scope is accepted for,
+	// across all resources it covers, 1 when zero.
+	Uses int
+}
+
+// covers reports whether the scope covers resource.
+func (s Scope) covers(resource string) bool {
+	if prefix, ok := strings.CutSuffix(s.Pattern, "*"); ok {
+		return strings.HasPrefix(resource, prefix)
+	}
+	return resource == s.Pattern
+}
+
+// scopeValidator returns a validator accepting headers minted for a scope
+// covering one of targets, passing others to next.
+func scopeValidator(scopes []Scope, targets []string, fold bool, next func(context.Context, string) bool) func(context.Context, string) bool {
+	return func(ctx context.Context, s string) bool {
+		scope, ok := findScope(scopes, foldCase(s, fold))
+		if !ok {
+			return next != nil && next(ctx, s)
+		}
+		for _, t := range targets {
+			if scope.covers(foldCase(t, fold)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// findScope returns the scope of scopes with pattern resource.
+func findScope(scopes []Scope, resource string) (Scope, bool) {
+	for _, s := range scopes {
+		if s.Pattern == resource {
+			return s, true
+		}
+	}
+	return Scope{}, false
+}
+
+// claimUses records a use of key, minted for a scope allowing uses. Every
+// use but the last is recorded under a numbered key, the last under key, so
+// the header shows as spent once its uses are exhausted.
+func (h *Hashcash) claimUses(ev *VerifyEvent, key string, uses int) error {
+	if uses < 1 {
+		uses = 1
+	}
+	for i := 1; i < uses; i++ {
+		spent, err := h.take(ev, fmt.Sprintf("%s#%d", key, i))
+		if err != nil {
+			return err
+		}
+		if !spent {
+			ev.ScopeUse = i
+			return nil
+		}
+	}
+	spent, err := h.take(ev, key)
+	if err != nil {
+		return err
+	}
+	if spent {
+		return ErrSpent
+	}
+	ev.ScopeUse = uses
+	return nil
+}
+
+// take records key as spent unless storage already holds it, reporting
+// whether it did, atomically when storage implements ContextCheckAndAdder or
+// CheckAndAdder.
+func (h *Hashcash) take(ev *VerifyEvent, key string) (bool, error) {
+	if spent, ok, err := h.checkAndAdd(ev.Context, key, ev.Created); ok {
+		return spent, err
+	}
+	spent, err := h.isSpent(ev.Context, key)
+	if err != nil || spent {
+		return spent, err
+	}
+	return false, h.record(ev.Context, key, ev.Created)
+}
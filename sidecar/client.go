@@ -0,0 +1,121 @@
+package sidecar
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// ReplyError verification failure reported by the server.
+type ReplyError struct {
+	// Code names the failed check, see the package documentation.
+	Code string
+	// Message error message of the verifier.
+	Message string
+}
+
+// Error returns the error message of the verifier.
+func (e *ReplyError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error Code stands for, e.g. hashcash.ErrSpent, or nil
+// for unknown codes.
+func (e *ReplyError) Unwrap() error {
+	for _, c := range codes {
+		if c.code == e.Code {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// Client connection to a sidecar server. It is safe for concurrent use,
+// requests are sent one at a time.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// Dial connects to the sidecar server listening on the Unix socket at path.
+func Dial(path string) (*Client, error) {
+	return DialTimeout(path, 0)
+}
+
+// DialTimeout connects to the sidecar server listening on the Unix socket at
+// path, failing requests not answered within timeout. A zero timeout means
+// no timeout.
+func DialTimeout(path string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Verify verifies and spends header. Verification failures are returned as
+// *ReplyError, which matches the verifier's error with errors.Is, e.g.
+// hashcash.ErrSpent.
+func (c *Client) Verify(header string) (bool, error) {
+	if header == "" || strings.ContainsAny(header, " \r\n") {
+		return false, hashcash.ErrInvalidHeader
+	}
+	if _, err := c.do(cmdVerify + " " + header); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Challenge returns the collision size stamps must be minted with.
+func (c *Client) Challenge() (hashcash.Bits, error) {
+	arg, err := c.do(cmdChallenge)
+	if err != nil {
+		return 0, err
+	}
+	bits, err := hashcash.ParseBits(arg)
+	if err != nil {
+		return 0, ErrProtocol
+	}
+	return bits, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a request line and returns the argument of an OK reply, or the
+// error of an ERR reply.
+func (c *Client) do(req string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if _, err := c.conn.Write([]byte(req + "\n")); err != nil {
+		return "", err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	status, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+	switch status {
+	case replyOK:
+		return arg, nil
+	case replyErr:
+		code, msg, ok := strings.Cut(arg, " ")
+		if !ok {
+			return "", ErrProtocol
+		}
+		return "", &ReplyError{Code: code, Message: msg}
+	default:
+		return "", ErrProtocol
+	}
+}
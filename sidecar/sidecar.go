@@ -0,0 +1,272 @@
+/*
+Package sidecar exposes a hashcash verifier over a Unix domain socket, so local
+processes written in any language (e.g. Postfix policy daemons, scripts) can
+verify stamps without linking the library or exposing a network port.
+
+The protocol is line oriented. Each request is one line, answered by one line:
+
+	CHALLENGE            OK <bits>
+	VERIFY <header>      OK
+	                     ERR <code> <message>
+
+CHALLENGE reports the collision size stamps must be minted with. VERIFY
+verifies and spends a header, failures are answered with a code naming the
+failed check and the error message, e.g. "ERR spent hashcash has already been
+spent". Codes are invalid, version, collision, excess, expired, future,
+resource, spent, blocked, extension and sunset, or error for other failures.
+Unknown commands and malformed requests are answered with the protocol code,
+and the connection is kept open.
+
+	srv := sidecar.NewServer(&sidecar.Config{Verifier: hc, Bits: 20})
+	ln, err := net.Listen("unix", "/run/hashcash.sock")
+	if err != nil {
+		// handle error
+	}
+	go srv.Serve(ln)
+
+Go processes can use Client:
+
+	c, err := sidecar.Dial("/run/hashcash.sock")
+	if err != nil {
+		// handle error
+	}
+	valid, err := c.Verify(header)
+*/
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+const (
+	maxLine      = 4096            // Longest request line accepted
+	idleTimeout  = 5 * time.Minute // Default time a connection may be idle
+	sep          = "; "            // Separates joined errors on one line
+	cmdVerify    = "VERIFY"        // Verify and spend a header
+	cmdChallenge = "CHALLENGE"     // Report the collision size required
+	replyOK      = "OK"            // Request succeeded
+	replyErr     = "ERR"           // Request failed, followed by the message
+)
+
+var (
+	// ErrProtocol error malformed request or reply
+	ErrProtocol = errors.New("sidecar: protocol error")
+
+	// ErrClosed error server has been closed
+	ErrClosed = errors.New("sidecar: server closed")
+)
+
+// codeOther code of errors not in codes
+const codeOther = "error"
+
+// codes reply codes of verification errors, errors wrapping others are listed
+// first.
+var codes = []struct {
+	code string
+	err  error
+}{
+	{"protocol", ErrProtocol},
+	{"invalid", hashcash.ErrInvalidHeader},
+	{"version", hashcash.ErrUnsupportedVersion},
+	{"collision", hashcash.ErrNoCollision},
+	{"excess", hashcash.ErrExcessBits},
+	{"expired", hashcash.ErrExpired},
+	{"future", hashcash.ErrFutureStamp},
+	{"expired", hashcash.ErrTimestamp},
+	{"resource", hashcash.ErrResourceFail},
+	{"spent", hashcash.ErrSpent},
+	{"blocked", hashcash.ErrBlocked},
+	{"extension", hashcash.ErrExtension},
+	{"sunset", hashcash.ErrSHA1Sunset},
+}
+
+// Config for a sidecar server
+type Config struct {
+	// Verifier verifies and spends headers, e.g. a *hashcash.Hashcash.
+	Verifier hashcash.Verifier
+	// Bits collision size reported to CHALLENGE requests.
+	Bits hashcash.Bits
+	// IdleTimeout closes connections idle for longer, 5 minutes when zero.
+	IdleTimeout time.Duration
+}
+
+// Server serves the sidecar protocol. It is safe for concurrent use.
+type Server struct {
+	config Config
+	mu     sync.Mutex
+	lns    map[net.Listener]bool
+	conns  map[net.Conn]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer creates a server verifying headers with config.Verifier.
+func NewServer(config *Config) *Server {
+	s := &Server{
+		config: *config,
+		lns:    make(map[net.Listener]bool),
+		conns:  make(map[net.Conn]bool),
+	}
+	if s.config.IdleTimeout <= 0 {
+		s.config.IdleTimeout = idleTimeout
+	}
+	return s
+}
+
+// Serve accepts connections on ln, serving each in its own goroutine, until
+// ln fails or the server is closed, when ErrClosed error is returned.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.track(ln, true) {
+		return ErrClosed
+	}
+	defer s.track(ln, false)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrClosed
+			}
+			return err
+		}
+		if !s.trackConn(conn, true) {
+			conn.Close()
+			return ErrClosed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.trackConn(conn, false)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close stops all listeners and closes open connections, waiting for
+// requests in progress to be answered.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.lns {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// track adds or removes a listener, it reports false when the server is
+// closed.
+func (s *Server) track(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		s.lns[ln] = true
+	} else {
+		delete(s.lns, ln)
+	}
+	return true
+}
+
+// trackConn adds or removes a connection, it reports false when the server
+// is closed.
+func (s *Server) trackConn(conn net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		s.conns[conn] = true
+	} else {
+		delete(s.conns, conn)
+	}
+	return true
+}
+
+// extend extends the read deadline of conn by the idle timeout, it reports
+// false when the server is closed.
+func (s *Server) extend(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(s.config.IdleTimeout))
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// serveConn answers requests on conn until it is closed or idle.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var (
+		r = bufio.NewScanner(conn)
+		w = bufio.NewWriter(conn)
+	)
+	r.Buffer(make([]byte, 0, 512), maxLine)
+	for {
+		if !s.extend(conn) || !r.Scan() {
+			return
+		}
+		w.WriteString(s.handle(r.Text()))
+		w.WriteByte('\n')
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a request line.
+func (s *Server) handle(line string) string {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch strings.ToUpper(cmd) {
+	case cmdChallenge:
+		return replyOK + " " + s.config.Bits.String()
+	case cmdVerify:
+		if arg == "" {
+			return reply(ErrProtocol)
+		}
+		if _, err := s.config.Verifier.VerifyContext(context.Background(), arg, hashcash.Remote{}); err != nil {
+			return reply(err)
+		}
+		return replyOK
+	default:
+		return reply(ErrProtocol)
+	}
+}
+
+// reply formats err as an ERR reply on a single line.
+func reply(err error) string {
+	return replyErr + " " + Code(err) + " " + strings.ReplaceAll(err.Error(), "\n", sep)
+}
+
+// Code returns the reply code of err, the first code in the protocol's list
+// err matches with errors.Is, or "error". Servers speaking the protocol in
+// front of other verifiers use it so their replies match hashcashd's.
+func Code(err error) string {
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return codeOther
+}
@@ -0,0 +1,161 @@
+package sidecar_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/sidecar"
+)
+
+// mapStorage in memory storage
+type mapStorage struct {
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func (s *mapStorage) Add(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[hash] = true
+	return nil
+}
+
+func (s *mapStorage) Spent(hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[hash]
+}
+
+func newInstance(t *testing.T) *hashcash.Hashcash {
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(res string) bool { return res == "someone@gmail.com" },
+		},
+		&hashcash.Config{
+			Bits:    8,
+			Future:  time.Now().AddDate(0, 0, 2),
+			Expired: time.Now().AddDate(0, 0, -30),
+			Storage: &mapStorage{m: make(map[string]bool)},
+		},
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return hc
+}
+
+// serve starts a server for hc on a socket in a temporary directory,
+// returning the socket path.
+func serve(t *testing.T, hc *hashcash.Hashcash) (*sidecar.Server, string) {
+	path := filepath.Join(t.TempDir(), "hashcash.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v\n", err)
+	}
+	srv := sidecar.NewServer(&sidecar.Config{Verifier: hc, Bits: 8})
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-done; err != sidecar.ErrClosed {
+			t.Errorf("%v\n", err)
+		}
+	})
+	return srv, path
+}
+
+func TestClient(t *testing.T) {
+	hc := newInstance(t)
+	_, path := serve(t, hc)
+	c, err := sidecar.Dial(path)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer c.Close()
+	if bits, err := c.Challenge(); err != nil || bits != 8 {
+		t.Errorf("bits %v: %v\n", bits, err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := c.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := c.Verify(stamp); !errors.Is(err, hashcash.ErrSpent) {
+		t.Errorf("%v\n", err)
+	}
+	_, err = c.Verify("1:8:bad")
+	if e, ok := err.(*sidecar.ReplyError); !ok || e.Code != "invalid" || !errors.Is(err, hashcash.ErrInvalidHeader) {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	_, path := serve(t, newInstance(t))
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	tests := []struct {
+		req, reply string
+	}{
+		{"challenge", "OK 8"},
+		{"VERIFY", "ERR protocol " + sidecar.ErrProtocol.Error()},
+		{"VERIFY 1:8:bad", "ERR invalid invalid hashcash header: "},
+		{"VERIFY 1:8:200101000000:foo::a:1", "ERR collision "},
+		{"SPEND x", "ERR protocol " + sidecar.ErrProtocol.Error()},
+	}
+	for _, test := range tests {
+		fmt.Fprintf(conn, "%s\n", test.req)
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if got := strings.TrimSuffix(line, "\n"); !strings.HasPrefix(got, test.reply) {
+			t.Errorf("%s: got %q want %q\n", test.req, got, test.reply)
+		}
+	}
+}
+
+// TestCodes codes of the protocol are part of its contract, documented in
+// the package and README.
+func TestCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{sidecar.ErrProtocol, "protocol"},
+		{hashcash.ErrInvalidHeader, "invalid"},
+		{&hashcash.ParseError{Field: "bits"}, "invalid"},
+		{hashcash.ErrUnsupportedVersion, "version"},
+		{&hashcash.CollisionError{Bits: 1, Required: 8}, "collision"},
+		{hashcash.ErrExcessBits, "excess"},
+		{hashcash.ErrExpired, "expired"},
+		{hashcash.ErrChallengeExpired, "expired"},
+		{hashcash.ErrFutureStamp, "future"},
+		{hashcash.ErrTimestamp, "expired"},
+		{hashcash.ErrResourceFail, "resource"},
+		{hashcash.ErrSpent, "spent"},
+		{hashcash.ErrBlocked, "blocked"},
+		{hashcash.ErrExtension, "extension"},
+		{hashcash.ErrSHA1Sunset, "sunset"},
+		{hashcash.ErrStorage, "error"},
+	}
+	for _, test := range tests {
+		if got := sidecar.Code(test.err); got != test.code {
+			t.Errorf("%v: got %q want %q\n", test.err, got, test.code)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package hashcash
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stamp fields of a version 1 hashcash header, e.g. to log the resource or
+// bits of a token without re-implementing the header format.
+type Stamp struct {
+	// Version format version of the header, 1.
+	Version int
+	// Bits number of bits claimed by the header.
+	Bits Bits
+	// Date date the header was created, in format YYMMDD[hhmm[ss]].
+	Date string
+	// Resource data string the header was minted for.
+	Resource string
+	// Extension extension field, see ParseExtensions.
+	Extension string
+	// Rand random characters, encoded in base-64 format.
+	Rand string
+	// Counter counter, encoded in base-64 format.
+	Counter string
+}
+
+// Parse parses the fields of token. Errors describing an invalid field are
+// *ParseError, which wrap ErrInvalidHeader. If the version of token is not
+// supported, ErrUnsupportedVersion error is returned. Parse does not check
+// the proof of work, use Verify to do so.
+func Parse(token string) (*Stamp, error) {
+	version, err := scanHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	if !SupportsStampVersion(version) {
+		return nil, ErrUnsupportedVersion
+	}
+	// vals: [version bits date resource extension random counter]
+	vals := strings.Split(token, ":")
+	if err := checkDigits(vals, 1, fieldOffset(vals, 1), 1, 2); err != nil {
+		return nil, err
+	}
+	bits, err := ParseBits(vals[1])
+	if err != nil {
+		return nil, &ParseError{Field: fieldNames[1], Offset: fieldOffset(vals, 1), Reason: err.Error()}
+	}
+	if err := checkDigits(vals, 2, fieldOffset(vals, 2), 6, 10, 12); err != nil {
+		return nil, err
+	}
+	if _, err := parseHashcashTime(vals[2]); err != nil {
+		return nil, &ParseError{Field: fieldNames[2], Offset: fieldOffset(vals, 2), Reason: err.Error()}
+	}
+	return &Stamp{
+		Version:   version,
+		Bits:      bits,
+		Date:      vals[2],
+		Resource:  vals[3],
+		Extension: vals[4],
+		Rand:      vals[5],
+		Counter:   vals[6],
+	}, nil
+}
+
+// Created returns the date s was created, in UTC.
+func (s *Stamp) Created() (time.Time, error) {
+	return parseHashcashTime(s.Date)
+}
+
+// Extensions returns the extensions carried by s, see ParseExtensions.
+func (s *Stamp) Extensions() (map[string]string, error) {
+	return ParseExtensions(s.Extension)
+}
+
+// String returns s in hashcash header format.
+func (s *Stamp) String() string {
+	return fmt.Sprintf("%d:%d:%s:%s:%s:%s:%s", s.Version,
+		s.Bits,
+		s.Date,
+		s.Resource,
+		s.Extension,
+		s.Rand,
+		s.Counter)
+}
+
+// ComputeStamp searches for a counter giving s the bits it claims, hashing
+// with the algorithm of h, so headers can be built field by field, e.g. with
+// a custom date, extension or random characters. Empty fields are filled as
+// Compute fills them: Version with 1, Date with the current time and Rand with
+// random characters. The counter found is stored in s and the header is
+// returned. ComputeStamp searches until a solution is found or ctx is done,
+// in which case ctx's error is returned.
+func (h *Hashcash) ComputeStamp(ctx context.Context, s *Stamp) (string, error) {
+	if s.Version == 0 {
+		s.Version = h.version
+	}
+	if !SupportsStampVersion(s.Version) {
+		return "", ErrUnsupportedVersion
+	}
+	if err := s.Bits.Validate(); err != nil {
+		return "", err
+	}
+	if s.Date == "" {
+		s.Date = time.Now().UTC().Format(timeFormat)
+	}
+	if s.Rand == "" {
+		rand, err := randomBytes(bytesToRead)
+		if err != nil {
+			return "", err
+		}
+		s.Rand = base64EncodeBytes(rand)
+	}
+	// vals: [version bits date resource extension random counter]
+	vals := []string{strconv.Itoa(s.Version), strconv.Itoa(int(s.Bits)), s.Date, s.Resource, s.Extension, s.Rand}
+	for i := 2; i < len(vals); i++ {
+		if j := strings.IndexByte(vals[i], ':'); j >= 0 {
+			return "", &ParseError{Field: fieldNames[i], Offset: fieldOffset(vals, i) + j, Reason: "unexpected ':'"}
+		}
+	}
+	if err := checkDigits(vals, 2, fieldOffset(vals, 2), 6, 10, 12); err != nil {
+		return "", err
+	}
+	if _, err := parseHashcashTime(s.Date); err != nil {
+		return "", &ParseError{Field: fieldNames[2], Offset: fieldOffset(vals, 2), Reason: err.Error()}
+	}
+	for counter := uint64(0); ; counter++ {
+		if counter%mintStepCheck == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+		s.Counter = base64EncodeUint(counter)
+		header := s.String()
+		if acceptableHeader(h.digest(header), s.Bits) {
+			return header, nil
+		}
+	}
+}
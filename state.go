@@ -0,0 +1,216 @@
+package hashcash
+
+import (
+	"container/list"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// stateVersion format version of state written by SaveState
+const stateVersion = 1
+
+// verifierState short term protection state of a verifier, as written by
+// SaveState.
+type verifierState struct {
+	Version    int                        `json:"version"`
+	Reputation map[string]reputationState `json:"reputation,omitempty"`
+	Retries    []retryState               `json:"retries,omitempty"`
+	Spent      []spentState               `json:"spent,omitempty"`
+}
+
+// reputationState saved score of a single remote key
+type reputationState struct {
+	Score   int       `json:"score"`
+	Last    time.Time `json:"last"`
+	Blocked time.Time `json:"blocked"`
+}
+
+// retryState saved header verified by a remote key
+type retryState struct {
+	Hash string    `json:"hash"`
+	Key  string    `json:"key"`
+	At   time.Time `json:"at"`
+}
+
+// spentState saved spent entry of in-memory storage
+type spentState struct {
+	Hash  string    `json:"hash"`
+	Added time.Time `json:"added,omitempty"`
+}
+
+// SaveState writes the in-memory verification state of the instance, i.e.
+// reputation scores, headers within the retry window and, when
+// Config.Storage is a MemoryStorage or a Cache, its spent entries, to w. A
+// verifier process can restore it with LoadState after a restart, so short
+// term protection is not lost even with memory storage only. Other storage
+// keeps spent headers itself.
+func (h *Hashcash) SaveState(w io.Writer) error {
+	state := verifierState{Version: stateVersion}
+	if h.reputation != nil {
+		state.Reputation = h.reputation.snapshot()
+	}
+	if h.retries != nil {
+		state.Retries = h.retries.snapshot()
+	}
+	switch s := h.storage.(type) {
+	case *MemoryStorage:
+		state.Spent = s.snapshot()
+	case *Cache:
+		state.Spent = s.snapshot()
+	}
+	return json.NewEncoder(w).Encode(state)
+}
+
+// LoadState restores state written by SaveState from r, replacing the
+// reputation scores and retry window of the instance, and adding the spent
+// entries to a MemoryStorage or Cache. State for features which are not
+// configured on the instance is ignored, and expired entries are dropped.
+func (h *Hashcash) LoadState(r io.Reader) error {
+	var state verifierState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version != stateVersion {
+		return ErrStateVersion
+	}
+	if h.reputation != nil {
+		h.reputation.restore(state.Reputation)
+	}
+	if h.retries != nil {
+		h.retries.restore(state.Retries)
+	}
+	switch s := h.storage.(type) {
+	case *MemoryStorage:
+		s.restore(state.Spent)
+	case *Cache:
+		s.restore(state.Spent)
+	}
+	return nil
+}
+
+// snapshot returns the scores of keys which have not expired.
+func (r *Reputation) snapshot() map[string]reputationState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	keys := make(map[string]reputationState, len(r.keys))
+	for key, el := range r.keys {
+		rep := el.Value.(*reputation)
+		if now.Sub(rep.last) > r.config.Window && !now.Before(rep.blocked) {
+			continue
+		}
+		keys[key] = reputationState{
+			Score:   rep.score,
+			Last:    rep.last,
+			Blocked: rep.blocked,
+		}
+	}
+	return keys
+}
+
+// restore replaces the scores of all keys with keys, keeping the MaxKeys
+// most recently failed.
+func (r *Reputation) restore(keys map[string]reputationState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reps := make([]*reputation, 0, len(keys))
+	for key, rep := range keys {
+		reps = append(reps, &reputation{
+			key:     key,
+			score:   rep.Score,
+			last:    rep.Last,
+			blocked: rep.Blocked,
+		})
+	}
+	sort.Slice(reps, func(i, j int) bool { return reps[i].last.Before(reps[j].last) })
+	r.keys = make(map[string]*list.Element, len(reps))
+	r.lru.Init()
+	for _, rep := range reps {
+		if len(r.keys) >= r.config.MaxKeys {
+			r.remove(r.lru.Back())
+		}
+		r.keys[rep.key] = r.lru.PushFront(rep)
+	}
+}
+
+// snapshot returns the entries within the window, oldest first.
+func (r *retryCache) snapshot() []retryState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(time.Now())
+	entries := make([]retryState, 0, len(r.order))
+	for _, v := range r.order {
+		entries = append(entries, retryState{Hash: v.hash, Key: v.key, At: v.at})
+	}
+	return entries
+}
+
+// restore replaces the entries of the cache with entries, which must be
+// ordered oldest first.
+func (r *retryCache) restore(entries []retryState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byHash = make(map[string]verified, len(entries))
+	r.order = r.order[:0]
+	for _, e := range entries {
+		v := verified{hash: e.Hash, key: e.Key, at: e.At}
+		r.byHash[v.hash] = v
+		r.order = append(r.order, v)
+	}
+	r.expire(time.Now())
+}
+
+// snapshot returns the unexpired entries, oldest first.
+func (m *MemoryStorage) snapshot() []spentState {
+	var entries []spentState
+	m.Recent(time.Time{}, func(info SpentInfo) error {
+		entries = append(entries, spentState{Hash: info.Key, Added: info.Added})
+		return nil
+	})
+	return entries
+}
+
+// restore adds the unexpired entries of entries which are not held, keeping
+// entries in insertion order and evicting the oldest beyond MaxEntries.
+func (m *MemoryStorage) restore(entries []spentState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := m.now().Add(-m.config.TTL)
+	for _, e := range entries {
+		if _, ok := m.entries[e.Hash]; !ok && e.Added.After(cutoff) {
+			m.entries[e.Hash] = e.Added
+		}
+	}
+	m.order, m.head = make([]memoryEntry, 0, len(m.entries)), 0
+	for hash, added := range m.entries {
+		m.order = append(m.order, memoryEntry{hash: hash, added: added})
+	}
+	sort.Slice(m.order, func(i, j int) bool { return m.order[i].added.Before(m.order[j].added) })
+	for len(m.entries) > m.config.MaxEntries {
+		m.evict()
+	}
+	m.compact()
+}
+
+// snapshot returns the entries held in memory, oldest first.
+func (c *Cache) snapshot() []spentState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]spentState, 0, len(c.order))
+	for _, hash := range c.order {
+		entries = append(entries, spentState{Hash: hash})
+	}
+	return entries
+}
+
+// restore adds entries to memory, without writing them to the backend,
+// which holds them already.
+func (c *Cache) restore(entries []spentState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		c.insert(e.Hash)
+	}
+}
@@ -0,0 +1,68 @@
+package hashcash
+
+import (
+	"context"
+	"errors"
+)
+
+// Status lifecycle state of a stamp. A stamp is minted, presented to a
+// verifier, verified, then spent so it cannot be presented again. A stamp
+// which is never spent eventually expires.
+type Status int
+
+const (
+	// StatusMinted computed and held by the minter, e.g. in a Wallet.
+	StatusMinted Status = iota
+	// StatusPresented presented to a verifier, but has not passed
+	// verification.
+	StatusPresented
+	// StatusVerified passed verification, but has not been spent, see Check.
+	StatusVerified
+	// StatusSpent verified and recorded in spent storage.
+	StatusSpent
+	// StatusExpired created before Config.Expired.
+	StatusExpired
+)
+
+// statusNames names of statuses, indexed by status
+var statusNames = []string{"minted", "presented", "verified", "spent", "expired"}
+
+// String returns the name of s, e.g. for dashboards.
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return "unknown"
+	}
+	return statusNames[s]
+}
+
+// statusOf returns the status of a stamp after verification failed with err,
+// or succeeded if err is nil.
+func statusOf(err error) Status {
+	switch {
+	case err == nil, errors.Is(err, ErrSpent):
+		return StatusSpent
+	case errors.Is(err, ErrExpired):
+		return StatusExpired
+	}
+	return StatusPresented
+}
+
+// Check runs the checks of Verify against header without spending it, or
+// invoking Config.OnVerify and the reputation tracker. It returns
+// StatusVerified if header would pass verification, otherwise the status of
+// header and the reason it would fail.
+func (h *Hashcash) Check(ctx context.Context, header string) (Status, error) {
+	ev := &VerifyEvent{Context: ctx, Instance: h.name, Header: header}
+	key, err := h.check(header, ev)
+	if err != nil {
+		return statusOf(err), err
+	}
+	isSpent, err := h.isSpent(ctx, key)
+	if err != nil {
+		return StatusPresented, err
+	}
+	if isSpent {
+		return StatusSpent, ErrSpent
+	}
+	return StatusVerified, nil
+}
@@ -1,6 +1,11 @@
 package hashcash
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Purger purges hashcash entries from the underlying storage
 type Purger interface {
@@ -19,3 +24,192 @@ type Spender interface {
 type Storage interface {
 	Spender
 }
+
+// CheckAndAdder is optionally implemented by Storage or StorageV2 to check
+// and add an entry in one atomic operation, so concurrent verifications of
+// the same header cannot both pass. When implemented, it is used in place of
+// separate Spent and Add calls, and its failures are returned wrapped in
+// ErrStorage.
+type CheckAndAdder interface {
+	CheckAndAdd(hash string) (alreadySpent bool, err error)
+}
+
+// ContextCheckAndAdder is optionally implemented by Storage or StorageV2 to
+// check and add an entry in one atomic operation, as CheckAndAdder does,
+// receiving the context of the verification and the date the header of the
+// entry was created, as ContextSpender and DateSpender do. When implemented,
+// it is used in place of CheckAndAdder.
+type ContextCheckAndAdder interface {
+	CheckAndAddContext(ctx context.Context, hash string, created time.Time) (alreadySpent bool, err error)
+}
+
+// StorageV2 store and retrieve hashcash entries, reporting backend failures
+// and when entries may be forgotten. ctx is the context of the verification
+// an operation is performed for, and expires the time after which the header
+// of an entry is rejected as expired, zero if it never is. Failures are
+// returned by verification wrapped in ErrStorage, so it fails closed, where
+// Storage can only report failures to add entries.
+type StorageV2 interface {
+	Add(ctx context.Context, hash string, expires time.Time) error
+	Spent(ctx context.Context, hash string) (bool, error)
+}
+
+// storageAdapter adapts Storage to StorageV2
+type storageAdapter struct {
+	s Storage
+}
+
+// AdaptStorage adapts s to StorageV2, using ContextSpender when implemented.
+// Spent never fails and expiry times are dropped, as s cannot report failures
+// to check entries or hold expiry times.
+func AdaptStorage(s Storage) StorageV2 {
+	return storageAdapter{s}
+}
+
+func (a storageAdapter) Add(ctx context.Context, hash string, _ time.Time) error {
+	if cs, ok := a.s.(ContextSpender); ok {
+		return cs.AddContext(ctx, hash)
+	}
+	return a.s.Add(hash)
+}
+
+func (a storageAdapter) Spent(ctx context.Context, hash string) (bool, error) {
+	return spent(ctx, a.s, hash), nil
+}
+
+// SpentInfo details of a spent storage entry
+type SpentInfo struct {
+	// Key under which the header was recorded, see SpentKey.
+	Key string
+	// Added time the entry was added.
+	Added time.Time
+}
+
+// Admin is optionally implemented by Storage to let operators investigate and
+// correct individual entries, e.g. a header disputed as wrongly rejected as
+// spent.
+type Admin interface {
+	Lookup(string) (SpentInfo, bool, error)
+	Remove(string) error
+}
+
+// ContextSpender is optionally implemented by Storage to receive the context
+// of the verification an operation is performed for, e.g. to honour deadlines
+// or propagate tracing. When implemented, it is used in place of Spender.
+type ContextSpender interface {
+	AddContext(context.Context, string) error
+	SpentContext(context.Context, string) bool
+}
+
+// BatchSpender is optionally implemented by Storage to check many entries in
+// a single round trip, e.g. with a pipeline or an IN query. It is used by
+// VerifyBatch.
+type BatchSpender interface {
+	SpentBatch([]string) ([]bool, error)
+}
+
+// DateSpender is optionally implemented by Storage to record the date the
+// header of an entry was created, e.g. to purge entries once headers created
+// at that date have expired. When implemented, it is used in place of
+// Spender and ContextSpender to add entries.
+type DateSpender interface {
+	AddDate(ctx context.Context, hash string, created time.Time) error
+}
+
+// add adds hash to s, using DateSpender or ContextSpender when implemented.
+func add(ctx context.Context, s Storage, hash string, created time.Time) error {
+	if ds, ok := s.(DateSpender); ok {
+		return ds.AddDate(ctx, hash, created)
+	}
+	if cs, ok := s.(ContextSpender); ok {
+		return cs.AddContext(ctx, hash)
+	}
+	return s.Add(hash)
+}
+
+// spent checks if hash is in s, using ContextSpender when implemented.
+func spent(ctx context.Context, s Storage, hash string) bool {
+	if cs, ok := s.(ContextSpender); ok {
+		return cs.SpentContext(ctx, hash)
+	}
+	return s.Spent(hash)
+}
+
+// spentBatch checks which of hashes are in s, using BatchSpender when
+// implemented and falling back to checking each hash.
+func spentBatch(ctx context.Context, s Storage, hashes []string) []bool {
+	if bs, ok := s.(BatchSpender); ok {
+		if isSpent, err := bs.SpentBatch(hashes); err == nil && len(isSpent) == len(hashes) {
+			return isSpent
+		}
+	}
+	isSpent := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		isSpent[i] = spent(ctx, s, hash)
+	}
+	return isSpent
+}
+
+// storageError wraps err in ErrStorage, unless it is a context error.
+func storageError(err error) error {
+	if err == nil || errors.Is(err, ErrStorage) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrStorage, err)
+}
+
+// backend returns storage, Config.StorageV2 when set.
+func (h *Hashcash) backend() interface{} {
+	if h.store != nil {
+		return h.store
+	}
+	return h.storage
+}
+
+// atomic reports whether storage, Config.StorageV2 when set, implements
+// ContextCheckAndAdder or CheckAndAdder.
+func (h *Hashcash) atomic() bool {
+	switch h.backend().(type) {
+	case ContextCheckAndAdder, CheckAndAdder:
+		return true
+	}
+	return false
+}
+
+// checkAndAdd checks and adds key, for a header created at created, to
+// storage, Config.StorageV2 when set, in one atomic operation, reporting
+// whether it was already spent. ok is false if storage implements neither
+// ContextCheckAndAdder nor CheckAndAdder.
+func (h *Hashcash) checkAndAdd(ctx context.Context, key string, created time.Time) (alreadySpent, ok bool, err error) {
+	switch ca := h.backend().(type) {
+	case ContextCheckAndAdder:
+		alreadySpent, err = ca.CheckAndAddContext(ctx, key, created)
+	case CheckAndAdder:
+		alreadySpent, err = ca.CheckAndAdd(key)
+	default:
+		return false, false, nil
+	}
+	return alreadySpent, true, storageError(err)
+}
+
+// isSpent checks if key is in storage, Config.StorageV2 when set.
+func (h *Hashcash) isSpent(ctx context.Context, key string) (bool, error) {
+	if h.store == nil {
+		return spent(ctx, h.storage, key), nil
+	}
+	isSpent, err := h.store.Spent(ctx, key)
+	return isSpent, storageError(err)
+}
+
+// record adds key, for a header created at created, to storage,
+// Config.StorageV2 when set.
+func (h *Hashcash) record(ctx context.Context, key string, created time.Time) error {
+	if h.store == nil {
+		return storageError(add(ctx, h.storage, key, created))
+	}
+	var expires time.Time
+	if !h.expired.IsZero() || h.expiryWindow > 0 {
+		expires = created.Add(h.window)
+	}
+	return storageError(h.store.Add(ctx, key, expires))
+}
@@ -0,0 +1,236 @@
+/*
+Package bolt implements hashcash spent storage in a bbolt database, an
+embedded key/value store, for crash-safe double-spend protection in single
+binary deployments without a database server.
+
+Entries are kept in a bucket keyed by hash, valued with the date the header
+was created and the time it was spent. Every add is committed to disk before
+it returns, so spent headers are not forgotten after a crash:
+
+	storage, err := bolt.Open("spent.db", nil)
+	...
+	defer storage.Close()
+	// periodically drop entries of headers which have expired
+	storage.PurgeExpired(time.Now().AddDate(0, 0, -28))
+*/
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// valueSize size of an entry value: the created date and the time it was
+// added, in Unix seconds
+const valueSize = 16
+
+// Config for bolt storage
+type Config struct {
+	// Bucket name of the bucket entries are kept in, "spent" when empty.
+	Bucket string
+	// Timeout how long Open waits for the file lock held by another process,
+	// forever when zero.
+	Timeout time.Duration
+	// NoSync when set, commits are not fsynced. It is faster but entries
+	// added shortly before a crash may be lost.
+	NoSync bool
+}
+
+// Storage spent storage in a bbolt database. It is safe for concurrent use.
+type Storage struct {
+	db     *bbolt.DB
+	bucket []byte
+	owned  bool
+}
+
+// Open opens the bbolt database at path, creating it and the bucket if they
+// do not exist. If config is nil the defaults are used.
+func Open(path string, config *Config) (*Storage, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: config.Timeout, NoSync: config.NoSync})
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db, config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.owned = true
+	return s, nil
+}
+
+// New creates storage in db, an open database shared with the application,
+// creating the bucket if it does not exist. If config is nil the defaults
+// are used.
+func New(db *bbolt.DB, config *Config) (*Storage, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	name := config.Bucket
+	if name == "" {
+		name = "spent"
+	}
+	s := &Storage{db: db, bucket: []byte(name)}
+	return s, db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		return err
+	})
+}
+
+// Close closes the database if it was opened by Open.
+func (s *Storage) Close() error {
+	if !s.owned {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Add adds a hashcash entry, dated now as the header is not known.
+func (s *Storage) Add(hash string) error {
+	return s.AddDate(context.Background(), hash, time.Now())
+}
+
+// Spent checks if a hashcash entry exists. Entries are reported as not spent
+// if the database cannot be read.
+func (s *Storage) Spent(hash string) bool {
+	var found bool
+	s.db.View(func(tx *bbolt.Tx) error {
+		found = tx.Bucket(s.bucket).Get([]byte(hash)) != nil
+		return nil
+	})
+	return found
+}
+
+// AddDate adds a hashcash entry for a header created at created. Concurrent
+// adds are committed together.
+func (s *Storage) AddDate(ctx context.Context, hash string, created time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var value [valueSize]byte
+	binary.BigEndian.PutUint64(value[:8], uint64(created.Unix()))
+	binary.BigEndian.PutUint64(value[8:], uint64(time.Now().Unix()))
+	return s.db.Batch(func(tx *bbolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(hash), value[:])
+	})
+}
+
+// CheckAndAdd adds a hashcash entry, dated now, unless it exists, in a single
+// transaction, reporting whether it did.
+func (s *Storage) CheckAndAdd(hash string) (bool, error) {
+	return s.CheckAndAddContext(context.Background(), hash, time.Now())
+}
+
+// CheckAndAddContext adds a hashcash entry for a header created at created
+// unless it exists, in a single transaction, reporting whether it did.
+func (s *Storage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	var (
+		spent bool
+		value [valueSize]byte
+	)
+	binary.BigEndian.PutUint64(value[:8], uint64(created.Unix()))
+	binary.BigEndian.PutUint64(value[8:], uint64(time.Now().Unix()))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if spent = b.Get([]byte(hash)) != nil; spent {
+			return nil
+		}
+		return b.Put([]byte(hash), value[:])
+	})
+	return spent, err
+}
+
+// Lookup returns when a hashcash entry was added
+func (s *Storage) Lookup(hash string) (hashcash.SpentInfo, bool, error) {
+	var (
+		info  hashcash.SpentInfo
+		found bool
+	)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(s.bucket).Get([]byte(hash))
+		if len(value) != valueSize {
+			return nil
+		}
+		info = hashcash.SpentInfo{Key: hash, Added: time.Unix(int64(binary.BigEndian.Uint64(value[8:])), 0)}
+		found = true
+		return nil
+	})
+	return info, found, err
+}
+
+// Created returns the date the header of a hashcash entry was created.
+func (s *Storage) Created(hash string) (time.Time, bool, error) {
+	var (
+		created time.Time
+		found   bool
+	)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(s.bucket).Get([]byte(hash))
+		if len(value) != valueSize {
+			return nil
+		}
+		created, found = time.Unix(int64(binary.BigEndian.Uint64(value[:8])), 0), true
+		return nil
+	})
+	return created, found, err
+}
+
+// Remove removes a hashcash entry
+func (s *Storage) Remove(hash string) error {
+	return s.PurgeSingle(hash)
+}
+
+// PurgeExpired removes entries of headers created before t, e.g. the expiry
+// time of headers. Headers created before t are rejected as expired, so
+// their entries are no longer needed.
+func (s *Storage) PurgeExpired(t time.Time) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		var (
+			b       = tx.Bucket(s.bucket)
+			expired [][]byte
+		)
+		err := b.ForEach(func(k, v []byte) error {
+			if len(v) != valueSize || int64(binary.BigEndian.Uint64(v[:8])) < t.Unix() {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeSingle removes a hashcash entry
+func (s *Storage) PurgeSingle(hash string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(hash))
+	})
+}
+
+// PurgeAll removes every entry
+func (s *Storage) PurgeAll() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(s.bucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(s.bucket)
+		return err
+	})
+}
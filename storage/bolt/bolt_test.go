@@ -0,0 +1,90 @@
+package bolt_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/bolt"
+)
+
+func TestStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spent.db")
+	storage, err := bolt.Open(path, &bolt.Config{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hc, err := hashcash.New(
+		&hashcash.Resource{
+			Data:          "someone@gmail.com",
+			ValidatorFunc: func(string) bool { return true },
+		},
+		&hashcash.Config{
+			Bits:    8,
+			Future:  time.Now().AddDate(0, 0, 2),
+			Expired: time.Now().AddDate(0, 0, -30),
+			Storage: storage,
+		},
+	)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.Compute()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if valid, err := hc.Verify(stamp); !valid {
+		t.Errorf("%v\n", err)
+	}
+	key, err := hashcash.SpentKey(stamp)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	created, ok, err := storage.Created(key)
+	if err != nil || !ok || time.Since(created) > time.Minute {
+		t.Errorf("created %v %v: %v\n", created, ok, err)
+	}
+	// entries survive reopening the database
+	if err := storage.Close(); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	storage, err = bolt.Open(path, nil)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer storage.Close()
+	if !storage.Spent(key) {
+		t.Errorf("%s not spent after reopening\n", key)
+	}
+	if _, ok, err := storage.Lookup(key); !ok {
+		t.Errorf("%s not found: %v\n", key, err)
+	}
+	if err := storage.Add("old"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := storage.PurgeExpired(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !storage.Spent(key) || !storage.Spent("old") {
+		t.Errorf("current entries purged\n")
+	}
+	if err := storage.PurgeExpired(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if storage.Spent(key) || storage.Spent("old") {
+		t.Errorf("expired entries not purged\n")
+	}
+	if spent, err := storage.CheckAndAdd("new"); spent || err != nil {
+		t.Errorf("new not added: %v\n", err)
+	}
+	if spent, err := storage.CheckAndAdd("new"); !spent || err != nil {
+		t.Errorf("new added again: %v\n", err)
+	}
+	if err := storage.PurgeAll(); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if storage.Spent("new") {
+		t.Errorf("entry not purged\n")
+	}
+}
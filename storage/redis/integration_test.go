@@ -0,0 +1,79 @@
+//go:build integration
+
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/umahmood/hashcash/storage/redis"
+)
+
+// startRedis starts a Redis container, returning its address.
+func startRedis(t *testing.T) string {
+	ctx := context.Background()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "redis:7-alpine",
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForListeningPort("6379/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	t.Cleanup(func() { c.Terminate(ctx) })
+	host, err := c.Host(ctx)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	port, err := c.MappedPort(ctx, "6379/tcp")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	return fmt.Sprintf("%s:%s", host, port.Port())
+}
+
+func TestIntegration(t *testing.T) {
+	storage, err := redis.New(&redis.Config{
+		Addr:     startRedis(t),
+		TTL:      2 * time.Second,
+		PoolSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer storage.Close()
+	// more concurrent callers than pooled connections
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				hash := fmt.Sprintf("spent-%d-%d", i, j)
+				if err := storage.Add(hash); err != nil {
+					t.Errorf("%v\n", err)
+				}
+				if !storage.Spent(hash) {
+					t.Errorf("%s not spent\n", hash)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if storage.Spent("fresh") {
+		t.Errorf("fresh entry spent\n")
+	}
+	// entries expire with their TTL
+	time.Sleep(3 * time.Second)
+	if storage.Spent("spent-0-0") {
+		t.Errorf("entry not expired\n")
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Package redis implements hashcash spent storage in Redis, so several
+verification servers can share one double-spend database.
+
+Entries are set with SET NX and a TTL, which should cover the window in which
+headers are accepted, e.g. the 28 days before Config.Expired:
+
+	storage, err := redis.New(&redis.Config{
+		Addr: "localhost:6379",
+		TTL:  28 * 24 * time.Hour,
+	})
+
+The package speaks the Redis protocol directly and has no dependencies.
+*/
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrReply error Redis replied with an unexpected type
+	ErrReply = errors.New("redis: unexpected reply")
+
+	// ErrTTL error entries must be kept for a positive TTL
+	ErrTTL = errors.New("redis: TTL must be positive")
+)
+
+// Config for Redis storage
+type Config struct {
+	// Addr host:port of the Redis server.
+	Addr string
+	// Password optional password sent with AUTH.
+	Password string
+	// DB database selected with SELECT.
+	DB int
+	// Prefix prepended to entry keys, "hashcash:" when empty.
+	Prefix string
+	// TTL how long entries are kept, at least the window in which headers
+	// are accepted.
+	TTL time.Duration
+	// DialTimeout timeout for connecting, 5 seconds when zero.
+	DialTimeout time.Duration
+	// PoolSize idle connections kept for reuse, 10 when zero.
+	PoolSize int
+}
+
+// Storage spent storage in Redis. It is safe for concurrent use.
+type Storage struct {
+	config Config
+	idle   chan *conn
+}
+
+// conn a connection to the Redis server
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// New creates Redis storage, checking the server can be reached.
+func New(config *Config) (*Storage, error) {
+	if config.TTL <= 0 {
+		return nil, ErrTTL
+	}
+	s := &Storage{config: *config}
+	if s.config.Prefix == "" {
+		s.config.Prefix = "hashcash:"
+	}
+	if s.config.DialTimeout == 0 {
+		s.config.DialTimeout = 5 * time.Second
+	}
+	if s.config.PoolSize == 0 {
+		s.config.PoolSize = 10
+	}
+	s.idle = make(chan *conn, s.config.PoolSize)
+	if _, err := s.do(context.Background(), "PING"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add adds a hashcash entry
+func (s *Storage) Add(hash string) error {
+	return s.AddContext(context.Background(), hash)
+}
+
+// Spent checks if a hashcash entry exists
+func (s *Storage) Spent(hash string) bool {
+	return s.SpentContext(context.Background(), hash)
+}
+
+// AddContext adds a hashcash entry with SET NX, expiring after the TTL.
+func (s *Storage) AddContext(ctx context.Context, hash string) error {
+	ttl := strconv.FormatInt(s.config.TTL.Milliseconds(), 10)
+	_, err := s.do(ctx, "SET", s.config.Prefix+hash, "1", "NX", "PX", ttl)
+	return err
+}
+
+// CheckAndAdd adds a hashcash entry unless it exists, in a single SET NX,
+// reporting whether it did.
+func (s *Storage) CheckAndAdd(hash string) (bool, error) {
+	return s.CheckAndAddContext(context.Background(), hash, time.Now())
+}
+
+// CheckAndAddContext adds a hashcash entry unless it exists, in a single SET
+// NX, reporting whether it did. Entries expire after the TTL, created is not
+// recorded.
+func (s *Storage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	ttl := strconv.FormatInt(s.config.TTL.Milliseconds(), 10)
+	reply, err := s.do(ctx, "SET", s.config.Prefix+hash, "1", "NX", "PX", ttl)
+	if err != nil {
+		return false, err
+	}
+	return reply == nil, nil
+}
+
+// SpentContext checks if a hashcash entry exists. Entries are reported as
+// not spent if the server cannot be reached.
+func (s *Storage) SpentContext(ctx context.Context, hash string) bool {
+	n, err := s.do(ctx, "EXISTS", s.config.Prefix+hash)
+	return err == nil && n == int64(1)
+}
+
+// acquireScript sets the lease key to the holder for the TTL, unless
+// another holder has it.
+const acquireScript = `local v = redis.call("GET", KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`
+
+// releaseScript deletes the lease key if the holder has it.
+const releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+// AcquireLease acquires lease name for holder for ttl, or renews it, in a
+// single EVAL, so verifiers sharing the server elect one to run maintenance.
+// Leases are kept under the prefix followed by "lease:".
+func (s *Storage) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	ms := strconv.FormatInt(ttl.Milliseconds(), 10)
+	n, err := s.do(context.Background(), "EVAL", acquireScript, "1", s.config.Prefix+"lease:"+name, holder, ms)
+	if err != nil {
+		return false, err
+	}
+	return n == int64(1), nil
+}
+
+// ReleaseLease releases lease name if holder holds it.
+func (s *Storage) ReleaseLease(name, holder string) error {
+	_, err := s.do(context.Background(), "EVAL", releaseScript, "1", s.config.Prefix+"lease:"+name, holder)
+	return err
+}
+
+// Close closes idle connections.
+func (s *Storage) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command, returning its reply. Connections are reused unless
+// the command failed with a network error.
+func (s *Storage) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	reply, err := c.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+// get returns an idle connection, or dials a new one.
+func (s *Storage) get(ctx context.Context) (*conn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: s.config.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", s.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	if s.config.Password != "" {
+		if _, err := c.do("AUTH", s.config.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.config.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisError error reply from the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do writes a command as an array of bulk strings and reads its reply.
+func (c *conn) do(args ...string) (interface{}, error) {
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads a reply. Simple strings and bulk strings are returned as
+// strings, a nil bulk string as nil, integers as int64 and arrays as
+// []interface{}.
+func (c *conn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrReply
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, ErrReply
+}
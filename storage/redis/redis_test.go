@@ -0,0 +1,234 @@
+package redis_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/redis"
+)
+
+// server fake Redis server supporting the commands used by the storage
+type server struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	keys    map[string]time.Time
+	values  map[string]string
+	pass    string
+	clients int
+}
+
+func newServer(t *testing.T, pass string) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	s := &server{ln: ln, keys: make(map[string]time.Time), values: make(map[string]string), pass: pass}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// stats returns the keys set and the number of connections accepted.
+func (s *server) stats() (map[string]time.Time, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make(map[string]time.Time, len(s.keys))
+	for k, v := range s.keys {
+		keys[k] = v
+	}
+	return keys, s.clients
+}
+
+func (s *server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.clients++
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func (s *server) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := s.pass == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.exec(args, &authed)
+		s.mu.Unlock()
+		c.Write([]byte(reply))
+	}
+}
+
+func (s *server) exec(args []string, authed *bool) string {
+	cmd := strings.ToUpper(args[0])
+	if cmd == "AUTH" {
+		if args[1] != s.pass {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	}
+	if !*authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SET":
+		if exp, ok := s.keys[args[1]]; ok && time.Now().Before(exp) {
+			return "$-1\r\n"
+		}
+		ms, _ := strconv.Atoi(args[5])
+		s.keys[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "EVAL":
+		// the lease scripts, acquire is passed the TTL
+		key, holder := args[3], args[4]
+		v, held := s.values[key]
+		held = held && time.Now().Before(s.keys[key])
+		if len(args) == 6 {
+			if held && v != holder {
+				return ":0\r\n"
+			}
+			ms, _ := strconv.Atoi(args[5])
+			s.keys[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			s.values[key] = holder
+			return ":1\r\n"
+		}
+		if held && v == holder {
+			delete(s.keys, key)
+			delete(s.values, key)
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "EXISTS":
+		if exp, ok := s.keys[args[1]]; ok && time.Now().Before(exp) {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+func TestStorage(t *testing.T) {
+	srv := newServer(t, "secret")
+	if _, err := redis.New(&redis.Config{Addr: srv.ln.Addr().String(), TTL: time.Hour}); err == nil {
+		t.Errorf("connected without password\n")
+	}
+	storage, err := redis.New(&redis.Config{
+		Addr:     srv.ln.Addr().String(),
+		Password: "secret",
+		TTL:      50 * time.Millisecond,
+		PoolSize: 1,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer storage.Close()
+	var _ hashcash.ContextSpender = storage
+	if storage.Spent("abc") {
+		t.Errorf("abc spent before it was added\n")
+	}
+	if err := storage.Add("abc"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !storage.Spent("abc") {
+		t.Errorf("abc not spent\n")
+	}
+	if spent, err := storage.CheckAndAdd("abc"); !spent || err != nil {
+		t.Errorf("abc added again: %v\n", err)
+	}
+	if spent, err := storage.CheckAndAdd("def"); spent || err != nil || !storage.Spent("def") {
+		t.Errorf("def not added: %v\n", err)
+	}
+	if keys, _ := srv.stats(); keys["hashcash:abc"].IsZero() {
+		t.Errorf("key not prefixed: %v\n", keys)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if storage.Spent("abc") {
+		t.Errorf("abc not expired\n")
+	}
+	// one rejected without a password, one reused for every command
+	if _, clients := srv.stats(); clients != 2 {
+		t.Errorf("%d connections, want 2\n", clients)
+	}
+	if _, err := redis.New(&redis.Config{Addr: srv.ln.Addr().String()}); err != redis.ErrTTL {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestLease(t *testing.T) {
+	srv := newServer(t, "")
+	storage, err := redis.New(&redis.Config{Addr: srv.ln.Addr().String(), TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer storage.Close()
+	var _ hashcash.Leaser = storage
+	if held, err := storage.AcquireLease("purge", "a", 50*time.Millisecond); !held || err != nil {
+		t.Fatalf("lease not acquired: %v\n", err)
+	}
+	if held, _ := storage.AcquireLease("purge", "b", time.Minute); held {
+		t.Errorf("lease acquired by second holder\n")
+	}
+	if held, _ := storage.AcquireLease("purge", "a", 50*time.Millisecond); !held {
+		t.Errorf("lease not renewed\n")
+	}
+	if keys, _ := srv.stats(); keys["hashcash:lease:purge"].IsZero() {
+		t.Errorf("lease key not prefixed: %v\n", keys)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if held, _ := storage.AcquireLease("purge", "b", time.Minute); !held {
+		t.Errorf("expired lease not acquired\n")
+	}
+	if err := storage.ReleaseLease("purge", "a"); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	if held, _ := storage.AcquireLease("purge", "a", time.Minute); held {
+		t.Errorf("lease released by former holder\n")
+	}
+	storage.ReleaseLease("purge", "b")
+	if held, _ := storage.AcquireLease("purge", "a", time.Minute); !held {
+		t.Errorf("released lease not acquired\n")
+	}
+}
@@ -0,0 +1,104 @@
+//go:build integration
+
+package sqldb_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/umahmood/hashcash/storage/sqldb"
+)
+
+// startPostgres starts a PostgreSQL container, returning an open database.
+func startPostgres(t *testing.T) *sql.DB {
+	ctx := context.Background()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:16-alpine",
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_USER":     "hashcash",
+				"POSTGRES_PASSWORD": "hashcash",
+				"POSTGRES_DB":       "hashcash",
+			},
+			WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	t.Cleanup(func() { c.Terminate(ctx) })
+	host, err := c.Host(ctx)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	port, err := c.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	dsn := fmt.Sprintf("postgres://hashcash:hashcash@%s:%s/hashcash?sslmode=disable", host, port.Port())
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestIntegration(t *testing.T) {
+	storage, err := sqldb.New(startPostgres(t), &sqldb.Config{Placeholder: sqldb.Dollar})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	// concurrent adds of one entry, the primary key admits exactly one
+	var (
+		wg    sync.WaitGroup
+		added int32
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if storage.Add("contended") == nil {
+				atomic.AddInt32(&added, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("contended entry added %d times\n", added)
+	}
+	for i := 0; i < 100; i++ {
+		if err := storage.Add(fmt.Sprintf("spent-%d", i)); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	if !storage.Spent("spent-99") || storage.Spent("fresh") {
+		t.Errorf("spent entries not found\n")
+	}
+	if info, ok, err := storage.Lookup("spent-0"); !ok || time.Since(info.Added) > time.Minute {
+		t.Errorf("lookup %+v %v: %v\n", info, ok, err)
+	}
+	// entries are purged once expired
+	if err := storage.PurgeExpired(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !storage.Spent("spent-0") {
+		t.Errorf("current entry purged\n")
+	}
+	if err := storage.PurgeExpired(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if storage.Spent("spent-0") || storage.Spent("contended") {
+		t.Errorf("expired entries not purged\n")
+	}
+}
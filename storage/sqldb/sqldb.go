@@ -0,0 +1,229 @@
+/*
+Package sqldb implements hashcash spent storage in any database/sql database,
+e.g. SQLite, PostgreSQL or MySQL, for durable double-spend protection without
+running Redis. The driver is imported by the application:
+
+	db, err := sql.Open("sqlite3", "spent.db")
+	...
+	storage, err := sqldb.New(db, nil)
+	...
+	// periodically drop entries older than the expiry window
+	storage.PurgeExpired(time.Now().AddDate(0, 0, -28))
+*/
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// ErrTable error table name is not a valid identifier
+var ErrTable = errors.New("sqldb: invalid table name")
+
+// identifier matches table names safe to use unquoted
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Placeholder style of query parameters used by a driver
+type Placeholder int
+
+const (
+	// Question parameters are written ?, e.g. SQLite and MySQL.
+	Question Placeholder = iota
+	// Dollar parameters are written $1, $2..., e.g. PostgreSQL.
+	Dollar
+)
+
+// Config for database storage
+type Config struct {
+	// Table name of the table entries are kept in, "spent" when empty.
+	Table string
+	// Placeholder parameter style of the driver.
+	Placeholder Placeholder
+	// SkipSchema when set the tables and index are not created, e.g. when
+	// the schema is managed by migrations.
+	SkipSchema bool
+}
+
+// Storage spent storage in a database/sql database. It is safe for
+// concurrent use.
+type Storage struct {
+	db      *sql.DB
+	queries queries
+}
+
+// queries statements used by the storage
+type queries struct {
+	add, spent, lookup, remove, purgeExpired, purgeAll string
+	renewLease, insertLease, leaseHolder, releaseLease string
+}
+
+// New creates database storage using db, creating the table and its indexes
+// if they do not exist. If config is nil the defaults are used.
+func New(db *sql.DB, config *Config) (*Storage, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	table := config.Table
+	if table == "" {
+		table = "spent"
+	}
+	if !identifier.MatchString(table) {
+		return nil, ErrTable
+	}
+	param := func(n int) string {
+		if config.Placeholder == Dollar {
+			return fmt.Sprintf("$%d", n)
+		}
+		return "?"
+	}
+	s := &Storage{
+		db: db,
+		queries: queries{
+			add:          fmt.Sprintf("INSERT INTO %s (hash, added) VALUES (%s, %s)", table, param(1), param(2)),
+			spent:        fmt.Sprintf("SELECT 1 FROM %s WHERE hash = %s", table, param(1)),
+			lookup:       fmt.Sprintf("SELECT added FROM %s WHERE hash = %s", table, param(1)),
+			remove:       fmt.Sprintf("DELETE FROM %s WHERE hash = %s", table, param(1)),
+			purgeExpired: fmt.Sprintf("DELETE FROM %s WHERE added < %s", table, param(1)),
+			purgeAll:     fmt.Sprintf("DELETE FROM %s", table),
+			renewLease:   fmt.Sprintf("UPDATE %s_lease SET holder = %s, expires = %s WHERE name = %s AND (holder = %s OR expires < %s)", table, param(1), param(2), param(3), param(4), param(5)),
+			insertLease:  fmt.Sprintf("INSERT INTO %s_lease (name, holder, expires) VALUES (%s, %s, %s)", table, param(1), param(2), param(3)),
+			leaseHolder:  fmt.Sprintf("SELECT holder FROM %s_lease WHERE name = %s", table, param(1)),
+			releaseLease: fmt.Sprintf("DELETE FROM %s_lease WHERE name = %s AND holder = %s", table, param(1), param(2)),
+		},
+	}
+	if config.SkipSchema {
+		return s, nil
+	}
+	// the primary key indexes the hash column, added is indexed for purges.
+	// Leases are kept in a table of their own, expires in Unix milliseconds.
+	schema := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (hash VARCHAR(255) NOT NULL PRIMARY KEY, added BIGINT NOT NULL)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_added ON %s (added)", table, table),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_lease (name VARCHAR(255) NOT NULL PRIMARY KEY, holder VARCHAR(255) NOT NULL, expires BIGINT NOT NULL)", table),
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add adds a hashcash entry
+func (s *Storage) Add(hash string) error {
+	return s.AddContext(context.Background(), hash)
+}
+
+// Spent checks if a hashcash entry exists
+func (s *Storage) Spent(hash string) bool {
+	return s.SpentContext(context.Background(), hash)
+}
+
+// AddContext adds a hashcash entry, recording when it was added.
+func (s *Storage) AddContext(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(ctx, s.queries.add, hash, time.Now().Unix())
+	return err
+}
+
+// CheckAndAdd adds a hashcash entry unless it exists, reporting whether it
+// did, see CheckAndAddContext.
+func (s *Storage) CheckAndAdd(hash string) (bool, error) {
+	return s.CheckAndAddContext(context.Background(), hash, time.Now())
+}
+
+// CheckAndAddContext adds a hashcash entry unless it exists, reporting
+// whether it did. The primary key lets a single insert of an entry succeed,
+// an insert failing for an existing entry reports it spent. Entries are dated
+// when added, created is not recorded.
+func (s *Storage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	_, err := s.db.ExecContext(ctx, s.queries.add, hash, time.Now().Unix())
+	if err == nil {
+		return false, nil
+	}
+	var one int
+	if s.db.QueryRowContext(ctx, s.queries.spent, hash).Scan(&one) == nil {
+		return true, nil
+	}
+	return false, err
+}
+
+// SpentContext checks if a hashcash entry exists. Entries are reported as
+// not spent if the database cannot be queried.
+func (s *Storage) SpentContext(ctx context.Context, hash string) bool {
+	var one int
+	return s.db.QueryRowContext(ctx, s.queries.spent, hash).Scan(&one) == nil
+}
+
+// Lookup returns when a hashcash entry was added
+func (s *Storage) Lookup(hash string) (hashcash.SpentInfo, bool, error) {
+	var added int64
+	err := s.db.QueryRow(s.queries.lookup, hash).Scan(&added)
+	if err == sql.ErrNoRows {
+		return hashcash.SpentInfo{}, false, nil
+	}
+	if err != nil {
+		return hashcash.SpentInfo{}, false, err
+	}
+	return hashcash.SpentInfo{Key: hash, Added: time.Unix(added, 0)}, true, nil
+}
+
+// Remove removes a hashcash entry
+func (s *Storage) Remove(hash string) error {
+	return s.PurgeSingle(hash)
+}
+
+// PurgeExpired removes entries added before t, e.g. the expiry time of
+// headers.
+func (s *Storage) PurgeExpired(t time.Time) error {
+	_, err := s.db.Exec(s.queries.purgeExpired, t.Unix())
+	return err
+}
+
+// PurgeSingle removes a hashcash entry
+func (s *Storage) PurgeSingle(hash string) error {
+	_, err := s.db.Exec(s.queries.remove, hash)
+	return err
+}
+
+// PurgeAll removes every entry
+func (s *Storage) PurgeAll() error {
+	_, err := s.db.Exec(s.queries.purgeAll)
+	return err
+}
+
+// AcquireLease acquires lease name for holder for ttl, or renews it, so
+// verifiers sharing the database elect one to run maintenance. An expired or
+// held lease is updated in place, otherwise it is inserted, the primary key
+// ensuring only one of several racing holders succeeds.
+func (s *Storage) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	expires := now.Add(ttl).UnixMilli()
+	res, err := s.db.Exec(s.queries.renewLease, holder, expires, name, holder, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err == nil, err
+	}
+	if _, err := s.db.Exec(s.queries.insertLease, name, holder, expires); err != nil {
+		// another holder has the lease, or inserted it first
+		var current string
+		if s.db.QueryRow(s.queries.leaseHolder, name).Scan(&current) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease releases lease name if holder holds it.
+func (s *Storage) ReleaseLease(name, holder string) error {
+	_, err := s.db.Exec(s.queries.releaseLease, name, holder)
+	return err
+}
@@ -0,0 +1,198 @@
+package sqldb_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/sqldb"
+)
+
+// fakeDriver in memory database understanding the statements of the storage
+type fakeDriver struct {
+	mu      sync.Mutex
+	rows    map[string]int64
+	leases  map[string]fakeLease
+	queries []string
+}
+
+// fakeLease row of the lease table
+type fakeLease struct {
+	holder  string
+	expires int64
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.d, query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "UPDATE"):
+		name, holder := args[2].(string), args[3].(string)
+		l, ok := d.leases[name]
+		if !ok || (l.holder != holder && l.expires >= args[4].(int64)) {
+			return driver.RowsAffected(0), nil
+		}
+		d.leases[name] = fakeLease{holder: args[0].(string), expires: args[1].(int64)}
+	case strings.Contains(s.query, "_lease (name"):
+		name := args[0].(string)
+		if _, ok := d.leases[name]; ok {
+			return nil, errors.New("UNIQUE constraint failed")
+		}
+		d.leases[name] = fakeLease{holder: args[1].(string), expires: args[2].(int64)}
+	case strings.Contains(s.query, "_lease WHERE"):
+		if l, ok := d.leases[args[0].(string)]; ok && l.holder == args[1].(string) {
+			delete(d.leases, args[0].(string))
+		}
+	case strings.HasPrefix(s.query, "INSERT"):
+		hash := args[0].(string)
+		if _, ok := d.rows[hash]; ok {
+			return nil, errors.New("UNIQUE constraint failed")
+		}
+		d.rows[hash] = args[1].(int64)
+	case strings.Contains(s.query, "WHERE hash"):
+		delete(d.rows, args[0].(string))
+	case strings.Contains(s.query, "WHERE added <"):
+		for hash, added := range d.rows {
+			if added < args[0].(int64) {
+				delete(d.rows, hash)
+			}
+		}
+	case strings.HasPrefix(s.query, "DELETE"):
+		d.rows = make(map[string]int64)
+	default:
+		return nil, errors.New("unexpected statement " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	if strings.HasPrefix(s.query, "SELECT holder") {
+		l, ok := d.leases[args[0].(string)]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{values: []driver.Value{l.holder}}, nil
+	}
+	added, ok := d.rows[args[0].(string)]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	if strings.HasPrefix(s.query, "SELECT 1") {
+		added = 1
+	}
+	return &fakeRows{values: []driver.Value{added}}, nil
+}
+
+type fakeRows struct{ values []driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], nil
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	fake := &fakeDriver{rows: make(map[string]int64), leases: make(map[string]fakeLease)}
+	sql.Register("fake", fake)
+	db, err := sql.Open("fake", "")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := sqldb.New(db, &sqldb.Config{Table: "spent; DROP TABLE users"}); err != sqldb.ErrTable {
+		t.Errorf("%v\n", err)
+	}
+	storage, err := sqldb.New(db, &sqldb.Config{Table: "stamps", Placeholder: sqldb.Dollar})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var (
+		_ hashcash.Purger         = storage
+		_ hashcash.Admin          = storage
+		_ hashcash.ContextSpender = storage
+		_ hashcash.Leaser         = storage
+	)
+	if !strings.Contains(fake.queries[1], "CREATE INDEX IF NOT EXISTS stamps_added ON stamps") {
+		t.Errorf("schema %q\n", fake.queries)
+	}
+	if storage.Spent("abc") {
+		t.Errorf("abc spent before it was added\n")
+	}
+	if err := storage.Add("abc"); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if !storage.Spent("abc") {
+		t.Errorf("abc not spent\n")
+	}
+	if !strings.Contains(fake.queries[len(fake.queries)-1], "hash = $1") {
+		t.Errorf("placeholder %q\n", fake.queries[len(fake.queries)-1])
+	}
+	info, ok, err := storage.Lookup("abc")
+	if err != nil || !ok || time.Since(info.Added) > time.Minute {
+		t.Errorf("lookup %+v %v: %v\n", info, ok, err)
+	}
+	if err := storage.PurgeExpired(time.Now().Add(-time.Hour)); err != nil || !storage.Spent("abc") {
+		t.Errorf("recent entry purged: %v\n", err)
+	}
+	if err := storage.PurgeExpired(time.Now().Add(time.Hour)); err != nil || storage.Spent("abc") {
+		t.Errorf("expired entry not purged: %v\n", err)
+	}
+	storage.Add("def")
+	if err := storage.Remove("def"); err != nil || storage.Spent("def") {
+		t.Errorf("entry not removed: %v\n", err)
+	}
+	if held, err := storage.AcquireLease("purge", "a", time.Minute); !held || err != nil {
+		t.Fatalf("lease not acquired: %v\n", err)
+	}
+	if held, err := storage.AcquireLease("purge", "b", time.Minute); held || err != nil {
+		t.Errorf("lease acquired by second holder: %v\n", err)
+	}
+	if held, _ := storage.AcquireLease("purge", "a", -time.Minute); !held {
+		t.Errorf("lease not renewed\n")
+	}
+	if held, _ := storage.AcquireLease("purge", "b", time.Minute); !held {
+		t.Errorf("expired lease not acquired\n")
+	}
+	storage.ReleaseLease("purge", "a")
+	if held, _ := storage.AcquireLease("purge", "a", time.Minute); held {
+		t.Errorf("lease released by former holder\n")
+	}
+	storage.ReleaseLease("purge", "b")
+	if held, _ := storage.AcquireLease("purge", "a", time.Minute); !held {
+		t.Errorf("released lease not acquired\n")
+	}
+}
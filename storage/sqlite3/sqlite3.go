@@ -0,0 +1,302 @@
+/*
+Package sqlite3 implements hashcash spent storage in a sqlite3 database, the
+default storage of earlier versions of hashcash, kept in its own package so
+the core package has no cgo or third party dependencies:
+
+	storage, err := sqlite3.OpenDefault() // ~/.hashcash/spent.db
+	...
+	hc, err := hashcash.New(res, &hashcash.Config{Storage: storage, ...})
+
+Entries are unique, so headers are checked and recorded atomically, and
+databases created without the unique index are migrated when opened,
+dropping duplicate entries.
+*/
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/umahmood/hashcash"
+)
+
+const (
+	sqlCreateTable = "CREATE TABLE IF NOT EXISTS spent (creation_date TEXT NOT NULL, hashcash TEXT NOT NULL);"
+	sqlCreateIndex = "CREATE UNIQUE INDEX IF NOT EXISTS spent_hashcash ON spent (hashcash);"
+	sqlHasIndex    = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'spent_hashcash';"
+	sqlDedupe      = "DELETE FROM spent WHERE rowid NOT IN (SELECT MIN(rowid) FROM spent GROUP BY hashcash);"
+	sqlAddHash     = "INSERT OR IGNORE INTO spent VALUES (DATETIME('now', 'localtime'), ?);"
+	sqlHashExists  = "SELECT hashcash FROM spent WHERE hashcash = ?;"
+	sqlHashLookup  = "SELECT creation_date FROM spent WHERE hashcash = ?;"
+	sqlHashRemove  = "DELETE FROM spent WHERE hashcash = ?;"
+	sqlHashRecent  = "SELECT hashcash, creation_date FROM spent WHERE creation_date >= ? ORDER BY creation_date;"
+	sqlHashBatch   = "SELECT hashcash FROM spent WHERE hashcash IN (%s);"
+	sqlTimeFormat  = "2006-01-02 15:04:05"
+	sqlBatchSize   = 500 // Max hashes per IN query, below sqlite's variable limit
+)
+
+// Storage spent storage in a sqlite3 database
+type Storage struct {
+	name string
+}
+
+// Add a new hashcash entry to the database, entries already present are
+// kept
+func (d *Storage) Add(hash string) error {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(sqlAddHash, hash)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Spent checks if a hashcash entry already exists in the database
+func (d *Storage) Spent(hash string) bool {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	var s string
+	return db.QueryRow(sqlHashExists, hash).Scan(&s) == nil
+}
+
+// CheckAndAdd adds a hashcash entry to the database unless it exists,
+// reporting whether it did, see CheckAndAddContext
+func (d *Storage) CheckAndAdd(hash string) (bool, error) {
+	return d.CheckAndAddContext(context.Background(), hash, time.Now())
+}
+
+// CheckAndAddContext adds a hashcash entry to the database unless it exists,
+// reporting whether it did, in a single statement relying on the unique
+// index of entries. Entries are dated when added, created is not recorded
+func (d *Storage) CheckAndAddContext(ctx context.Context, hash string, created time.Time) (bool, error) {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, sqlAddHash, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+// SpentBatch checks which hashcash entries exist in the database, using one
+// query per sqlBatchSize entries
+func (d *Storage) SpentBatch(hashes []string) ([]bool, error) {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	found := make(map[string]bool, len(hashes))
+	for start := 0; start < len(hashes); start += sqlBatchSize {
+		end := start + sqlBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, hash := range hashes[start:end] {
+			args = append(args, hash)
+		}
+		query := fmt.Sprintf(sqlHashBatch, strings.TrimSuffix(strings.Repeat("?,", len(args)), ","))
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[s] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	isSpent := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		isSpent[i] = found[hash]
+	}
+	return isSpent, nil
+}
+
+// Lookup returns when a hashcash entry was added to the database
+func (d *Storage) Lookup(hash string) (hashcash.SpentInfo, bool, error) {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return hashcash.SpentInfo{}, false, err
+	}
+	defer db.Close()
+	var created string
+	err = db.QueryRow(sqlHashLookup, hash).Scan(&created)
+	if err == sql.ErrNoRows {
+		return hashcash.SpentInfo{}, false, nil
+	}
+	if err != nil {
+		return hashcash.SpentInfo{}, false, err
+	}
+	added, err := time.ParseInLocation(sqlTimeFormat, created, time.Local)
+	if err != nil {
+		return hashcash.SpentInfo{}, false, err
+	}
+	return hashcash.SpentInfo{Key: hash, Added: added}, true, nil
+}
+
+// Remove deletes a hashcash entry from the database
+func (d *Storage) Remove(hash string) error {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(sqlHashRemove, hash)
+	return err
+}
+
+// Recent calls fn with each entry added to the database since since, oldest
+// first
+func (d *Storage) Recent(since time.Time, fn func(hashcash.SpentInfo) error) error {
+	db, err := sql.Open("sqlite3", d.name)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(sqlHashRecent, since.In(time.Local).Format(sqlTimeFormat))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash, created string
+		if err := rows.Scan(&hash, &created); err != nil {
+			return err
+		}
+		added, err := time.ParseInLocation(sqlTimeFormat, created, time.Local)
+		if err != nil {
+			return err
+		}
+		if err := fn(hashcash.SpentInfo{Key: hash, Added: added}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exists determines a path/file exists
+func exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return true, err
+}
+
+// createDBFile creates a new sqlite3 database file
+func createDBFile(path string) error {
+	_, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(sqlCreateTable)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrateDB adds the unique index of entries to a database created without
+// it, dropping duplicate entries recorded before, keeping the oldest
+func migrateDB(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(sqlHasIndex).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqlDedupe); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sqlCreateIndex); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// OpenDefault opens the database ~/.hashcash/spent.db, the default storage
+// of earlier versions of hashcash, creating it if it does not exist.
+func OpenDefault() (*Storage, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(u.HomeDir, ".hashcash")
+	created, err := exists(path)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		err := os.MkdirAll(path, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Open(filepath.Join(path, "spent.db"))
+}
+
+// Open opens the database at path, creating it if it does not exist, and
+// migrating it if it was created without the unique index of entries.
+func Open(path string) (*Storage, error) {
+	created, err := exists(path)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		err := createDBFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := migrateDB(path); err != nil {
+		return nil, err
+	}
+	return &Storage{name: path}, nil
+}
@@ -0,0 +1,54 @@
+package sqlite3_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/sqlite3"
+)
+
+var (
+	_ hashcash.ContextCheckAndAdder = (*sqlite3.Storage)(nil)
+	_ hashcash.Admin                = (*sqlite3.Storage)(nil)
+)
+
+func TestStorage(t *testing.T) {
+	storage, err := sqlite3.Open(filepath.Join(t.TempDir(), "spent.db"))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Accept: []string{"someone@gmail.com"}}, &hashcash.Config{
+		Bits:         8,
+		ExpiryWindow: time.Hour,
+		FutureWindow: time.Hour,
+		Storage:      storage,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(stamp); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.Verify(stamp); err != hashcash.ErrSpent {
+		t.Errorf("replayed stamp got %v\n", err)
+	}
+	if storage.Spent("other") {
+		t.Errorf("unknown entry reported spent\n")
+	}
+	if err := storage.Add("added"); err != nil || !storage.Spent("added") {
+		t.Errorf("added entry not reported spent: %v\n", err)
+	}
+	if spent, err := storage.CheckAndAdd("other"); spent || err != nil {
+		t.Errorf("first add got %v %v\n", spent, err)
+	}
+	if spent, err := storage.CheckAndAdd("other"); !spent || err != nil {
+		t.Errorf("second add got %v %v\n", spent, err)
+	}
+}
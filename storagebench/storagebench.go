@@ -0,0 +1,183 @@
+/*
+Package storagebench measures hashcash storage adapters under contention.
+
+Concurrent workers issue a mix of Add and Spent calls against a storage over
+a fixed key space, so adapters can be compared on measured throughput and
+latency:
+
+	result := storagebench.Run(storage, &storagebench.Config{
+		Workers:  32,
+		Ops:      100000,
+		AddRatio: 0.1,
+		Keys:     1 << 16,
+	})
+	storagebench.Report(os.Stdout, map[string]storagebench.Result{
+		"sqlite3": result,
+	})
+*/
+package storagebench
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// Config for a benchmark run
+type Config struct {
+	// Workers number of goroutines calling the storage concurrently.
+	Workers int
+	// Ops total number of operations across all workers.
+	Ops int
+	// AddRatio fraction of operations which are Add, the rest are Spent.
+	AddRatio float64
+	// Keys number of distinct keys operations are spread across. A small key
+	// space increases contention on the same entries.
+	Keys int
+}
+
+// DefaultConfig default benchmark configuration
+var DefaultConfig = &Config{
+	Workers:  16,
+	Ops:      10000,
+	AddRatio: 0.5,
+	Keys:     1000,
+}
+
+// Result measurements of a benchmark run
+type Result struct {
+	// Ops number of operations performed.
+	Ops int
+	// Errors number of Add calls which returned an error.
+	Errors int
+	// Duration wall clock time of the run.
+	Duration time.Duration
+	// Add latencies of Add calls.
+	Add Latency
+	// Spent latencies of Spent calls.
+	Spent Latency
+}
+
+// Throughput operations per second.
+func (r Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+// Latency percentiles of a kind of operation
+type Latency struct {
+	Count int
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Run benchmarks s according to config. If config is nil DefaultConfig is
+// used.
+func Run(s hashcash.Storage, config *Config) Result {
+	if config == nil {
+		config = DefaultConfig
+	}
+	var (
+		keys      = makeKeys(config.Keys)
+		remaining = int64(config.Ops)
+		errs      int64
+		mu        sync.Mutex
+		adds      []time.Duration
+		spents    []time.Duration
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < config.Workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			var (
+				rng       = rand.New(rand.NewSource(seed))
+				add, sp   []time.Duration
+				workerErr int64
+			)
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				key := keys[rng.Intn(len(keys))]
+				t := time.Now()
+				if rng.Float64() < config.AddRatio {
+					if err := s.Add(key); err != nil {
+						workerErr++
+					}
+					add = append(add, time.Since(t))
+				} else {
+					s.Spent(key)
+					sp = append(sp, time.Since(t))
+				}
+			}
+			mu.Lock()
+			adds = append(adds, add...)
+			spents = append(spents, sp...)
+			errs += workerErr
+			mu.Unlock()
+		}(int64(w))
+	}
+	wg.Wait()
+	return Result{
+		Ops:      len(adds) + len(spents),
+		Errors:   int(errs),
+		Duration: time.Since(start),
+		Add:      latency(adds),
+		Spent:    latency(spents),
+	}
+}
+
+// Report writes results, keyed by adapter name, as a table to w.
+func Report(w io.Writer, results map[string]Result) {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "%-12s %8s %7s %12s %10s %10s %10s %10s\n",
+		"storage", "ops", "errors", "ops/sec", "add p50", "add p99", "spent p50", "spent p99")
+	for _, name := range names {
+		r := results[name]
+		fmt.Fprintf(w, "%-12s %8d %7d %12.0f %10v %10v %10v %10v\n",
+			name, r.Ops, r.Errors, r.Throughput(),
+			r.Add.P50, r.Add.P99, r.Spent.P50, r.Spent.P99)
+	}
+}
+
+// makeKeys creates n keys in the format of spent storage keys.
+func makeKeys(n int) []string {
+	if n < 1 {
+		n = 1
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		sum := sha1.Sum([]byte(strconv.Itoa(i)))
+		keys[i] = hex.EncodeToString(sum[:])
+	}
+	return keys
+}
+
+// latency computes percentiles of d.
+func latency(d []time.Duration) Latency {
+	if len(d) == 0 {
+		return Latency{}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return Latency{
+		Count: len(d),
+		P50:   d[(len(d)-1)*50/100],
+		P99:   d[(len(d)-1)*99/100],
+		Max:   d[len(d)-1],
+	}
+}
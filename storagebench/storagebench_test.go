@@ -0,0 +1,125 @@
+package storagebench_test
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/storage/bolt"
+	"github.com/umahmood/hashcash/storage/redis"
+	"github.com/umahmood/hashcash/storage/sqldb"
+	"github.com/umahmood/hashcash/storage/sqlite3"
+	"github.com/umahmood/hashcash/storagebench"
+)
+
+// mapStorage storage safe for concurrent use
+type mapStorage struct {
+	mu    sync.Mutex
+	spent map[string]bool
+}
+
+func (m *mapStorage) Add(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spent[hash] = true
+	return nil
+}
+
+func (m *mapStorage) Spent(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.spent[hash]
+}
+
+// adapters storage adapters shipped with hashcash, plus an in memory map as
+// a baseline. Persistent adapters are kept in a temporary directory, Redis is
+// only included when HASHCASH_REDIS_ADDR is set.
+func adapters(tb testing.TB) map[string]hashcash.Storage {
+	dir := tb.TempDir()
+	s := map[string]hashcash.Storage{
+		"map":    &mapStorage{spent: make(map[string]bool)},
+		"memory": hashcash.NewMemoryStorage(nil),
+		"bloom": hashcash.NewBloomFilter(&hashcash.BloomFilterConfig{
+			Window:   time.Hour,
+			Capacity: 1 << 20,
+		}),
+	}
+	add := func(name string, storage hashcash.Storage, err error) {
+		if err != nil {
+			tb.Logf("skipping %s: %v", name, err)
+			return
+		}
+		if c, ok := storage.(io.Closer); ok {
+			tb.Cleanup(func() { c.Close() })
+		}
+		s[name] = storage
+	}
+	file, err := hashcash.NewFileStorage(filepath.Join(dir, "spent.log"), nil)
+	add("file", file, err)
+	db, err := sqlite3.Open(filepath.Join(dir, "spent.db"))
+	add("sqlite3", db, err)
+	bdb, err := bolt.Open(filepath.Join(dir, "spent.bolt"), nil)
+	add("bolt", bdb, err)
+	if sdb, err := sql.Open("sqlite3", filepath.Join(dir, "sqldb.db")); err != nil {
+		add("sqldb", nil, err)
+	} else {
+		tb.Cleanup(func() { sdb.Close() })
+		storage, err := sqldb.New(sdb, nil)
+		add("sqldb", storage, err)
+	}
+	if addr := os.Getenv("HASHCASH_REDIS_ADDR"); addr != "" {
+		storage, err := redis.New(&redis.Config{Addr: addr, Prefix: "storagebench:", TTL: time.Hour})
+		add("redis", storage, err)
+	}
+	return s
+}
+
+func TestRun(t *testing.T) {
+	storage := &mapStorage{spent: make(map[string]bool)}
+	result := storagebench.Run(storage, &storagebench.Config{
+		Workers:  8,
+		Ops:      1000,
+		AddRatio: 0.25,
+		Keys:     10,
+	})
+	if result.Ops != 1000 || result.Add.Count+result.Spent.Count != 1000 {
+		t.Errorf("ops %d add %d spent %d\n", result.Ops, result.Add.Count, result.Spent.Count)
+	}
+	if result.Add.Count == 0 || result.Spent.Count == 0 || len(storage.spent) > 10 {
+		t.Errorf("unexpected mix %+v\n", result)
+	}
+	var buf bytes.Buffer
+	storagebench.Report(&buf, map[string]storagebench.Result{"map": result})
+	if !strings.Contains(buf.String(), "map ") {
+		t.Errorf("%s\n", buf.String())
+	}
+}
+
+func BenchmarkStorage(b *testing.B) {
+	for name, s := range adapters(b) {
+		for _, ratio := range []float64{0.1, 0.5} {
+			for _, keys := range []int{100, 100000} {
+				b.Run(fmt.Sprintf("%s/add=%.1f/keys=%d", name, ratio, keys), func(b *testing.B) {
+					r := storagebench.Run(s, &storagebench.Config{
+						Workers:  16,
+						Ops:      b.N,
+						AddRatio: ratio,
+						Keys:     keys,
+					})
+					b.ReportMetric(r.Throughput(), "ops/s")
+					b.ReportMetric(float64(r.Add.P99.Nanoseconds()), "add-p99-ns")
+					b.ReportMetric(float64(r.Spent.P99.Nanoseconds()), "spent-p99-ns")
+				})
+			}
+		}
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
-	"fmt"
+	"hash"
 	"io"
+	"math/bits"
 	"strconv"
+	"sync"
 )
 
+// randSource source of random bytes read by randomBytes
+const randSource = "crypto/rand"
+
 // randomBytes reads n cryptographically secure pseudo-random numbers.
 func randomBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
@@ -24,17 +29,54 @@ func base64EncodeBytes(b []byte) string {
 	return base64.StdEncoding.EncodeToString(b)
 }
 
-// base64EncodeInt
-func base64EncodeInt(n int) string {
-	return base64EncodeBytes([]byte(strconv.Itoa(n)))
+// base64DecodeAny decodes s from either the standard or URL base64 alphabet,
+// with or without padding.
+func base64DecodeAny(s string) ([]byte, bool) {
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	}
+	for _, enc := range encodings {
+		b, err := enc.DecodeString(s)
+		if err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// base64EncodeUint
+func base64EncodeUint(n uint64) string {
+	return base64EncodeBytes([]byte(strconv.FormatUint(n, 10)))
 }
 
-// sha1Hash
-func sha1Hash(s string) string {
-	hash := sha1.New()
+// sha1Pool hashers reused between calls to sha1Sum
+var sha1Pool = sync.Pool{
+	New: func() interface{} { return sha1.New() },
+}
+
+// sha1Sum
+func sha1Sum(s string) []byte {
+	hash := sha1Pool.Get().(hash.Hash)
+	defer sha1Pool.Put(hash)
+	hash.Reset()
 	_, err := io.WriteString(hash, s)
 	if err != nil {
-		return ""
+		return nil
+	}
+	return hash.Sum(nil)
+}
+
+// leadingZeroBits counts the number of leading zero bits in b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil))
+	return n
 }
@@ -1,6 +1,10 @@
 package hashcash
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Semantic versioning - http://semver.org/
 const (
@@ -9,7 +13,65 @@ const (
 	Patch = 0
 )
 
+// stampVersions hashcash stamp format versions which can be minted and
+// verified, in order of preference.
+var stampVersions = []int{1}
+
 // Version returns library version.
 func Version() string {
 	return fmt.Sprintf("%d.%d.%d", Major, Minor, Patch)
 }
+
+// StampVersions returns the hashcash stamp format versions supported by the
+// library, in order of preference.
+func StampVersions() []int {
+	return append([]int(nil), stampVersions...)
+}
+
+// SupportsStampVersion reports whether stamps in format version v can be
+// minted and verified.
+func SupportsStampVersion(v int) bool {
+	for _, sv := range stampVersions {
+		if sv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// NegotiateStampVersion picks the most preferred stamp format version which
+// is supported by both the library and a peer supporting versions. If there is
+// no common version, false is returned.
+func NegotiateStampVersion(versions []int) (int, bool) {
+	for _, sv := range stampVersions {
+		for _, v := range versions {
+			if sv == v {
+				return sv, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// FormatStampVersions formats versions as a comma separated list, e.g. to
+// advertise StampVersions to peers.
+func FormatStampVersions(versions []int) string {
+	s := make([]string, len(versions))
+	for i, v := range versions {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// ParseStampVersions parses a comma separated list of stamp format versions
+// advertised by a peer, as formatted by FormatStampVersions, skipping entries
+// which are not versions.
+func ParseStampVersions(s string) []int {
+	var versions []int
+	for _, f := range strings.Split(s, ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,480 @@
+package hashcash
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MintProgress snapshot of an in-progress mint, as returned by
+// Hashcash.Progress.
+type MintProgress struct {
+	Resource string    `json:"resource"`
+	Bits     Bits      `json:"bits"`
+	Created  time.Time `json:"created"`
+	Rand     string    `json:"rand"`
+	Counter  uint64    `json:"counter"`
+}
+
+// Progress returns a snapshot of the search for a solution, which can be
+// saved and passed to Resume, e.g. after a restart, so completed work is not
+// discarded.
+func (h *Hashcash) Progress() MintProgress {
+	return MintProgress{
+		Resource: h.resource,
+		Bits:     h.bits,
+		Created:  h.created,
+		Rand:     h.rand,
+		Counter:  h.counter,
+	}
+}
+
+// Resume continues the search for a solution from p. If p was taken from an
+// instance minting a different resource or collision size
+// ErrProgressMismatch error is returned.
+func (h *Hashcash) Resume(p MintProgress) error {
+	if p.Resource != h.resource || p.Bits != h.bits {
+		return ErrProgressMismatch
+	}
+	h.created = p.Created
+	h.rand = p.Rand
+	h.counter = p.Counter
+	h.counterStart = p.Counter
+	return nil
+}
+
+// WalletConfig for a wallet
+type WalletConfig struct {
+	// Expiry age after which stamps and mint progress are evicted, as
+	// verifiers would reject them. Recommended expiry time is 28 days.
+	Expiry time.Duration
+	// Capacity maximum number of stamps held per resource, the oldest are
+	// evicted first. Zero is unlimited.
+	Capacity int
+}
+
+// DefaultWalletConfig default wallet configuration
+var DefaultWalletConfig = &WalletConfig{
+	Expiry: 28 * 24 * time.Hour,
+}
+
+// walletRecord a single line of a wallet file, holding either a stamp, mint
+// progress or the solve history of a bits level.
+type walletRecord struct {
+	Stamp   string        `json:"stamp,omitempty"`
+	Created time.Time     `json:"created,omitempty"`
+	Mint    *MintProgress `json:"mint,omitempty"`
+	Solves  *walletSolves `json:"solves,omitempty"`
+}
+
+// walletSolves work measured minting headers of a bits level
+type walletSolves struct {
+	Bits Bits `json:"bits"`
+	// Solved number of headers minted.
+	Solved int `json:"solved"`
+	// Attempts headers hashed and Seconds spent hashing them.
+	Attempts uint64  `json:"attempts"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// walletStamp pre-mined stamp held by a wallet
+type walletStamp struct {
+	header  string
+	created time.Time
+}
+
+// Wallet pre-mined stamps, in-progress mints and solve history of a client,
+// kept in a file so a restart does not discard completed work. Each record is written with
+// a checksum and the file is replaced atomically, when opened corrupt records
+// are dropped and the remaining ones kept. It is safe for concurrent use.
+type Wallet struct {
+	mu     sync.Mutex
+	path   string
+	config WalletConfig
+	stamps map[string][]walletStamp
+	mints  map[string]MintProgress
+	solves map[Bits]walletSolves
+	// Dropped number of corrupt records dropped when the wallet was opened.
+	Dropped int
+}
+
+// OpenWallet opens or creates the wallet file at path, evicting expired
+// stamps. If config is nil DefaultWalletConfig is used.
+func OpenWallet(path string, config *WalletConfig) (*Wallet, error) {
+	if config == nil {
+		config = DefaultWalletConfig
+	}
+	w := &Wallet{
+		path:   path,
+		config: *config,
+		stamps: make(map[string][]walletStamp),
+		mints:  make(map[string]MintProgress),
+		solves: make(map[Bits]walletSolves),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	w.evict()
+	return w, nil
+}
+
+// load reads the records of the wallet file, dropping corrupt ones.
+func (w *Wallet) load() error {
+	file, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rec, ok := parseWalletRecord(scanner.Text())
+		if !ok {
+			w.Dropped++
+			continue
+		}
+		if rec.Mint != nil {
+			w.mints[rec.Mint.Resource] = *rec.Mint
+			continue
+		}
+		if rec.Solves != nil {
+			w.solves[rec.Solves.Bits] = *rec.Solves
+			continue
+		}
+		w.add(rec.Stamp, rec.Created)
+	}
+	if err := scanner.Err(); err != nil {
+		// a torn final line longer than the scanner buffer.
+		w.Dropped++
+	}
+	return nil
+}
+
+// parseWalletRecord parses a wallet file line, ok is false if its checksum
+// does not match.
+func parseWalletRecord(line string) (rec walletRecord, ok bool) {
+	sum, data, found := strings.Cut(line, " ")
+	if !found || sum != fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(data))) {
+		return rec, false
+	}
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return rec, false
+	}
+	if rec.Mint == nil && rec.Solves == nil {
+		if _, err := scanHeader(rec.Stamp); err != nil {
+			return rec, false
+		}
+	}
+	return rec, true
+}
+
+// save writes the wallet to a temporary file and renames it over the wallet
+// file, so a crash leaves either the old or new contents.
+func (w *Wallet) save() error {
+	tmp := w.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	var records []walletRecord
+	for _, stamps := range w.stamps {
+		for _, st := range stamps {
+			records = append(records, walletRecord{Stamp: st.header, Created: st.created})
+		}
+	}
+	for _, p := range w.mints {
+		p := p
+		records = append(records, walletRecord{Mint: &p})
+	}
+	for _, solves := range w.solves {
+		solves := solves
+		records = append(records, walletRecord{Solves: &solves})
+	}
+	buf := bufio.NewWriter(file)
+	for _, rec := range records {
+		var data []byte
+		if data, err = json.Marshal(rec); err != nil {
+			break
+		}
+		if _, err = fmt.Fprintf(buf, "%08x %s\n", crc32.ChecksumIEEE(data), data); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, w.path)
+}
+
+// add adds a stamp, keeping stamps of a resource oldest first and evicting
+// the oldest beyond capacity.
+func (w *Wallet) add(header string, created time.Time) {
+	vals := strings.Split(header, ":")
+	resource := vals[3]
+	stamps := append(w.stamps[resource], walletStamp{header: header, created: created})
+	sort.SliceStable(stamps, func(i, j int) bool { return stamps[i].created.Before(stamps[j].created) })
+	if w.config.Capacity > 0 && len(stamps) > w.config.Capacity {
+		stamps = stamps[len(stamps)-w.config.Capacity:]
+	}
+	w.stamps[resource] = stamps
+}
+
+// evict removes expired stamps and mint progress, returning the number of
+// stamps removed.
+func (w *Wallet) evict() int {
+	if w.config.Expiry <= 0 {
+		return 0
+	}
+	var (
+		cutoff  = time.Now().Add(-w.config.Expiry)
+		evicted int
+	)
+	for resource, stamps := range w.stamps {
+		i := sort.Search(len(stamps), func(i int) bool { return !stamps[i].created.Before(cutoff) })
+		evicted += i
+		if i == len(stamps) {
+			delete(w.stamps, resource)
+		} else {
+			w.stamps[resource] = stamps[i:]
+		}
+	}
+	for resource, p := range w.mints {
+		if p.Created.Before(cutoff) {
+			delete(w.mints, resource)
+		}
+	}
+	return evicted
+}
+
+// Put adds a minted header to the wallet, replacing any mint progress saved
+// for its resource.
+func (w *Wallet) Put(header string) error {
+	if _, err := scanHeader(header); err != nil {
+		return err
+	}
+	created, err := parseHashcashTime(strings.Split(header, ":")[2])
+	if err != nil {
+		return ErrInvalidHeader
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.add(header, created)
+	delete(w.mints, strings.Split(header, ":")[3])
+	return w.save()
+}
+
+// Take removes and returns the oldest unexpired stamp for resource, ok is
+// false if the wallet holds none.
+func (w *Wallet) Take(resource string) (header string, ok bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.evict()
+	stamps := w.stamps[resource]
+	if len(stamps) == 0 {
+		return "", false, nil
+	}
+	header = stamps[0].header
+	if len(stamps) == 1 {
+		delete(w.stamps, resource)
+	} else {
+		w.stamps[resource] = stamps[1:]
+	}
+	return header, true, w.save()
+}
+
+// Len returns the number of stamps held for resource.
+func (w *Wallet) Len(resource string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.stamps[resource])
+}
+
+// SaveProgress saves the progress of an in-progress mint, replacing earlier
+// progress for the same resource.
+func (w *Wallet) SaveProgress(p MintProgress) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.mints[p.Resource] = p
+	return w.save()
+}
+
+// Progress returns the saved progress of a mint for resource.
+func (w *Wallet) Progress(resource string) (MintProgress, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.mints[resource]
+	return p, ok
+}
+
+// Evict removes expired stamps and mint progress, returning the number of
+// stamps removed.
+func (w *Wallet) Evict() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := w.evict()
+	return n, w.save()
+}
+
+// RecordSolve records that a header of bits was minted hashing attempts
+// headers in elapsed, so PredictedSolveTime learns from mints made outside
+// PreMine, which records its own.
+func (w *Wallet) RecordSolve(bits Bits, attempts uint64, elapsed time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.recordWork(bits, attempts, elapsed, true)
+	return w.save()
+}
+
+// recordWork adds work minting headers of bits to the solve history. w.mu
+// must be held.
+func (w *Wallet) recordWork(bits Bits, attempts uint64, elapsed time.Duration, solved bool) {
+	s := w.solves[bits]
+	s.Bits = bits
+	s.Attempts += attempts
+	s.Seconds += elapsed.Seconds()
+	if solved {
+		s.Solved++
+	}
+	w.solves[bits] = s
+}
+
+// PredictedSolveTime returns the expected time to mint a header of bits on
+// this client, from the hash rate measured minting headers of bits, or of
+// any bits when none were minted, rather than a static estimate. ok is false
+// when no mint has been recorded. As solve times vary widely around their
+// expectation, see Bits.ExpectedAttempts, the prediction is best used as the
+// scale of a progress bar or deadline.
+func (w *Wallet) PredictedSolveTime(bits Bits) (d time.Duration, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s, ok := w.solves[bits]
+	if !ok || s.Attempts == 0 || s.Seconds <= 0 {
+		s = walletSolves{}
+		for _, level := range w.solves {
+			s.Attempts += level.Attempts
+			s.Seconds += level.Seconds
+		}
+	}
+	if s.Attempts == 0 || s.Seconds <= 0 {
+		return 0, false
+	}
+	seconds := bits.ExpectedAttempts() * s.Seconds / float64(s.Attempts)
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return math.MaxInt64, true
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// PreMineConfig for background pre-mining
+type PreMineConfig struct {
+	// Target number of stamps kept in the wallet.
+	Target int
+	// Power monitor of power conditions, mining pauses while the host is on
+	// battery or throttled. SystemPowerMonitor is used when nil,
+	// NopPowerMonitor never pauses.
+	Power PowerMonitor
+	// Slice wall clock time mined between checks of the wallet and power
+	// conditions, progress is saved after each slice.
+	Slice time.Duration
+	// Poll time waited before checking again while the wallet holds Target
+	// stamps or mining is paused.
+	Poll time.Duration
+}
+
+// DefaultPreMineConfig default pre-mining configuration
+var DefaultPreMineConfig = &PreMineConfig{
+	Target: 10,
+	Slice:  time.Second,
+	Poll:   time.Minute,
+}
+
+// PreMine mines stamps in the background until ctx is done, keeping Target
+// stamps in the wallet for the resource minted by instances newMinter
+// returns. A mint interrupted by a restart is resumed from its saved
+// progress. The work of each slice is added to the solve history, see
+// PredictedSolveTime. It returns ctx's error. If config is nil DefaultPreMineConfig is
+// used.
+func (w *Wallet) PreMine(ctx context.Context, newMinter func() (*Hashcash, error), config *PreMineConfig) error {
+	if config == nil {
+		config = DefaultPreMineConfig
+	}
+	power := config.Power
+	if power == nil {
+		power = SystemPowerMonitor()
+	}
+	var minter *Hashcash
+	for {
+		if minter == nil {
+			h, err := newMinter()
+			if err != nil {
+				return err
+			}
+			if p, ok := w.Progress(h.resource); ok {
+				h.Resume(p)
+			}
+			minter = h
+		}
+		if w.Len(minter.resource) >= config.Target || paused(power) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(config.Poll):
+			}
+			continue
+		}
+		counter, start := minter.counter, time.Now()
+		done, header, err := minter.MintStep(config.Slice)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.recordWork(minter.bits, minter.counter-counter+1, time.Since(start), done)
+		w.mu.Unlock()
+		if done {
+			err = w.Put(header)
+			minter = nil
+		} else {
+			err = w.SaveProgress(minter.Progress())
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// PreMiner returns a Component running PreMine, e.g. to be managed by a
+// Runtime.
+func (w *Wallet) PreMiner(newMinter func() (*Hashcash, error), config *PreMineConfig) Component {
+	return RunFunc(func(ctx context.Context) error {
+		return w.PreMine(ctx, newMinter, config)
+	})
+}
+
+// paused reports whether power conditions call for mining to pause.
+func paused(monitor PowerMonitor) bool {
+	state, err := monitor.PowerState()
+	return err == nil && (state.OnBattery || state.Throttled)
+}
@@ -0,0 +1,222 @@
+/*
+Package webhook posts hashcash verification events to an operator supplied
+URL, so small deployments get abuse alerts without running a metrics stack.
+
+A Dispatcher receives events from Config.OnVerify and delivers the ones
+passing its filter in the background, retrying failed deliveries. Bodies are
+signed with HMAC-SHA256 when a secret is configured:
+
+	d := webhook.New(&webhook.Config{
+		URL:    "https://alerts.example.com/hashcash",
+		Secret: secret,
+		Filter: webhook.DoubleSpends,
+	})
+	config.OnVerify = d.OnVerify
+	rt.Add("webhook", d)
+*/
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/umahmood/hashcash"
+)
+
+// SignatureHeader header carrying the signature of the body, see Sign.
+const SignatureHeader = "X-Hashcash-Signature"
+
+// Config for a dispatcher
+type Config struct {
+	// URL events are posted to.
+	URL string
+	// Secret optional key the body of each delivery is signed with, see
+	// Sign. Deliveries are not signed when empty.
+	Secret []byte
+	// Filter optional function selecting the events delivered, e.g.
+	// Failures or DoubleSpends. Every event is delivered when nil.
+	Filter func(hashcash.VerifyEvent) bool
+	// Client used to post events, a client with a 10 second timeout when
+	// nil.
+	Client *http.Client
+	// Retries how many times a delivery failing with a network error, 429
+	// Too Many Requests or a 5xx status is retried. Zero never retries.
+	Retries int
+	// Backoff time waited before the first retry, doubled on each retry, one
+	// second when zero.
+	Backoff time.Duration
+	// Queue number of events held awaiting delivery, 1024 when zero. Events
+	// arriving while the queue is full are dropped, see Dispatcher.Dropped.
+	Queue int
+	// OnError optional callback invoked with the error of each delivery
+	// which failed after all retries.
+	OnError func(error)
+}
+
+// Event JSON body of a delivery, describing a verification.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance,omitempty"`
+	Header   string    `json:"header"`
+	Valid    bool      `json:"valid"`
+	Status   string    `json:"status"`
+	// Reason stable name of the reason verification failed, see
+	// hashcash.Reason.
+	Reason       string `json:"reason"`
+	Error        string `json:"error,omitempty"`
+	Resource     string `json:"resource,omitempty"`
+	Bits         int    `json:"bits"`
+	ZeroBits     int    `json:"zero_bits"`
+	CanonicalKey string `json:"canonical_key,omitempty"`
+	Remote       string `json:"remote,omitempty"`
+}
+
+// Failures filter selecting events of headers which failed verification.
+func Failures(ev hashcash.VerifyEvent) bool {
+	return !ev.Valid
+}
+
+// DoubleSpends filter selecting events of headers rejected as already spent.
+func DoubleSpends(ev hashcash.VerifyEvent) bool {
+	return errors.Is(ev.Err, hashcash.ErrSpent)
+}
+
+// Sign returns the signature of body with secret, as sent in the
+// X-Hashcash-Signature header: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of body. Receivers compare it with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers verification events to a webhook. Events are queued by
+// OnVerify, which never blocks verification, and delivered in order by a
+// goroutine running from Start until Close. Events still queued when it is
+// closed are not delivered. It is safe for concurrent use.
+type Dispatcher struct {
+	hashcash.Component
+	config  Config
+	events  chan Event
+	dropped atomic.Uint64
+}
+
+// New creates a dispatcher. It delivers nothing until started, e.g. by a
+// hashcash.Runtime.
+func New(config *Config) *Dispatcher {
+	d := &Dispatcher{config: *config}
+	if d.config.Client == nil {
+		d.config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if d.config.Backoff <= 0 {
+		d.config.Backoff = time.Second
+	}
+	if d.config.Queue <= 0 {
+		d.config.Queue = 1024
+	}
+	d.events = make(chan Event, d.config.Queue)
+	d.Component = hashcash.RunFunc(d.run)
+	return d
+}
+
+// OnVerify queues ev for delivery if it passes the filter, to be set as
+// hashcash.Config.OnVerify.
+func (d *Dispatcher) OnVerify(ev hashcash.VerifyEvent) {
+	if d.config.Filter != nil && !d.config.Filter(ev) {
+		return
+	}
+	e := Event{
+		Time:         time.Now().UTC(),
+		Instance:     ev.Instance,
+		Header:       ev.Header,
+		Valid:        ev.Valid,
+		Status:       ev.Status.String(),
+		Reason:       hashcash.ReasonOf(ev.Err).String(),
+		Resource:     ev.Resource,
+		Bits:         int(ev.Bits),
+		ZeroBits:     ev.ZeroBits,
+		CanonicalKey: ev.CanonicalKey,
+		Remote:       ev.Remote.Key,
+	}
+	if ev.Err != nil {
+		e.Error = ev.Err.Error()
+	}
+	select {
+	case d.events <- e:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped as the queue was full.
+func (d *Dispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// run delivers queued events until ctx is done.
+func (d *Dispatcher) run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-d.events:
+			if err := d.deliver(ctx, e); err != nil && ctx.Err() == nil && d.config.OnError != nil {
+				d.config.OnError(err)
+			}
+		}
+	}
+}
+
+// deliver posts e, retrying failures which may be transient.
+func (d *Dispatcher) deliver(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	backoff := d.config.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(ctx, body)
+		if err == nil || !retry || attempt == d.config.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post posts body once, reporting whether a failure may be retried.
+func (d *Dispatcher) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(d.config.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(d.config.Secret, body))
+	}
+	resp, err := d.config.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook: %s returned %s", d.config.URL, resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
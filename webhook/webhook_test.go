@@ -0,0 +1,96 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umahmood/hashcash"
+	"github.com/umahmood/hashcash/webhook"
+)
+
+func TestDispatcher(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		events   []webhook.Event
+		received = make(chan struct{}, 1)
+		secret   = []byte("secret")
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// the first delivery fails and is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if sig := r.Header.Get(webhook.SignatureHeader); sig != webhook.Sign(secret, body) {
+			t.Errorf("signature %q\n", sig)
+		}
+		var e webhook.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("%v\n", err)
+		}
+		events = append(events, e)
+		received <- struct{}{}
+	}))
+	defer srv.Close()
+	d := webhook.New(&webhook.Config{
+		URL:     srv.URL,
+		Secret:  secret,
+		Filter:  webhook.DoubleSpends,
+		Retries: 1,
+		Backoff: time.Millisecond,
+		OnError: func(err error) { t.Errorf("%v\n", err) },
+	})
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer d.Close()
+	hc, err := hashcash.New(&hashcash.Resource{Data: "someone@gmail.com", Accept: []string{"someone@gmail.com"}}, &hashcash.Config{
+		Bits:     8,
+		Future:   time.Now().AddDate(0, 0, 2),
+		Expired:  time.Now().AddDate(0, 0, -30),
+		Storage:  hashcash.NewMemoryStorage(nil),
+		Name:     "comments",
+		OnVerify: d.OnVerify,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	stamp, err := hc.ComputeContext(context.Background())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.VerifyRemote(stamp, hashcash.Remote{Key: "192.0.2.1"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if _, err := hc.VerifyRemote(stamp, hashcash.Remote{Key: "192.0.2.2"}); err != hashcash.ErrSpent {
+		t.Fatalf("replayed stamp got %v\n", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event not delivered\n")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || attempts != 2 {
+		t.Fatalf("got %d events in %d attempts\n", len(events), attempts)
+	}
+	e := events[0]
+	if e.Valid || e.Reason != "spent" || e.Header != stamp || e.Remote != "192.0.2.2" || e.Instance != "comments" {
+		t.Errorf("event %+v\n", e)
+	}
+	if d.Dropped() != 0 {
+		t.Errorf("dropped %d events\n", d.Dropped())
+	}
+}